@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -19,12 +23,20 @@ type OrderEvent struct {
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("order-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers("localhost:9092"),
 		kgo.ConsumerGroup("order-processor"),
@@ -35,8 +47,9 @@ func run() error {
 		return fmt.Errorf("error creating client: %w", err)
 	}
 	defer client.Close()
+	logger = kafkaobs.Consumer(logger, client)
 
-	fmt.Println("Starting to consume orders...")
+	logger.Info("starting to consume orders")
 
 	ctx := context.Background()
 	processedOrders := 0
@@ -44,25 +57,28 @@ func run() error {
 	for {
 		fetches := client.PollFetches(ctx)
 		if errs := fetches.Errors(); len(errs) > 0 {
-			fmt.Printf("Error fetching: %v\n", errs)
+			for _, err := range errs {
+				logger.Error("fetch failed", "topic", err.Topic, "partition", err.Partition, "err", err.Err)
+			}
 			continue
 		}
 
 		iter := fetches.RecordIter()
 		for !iter.Done() {
 			record := iter.Next()
+			recordLogger := kafkaobs.Record(logger, record)
 
 			var order OrderEvent
 			if err := json.Unmarshal(record.Value, &order); err != nil {
-				fmt.Printf("Error unmarshaling message: %v\n", err)
+				recordLogger.Error("unmarshaling message failed", "err", err)
 				continue
 			}
 
-			fmt.Printf("Processing order %s for user %s: $%.2f\n", order.OrderID, order.UserID, order.Amount)
+			recordLogger.Info("processing order", "order_id", order.OrderID, "user_id", order.UserID, "amount", order.Amount)
 			processedOrders++
 
 			if processedOrders >= 10 {
-				fmt.Println("Processed 10 orders, shutting down...")
+				logger.Info("processed 10 orders, shutting down")
 				return nil
 			}
 		}
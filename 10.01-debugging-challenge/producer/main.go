@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -20,12 +24,20 @@ type OrderEvent struct {
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("producer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("order-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers("localhost:9093"),
 		kgo.RequiredAcks(kgo.NoAck()),
@@ -44,12 +56,12 @@ func run() error {
 	}
 
 	ctx := context.Background()
-	fmt.Println("Starting to publish messages...")
+	logger.Info("starting to publish messages")
 
 	for _, order := range orders {
 		value, err := json.Marshal(order)
 		if err != nil {
-			fmt.Printf("Failed to marshal order: %v\n", err)
+			logger.Error("marshaling order failed", "order_id", order.OrderID, "err", err)
 			continue
 		}
 
@@ -61,14 +73,14 @@ func run() error {
 
 		results := client.ProduceSync(ctx, record)
 		if err := results.FirstErr(); err != nil {
-			fmt.Printf("Failed to produce order: %v\n", err)
+			logger.Error("producing order failed", "order_id", order.OrderID, "err", err)
 			return err
 		}
 
-		fmt.Printf("Produced order: %s\n", order.OrderID)
+		kafkaobs.Record(logger, results[0].Record).Info("produced order", "order_id", order.OrderID)
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	fmt.Println("All orders produced successfully!")
+	logger.Info("all orders produced successfully")
 	return nil
 }
@@ -2,10 +2,27 @@ module producer
 
 go 1.24.0
 
-require github.com/twmb/franz-go v1.20.5
+require (
+	github.com/twmb/franz-go v1.20.5
+	kafkaobs v0.0.0
+)
 
 require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/klauspost/compress v1.18.1 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/pierrec/lz4/v4 v4.1.22 // indirect
+	github.com/prometheus/client_golang v1.22.0 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/twmb/franz-go/pkg/kmsg v1.12.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	google.golang.org/protobuf v1.36.5 // indirect
+	kafkametrics v0.0.0 // indirect
 )
+
+replace kafkametrics => ../../shared/kafkametrics
+
+replace kafkaobs => ../../shared/kafkaobs
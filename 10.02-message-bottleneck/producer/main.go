@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"sync"
 	"time"
 
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -20,12 +24,22 @@ type Order struct {
 }
 
 func main() {
+	app := kafkaobs.New("metrics-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		slog.Error("producer failed", "err", err)
+		os.Exit(1)
+	}
+	logger := app.Logger
+
 	// Create Kafka client
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers("localhost:9092", "localhost:9093", "localhost:9094"),
 	)
 	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+		logger.Error("creating client failed", "err", err)
+		os.Exit(1)
 	}
 	defer client.Close()
 
@@ -33,7 +47,7 @@ func main() {
 	totalMessages := 1000
 	regions := []string{"us-east", "us-west", "eu-west", "ap-south"}
 
-	fmt.Printf("Producing %d messages to topic 'metrics'...\n", totalMessages)
+	logger.Info("producing messages", "topic", "metrics", "messages", totalMessages)
 	start := time.Now()
 
 	var wg sync.WaitGroup
@@ -67,7 +81,7 @@ func main() {
 
 			ctx := context.Background()
 			if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
-				log.Printf("Failed to produce message: %v", err)
+				logger.Error("producing message failed", "order_id", order.OrderID, "err", err)
 			}
 
 			mu.Lock()
@@ -79,10 +93,8 @@ func main() {
 	wg.Wait()
 	elapsed := time.Since(start)
 
-	fmt.Printf("\nCompleted in %s\n", elapsed)
-	fmt.Printf("Messages per second: %.2f\n\n", float64(totalMessages)/elapsed.Seconds())
-	fmt.Println("Messages per region:")
+	logger.Info("completed", "elapsed", elapsed.String(), "messages_per_second", fmt.Sprintf("%.2f", float64(totalMessages)/elapsed.Seconds()))
 	for region, count := range regionCounts {
-		fmt.Printf("  %s: %d messages\n", region, count)
+		logger.Info("messages per region", "region", region, "messages", count)
 	}
 }
@@ -2,37 +2,59 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer stopped", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("auto-commit")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
+	if err := app.Start(ctx, ":9301"); err != nil {
+		return err
+	}
+	metrics := app.Metrics
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, app.Opts()...)
+	client, err := kgo.NewClient(append(append(opts, metrics.GroupOpts()...),
 		kgo.ConsumerGroup("auto-commit-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.AutoCommitInterval(3*time.Second), // NOTE: auto-commit every 3 seconds
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("error creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
-	log.Println("starting consumer...")
+	logger.Info("starting consumer", "brokers", cfg.String())
 
-	ctx := context.Background()
 	consumed := 0
 
 	for {
@@ -41,22 +63,23 @@ func run() error {
 			return fmt.Errorf("fetch errors: %v", errs)
 		}
 
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 
 		iter := fetches.RecordIter()
 		for !iter.Done() {
 			record := iter.Next()
 			consumed++
-			log.Printf("processing message %d: %s", consumed, string(record.Value))
+			recordLogger := kafkaobs.Record(logger, record)
+			recordLogger.Info("processing message", "number", consumed, "value", string(record.Value))
 
 			if consumed == 8 {
-				log.Printf("note: auto-commit may have already committed offset %d", record.Offset)
+				recordLogger.Warn("auto-commit may have already committed this offset")
 				return fmt.Errorf("simulated crash on message %d", consumed)
 			}
 
 			// Simulate slow processing (2 seconds per message)
 			time.Sleep(2 * time.Second)
-			log.Printf("successfully processed message %d", consumed)
+			recordLogger.Info("successfully processed message", "number", consumed)
 		}
 	}
 }
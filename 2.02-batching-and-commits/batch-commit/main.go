@@ -2,37 +2,59 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer stopped", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("batch-commit")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
+	if err := app.Start(ctx, ":9302"); err != nil {
+		return err
+	}
+	metrics := app.Metrics
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, app.Opts()...)
+	client, err := kgo.NewClient(append(append(opts, metrics.GroupOpts()...),
 		kgo.ConsumerGroup("batch-commit-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.DisableAutoCommit(), // NOTE: disable auto-commit for manual control
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("error creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
-	log.Println("starting consumer...")
+	logger.Info("starting consumer", "brokers", cfg.String())
 
-	ctx := context.Background()
 	consumed := 0
 
 	for {
@@ -41,16 +63,16 @@ func run() error {
 			return fmt.Errorf("fetch errors: %v", errs)
 		}
 
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 
 		records := fetches.Records()
 		consumed += len(records)
 
-		log.Printf("processing %d messages", len(records))
+		logger.Info("processing messages", "records", len(records))
 		time.Sleep(2 * time.Second)
-		log.Printf("successfully processed message %d", consumed)
+		logger.Info("successfully processed messages", "consumed", consumed)
 
-		err = client.CommitRecords(ctx, records...)
+		err = metrics.CommitRecords(ctx, client, records...)
 		if err != nil {
 			return fmt.Errorf("commit error: %w", err)
 		}
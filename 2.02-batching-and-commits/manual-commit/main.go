@@ -2,37 +2,58 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer stopped", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("manual-commit")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
+	if err := app.Start(ctx, ":9303"); err != nil {
+		return err
+	}
+	metrics := app.Metrics
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, app.Opts()...)
+	client, err := kgo.NewClient(append(append(opts, metrics.GroupOpts()...),
 		kgo.ConsumerGroup("manual-commit-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.DisableAutoCommit(), // NOTE: disable auto-commit for manual control
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("error creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
-	log.Println("starting consumer...")
-
-	ctx := context.Background()
+	logger.Info("starting consumer", "brokers", cfg.String())
 
 	for {
 		fetches := client.PollRecords(ctx, 5)
@@ -40,16 +61,17 @@ func run() error {
 			return fmt.Errorf("fetch errors: %v", errs)
 		}
 
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 
 		records := fetches.Records()
 
 		for _, record := range records {
-			log.Printf("processing message at offset %d", record.Offset)
+			recordLogger := kafkaobs.Record(logger, record)
+			recordLogger.Info("processing message")
 			time.Sleep(500 * time.Millisecond)
-			log.Printf("successfully processed message at offset %d", record.Offset)
+			recordLogger.Info("successfully processed message")
 
-			err = client.CommitRecords(ctx, record)
+			err = metrics.CommitRecords(ctx, client, record)
 			if err != nil {
 				return fmt.Errorf("commit error: %w", err)
 			}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"strings"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+	"kafkatrace"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -14,24 +20,51 @@ const maxRetries = 3
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatal(err)
+		slog.Error("consumer stopped", "err", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("dead-letter-queue")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.Start(context.Background(), ":9306"); err != nil {
+		return err
+	}
+
+	opts, err := kafkaclient.Options(context.Background(), "localhost:9092")
+	if err != nil {
+		return fmt.Errorf("configuring client: %w", err)
+	}
+
+	metrics := app.Metrics
+	failed := metrics.Counter("messages_failed_total", "Messages that could not be processed nor sent to the DLQ")
+	opts = append(opts, app.Opts()...)
+	opts = append(opts, metrics.GroupOpts()...)
+
+	tracer, err := kafkatrace.New(context.Background(), "dead-letter-queue")
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer tracer.Shutdown(context.Background())
+	app.Logger.Info("tracing", "exporter", kafkatrace.Exporter())
+	opts = append(opts, tracer.Opts()...)
+
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumerGroup("dlq-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.DisableAutoCommit(),
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
-	log.Printf("starting consumer with dead letter queue (max retries: %d, dlq topic: orders-dlq)\n", maxRetries)
+	logger.Info("starting consumer with dead letter queue", "max_retries", maxRetries, "dlq_topic", "orders-dlq")
 
 	ctx := context.Background()
 
@@ -42,45 +75,51 @@ func run() error {
 		}
 
 		records := fetches.Records()
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 
 		for _, record := range records {
-			log.Printf("processing message: %q (partition=%d, offset=%d)\n", string(record.Value), record.Partition, record.Offset)
-
-			err := processWithRetry(ctx, client, record)
+			recordLogger := kafkaobs.Record(logger, record)
+			recordLogger.Info("processing message", "value", string(record.Value))
+
+			// The process span continues the trace of the producer, the DLQ
+			// record starts a new trace linked to it
+			recordCtx, span := tracer.Process(record)
+			err := processWithRetry(recordCtx, client, tracer, record, recordLogger)
+			kafkatrace.End(span, err)
 			if err != nil {
-				log.Printf("failed to process message after %d retries: %v\n", maxRetries, err)
+				recordLogger.Error("failed to process message nor send it to the DLQ", "retries", maxRetries, "err", err)
+				failed.Inc()
 				continue
 			}
 
-			err = client.CommitRecords(ctx, record)
+			err = metrics.CommitRecords(ctx, client, record)
 			if err != nil {
 				return fmt.Errorf("committing offset: %w", err)
 			}
 
-			log.Println("offset committed")
+			recordLogger.Info("offset committed")
 		}
 	}
 }
 
-func processWithRetry(ctx context.Context, client *kgo.Client, record *kgo.Record) (err error) {
+func processWithRetry(ctx context.Context, client *kgo.Client, tracer *kafkatrace.Tracer, record *kgo.Record, logger *slog.Logger) (err error) {
 	for attempt := range maxRetries {
-		log.Printf("processing attempt %d/%d\n", attempt, maxRetries)
+		logger.Info("processing attempt", "attempt", attempt, "max_retries", maxRetries)
 
-		err := processMessage(record)
+		err := processMessage(record, logger)
 		if err == nil {
-			log.Println("message processed successfully")
+			logger.Info("message processed successfully")
 			return nil
 		}
 
-		log.Printf("attempt %d failed: %v\n", attempt, err)
-		log.Println("retrying immediately...")
+		logger.Warn("attempt failed, retrying immediately", "attempt", attempt, "err", err)
+		kafkatrace.Retry(ctx, attempt, err)
 	}
 
-	return sendToDLQ(ctx, client, record)
+	return sendToDLQ(ctx, client, tracer, record, logger)
 }
 
-func processMessage(record *kgo.Record) error {
+func processMessage(record *kgo.Record, logger *slog.Logger) error {
 	time.Sleep(200 * time.Millisecond)
 
 	message := string(record.Value)
@@ -89,11 +128,11 @@ func processMessage(record *kgo.Record) error {
 		return fmt.Errorf("simulated error: message contains 'fail'")
 	}
 
-	log.Printf("processing order: %s\n", message)
+	logger.Info("processing order", "order", message)
 	return nil
 }
 
-func sendToDLQ(ctx context.Context, client *kgo.Client, record *kgo.Record) error {
+func sendToDLQ(ctx context.Context, client *kgo.Client, tracer *kafkatrace.Tracer, record *kgo.Record, logger *slog.Logger) error {
 	dlqRecord := &kgo.Record{
 		Topic: "orders-dlq",
 		Key:   record.Key,
@@ -107,9 +146,10 @@ func sendToDLQ(ctx context.Context, client *kgo.Client, record *kgo.Record) erro
 		},
 	}
 
-	if err := client.ProduceSync(ctx, dlqRecord).FirstErr(); err != nil {
+	if err := client.ProduceSync(tracer.Derived(ctx, record), dlqRecord).FirstErr(); err != nil {
 		return fmt.Errorf("producing to DLQ: %w", err)
 	}
 
+	logger.Warn("sent message to the DLQ", "dlq_topic", dlqRecord.Topic, "dlq_partition", dlqRecord.Partition, "dlq_offset", dlqRecord.Offset)
 	return nil
 }
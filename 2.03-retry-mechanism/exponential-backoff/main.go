@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"os"
 	"strings"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+	"kafkatrace"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -20,25 +26,52 @@ const (
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatal(err)
+		slog.Error("consumer stopped", "err", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("exponential-backoff")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.Start(context.Background(), ":9305"); err != nil {
+		return err
+	}
+
+	opts, err := kafkaclient.Options(context.Background(), "localhost:9092")
+	if err != nil {
+		return fmt.Errorf("configuring client: %w", err)
+	}
+
+	metrics := app.Metrics
+	skipped := metrics.Counter("messages_skipped_total", "Messages skipped after every retry failed")
+	opts = append(opts, app.Opts()...)
+	opts = append(opts, metrics.GroupOpts()...)
+
+	tracer, err := kafkatrace.New(context.Background(), "exponential-backoff")
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer tracer.Shutdown(context.Background())
+	app.Logger.Info("tracing", "exporter", kafkatrace.Exporter())
+	opts = append(opts, tracer.Opts()...)
+
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumerGroup("exponential-backoff-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.DisableAutoCommit(),
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
 	ctx := context.Background()
-	log.Printf("starting consumer with exponential backoff (max retries: %d, initial: %v, multiplier: %.1fx)\n", maxRetries, initialBackoff, backoffMultiple)
+	logger.Info("starting consumer with exponential backoff", "max_retries", maxRetries, "initial_backoff", initialBackoff, "multiplier", backoffMultiple)
 
 	for {
 		fetches := client.PollRecords(ctx, 10)
@@ -46,42 +79,46 @@ func run() error {
 			return fmt.Errorf("polling records: %v", errs)
 		}
 
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 		records := fetches.Records()
 
 		for _, record := range records {
-			log.Printf("received message: %q (partition=%d, offset=%d)\n", string(record.Value), record.Partition, record.Offset)
+			recordLogger := kafkaobs.Record(logger, record)
+			recordLogger.Info("received message", "value", string(record.Value))
 
-			err := processWithExponentialBackoff(record)
+			recordCtx, span := tracer.Process(record)
+			err := processWithExponentialBackoff(recordCtx, record, recordLogger)
+			kafkatrace.End(span, err)
 			if err != nil {
-				log.Printf("failed to process message after %d retries: %v\n", maxRetries, err)
-				log.Println("warning: message will be skipped")
+				recordLogger.Warn("skipping message, every retry failed", "retries", maxRetries, "err", err)
+				skipped.Inc()
 			}
 
-			err = client.CommitRecords(ctx, record)
+			err = metrics.CommitRecords(ctx, client, record)
 			if err != nil {
 				return fmt.Errorf("committing offset: %w", err)
 			}
 
-			log.Println("offset committed")
+			recordLogger.Info("offset committed")
 		}
 	}
 }
 
-func processWithExponentialBackoff(record *kgo.Record) (err error) {
+func processWithExponentialBackoff(ctx context.Context, record *kgo.Record, logger *slog.Logger) (err error) {
 	for attempt := range maxRetries {
-		log.Printf("processing attempt %d/%d\n", attempt, maxRetries)
+		logger.Info("processing attempt", "attempt", attempt, "max_retries", maxRetries)
 
-		err = processMessage(record, attempt)
+		err = processMessage(record, attempt, logger)
 		if err == nil {
-			log.Println("message processed successfully")
+			logger.Info("message processed successfully")
 			return nil
 		}
 
-		log.Printf("attempt %d failed: %v\n", attempt, err)
+		logger.Warn("attempt failed", "attempt", attempt, "err", err)
+		kafkatrace.Retry(ctx, attempt, err)
 
 		backoff := calculateBackoff(attempt)
-		log.Printf("waiting %v before retry\n", backoff)
+		logger.Info("waiting before retry", "backoff", backoff)
 		time.Sleep(backoff)
 	}
 
@@ -96,7 +133,7 @@ func calculateBackoff(attempt int) time.Duration {
 	return time.Duration(backoff)
 }
 
-func processMessage(record *kgo.Record, attempt int) error {
+func processMessage(record *kgo.Record, attempt int, logger *slog.Logger) error {
 	time.Sleep(200 * time.Millisecond)
 
 	message := string(record.Value)
@@ -109,6 +146,6 @@ func processMessage(record *kgo.Record, attempt int) error {
 		return fmt.Errorf("simulated permanent error: invalid data format")
 	}
 
-	log.Printf("processing order: %s\n", message)
+	logger.Info("processing order", "order", message)
 	return nil
 }
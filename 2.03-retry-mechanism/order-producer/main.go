@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"kafkaclient"
+	"kafkaobs"
+	"kafkatrace"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("producer stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+// run produces a record for every line of stdin, like
+// kafka-console-producer.sh, with a trace context in the headers so the
+// consumers continue the trace
+func run() error {
+	topic := flag.String("topic", "orders", "topic to produce to")
+	app := kafkaobs.New("order-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	// A producer reading stdin is short-lived, it serves no endpoint
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	ctx := context.Background()
+	opts, err := kafkaclient.Options(ctx, "localhost:9092")
+	if err != nil {
+		return fmt.Errorf("configuring client: %w", err)
+	}
+
+	tracer, err := kafkatrace.New(ctx, "order-producer")
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer tracer.Shutdown(context.Background())
+	logger.Info("tracing", "exporter", kafkatrace.Exporter())
+
+	client, err := kgo.NewClient(append(append(opts, app.Opts()...), tracer.Opts()...)...)
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+	defer client.Close()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		record := &kgo.Record{Topic: *topic, Value: []byte(scanner.Text())}
+		if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
+			return fmt.Errorf("producing message: %w", err)
+		}
+		kafkaobs.Record(logger, record).Info("produced message", "value", string(record.Value))
+	}
+	return scanner.Err()
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"strings"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+	"kafkatrace"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -14,25 +20,52 @@ const maxRetries = 3
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatal(err)
+		slog.Error("consumer stopped", "err", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
+	app := kafkaobs.New("simple-retry")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.Start(context.Background(), ":9304"); err != nil {
+		return err
+	}
+
+	opts, err := kafkaclient.Options(context.Background(), "localhost:9092")
+	if err != nil {
+		return fmt.Errorf("configuring client: %w", err)
+	}
+
+	metrics := app.Metrics
+	skipped := metrics.Counter("messages_skipped_total", "Messages skipped after every retry failed")
+	opts = append(opts, app.Opts()...)
+	opts = append(opts, metrics.GroupOpts()...)
+
+	tracer, err := kafkatrace.New(context.Background(), "simple-retry")
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer tracer.Shutdown(context.Background())
+	app.Logger.Info("tracing", "exporter", kafkatrace.Exporter())
+	opts = append(opts, tracer.Opts()...)
+
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumerGroup("simple-retry-group"),
 		kgo.ConsumeTopics("orders"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
 		kgo.DisableAutoCommit(),
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("creating client: %w", err)
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
 	ctx := context.Background()
-	log.Printf("starting consumer with simple retry mechanism (max retries: %d)\n", maxRetries)
+	logger.Info("starting consumer with simple retry mechanism", "max_retries", maxRetries)
 
 	for {
 		fetches := client.PollRecords(ctx, 10)
@@ -40,45 +73,49 @@ func run() error {
 			return fmt.Errorf("polling records: %v", errs)
 		}
 
-		log.Println("number of records fetched:", fetches.NumRecords())
+		logger.Info("fetched records", "records", fetches.NumRecords())
 		records := fetches.Records()
 
 		for _, record := range records {
-			log.Printf("received message: %q (partition=%d, offset=%d)\n", string(record.Value), record.Partition, record.Offset)
+			recordLogger := kafkaobs.Record(logger, record)
+			recordLogger.Info("received message", "value", string(record.Value))
 
-			err = processWithRetry(record)
+			recordCtx, span := tracer.Process(record)
+			err = processWithRetry(recordCtx, record, recordLogger)
+			kafkatrace.End(span, err)
 			if err != nil {
-				log.Printf("failed to process message after %d retries: %v\n", maxRetries, err)
-				log.Println("warning: message will be skipped")
+				recordLogger.Warn("skipping message, every retry failed", "retries", maxRetries, "err", err)
+				skipped.Inc()
 			}
 
-			err = client.CommitRecords(ctx, record)
+			err = metrics.CommitRecords(ctx, client, record)
 			if err != nil {
 				return fmt.Errorf("committing offset: %w", err)
 			}
 
-			log.Println("offset committed")
+			recordLogger.Info("offset committed")
 		}
 	}
 }
 
-func processWithRetry(record *kgo.Record) (err error) {
+func processWithRetry(ctx context.Context, record *kgo.Record, logger *slog.Logger) (err error) {
 	for attempt := range maxRetries {
-		log.Printf("processing attempt %d/%d\n", attempt, maxRetries)
+		logger.Info("processing attempt", "attempt", attempt, "max_retries", maxRetries)
 
-		err = processMessage(record)
+		err = processMessage(record, logger)
 		if err == nil {
-			log.Println("message processed successfully")
+			logger.Info("message processed successfully")
 			return nil
 		}
 
-		log.Printf("attempt %d failed: %v\n", attempt, err)
+		logger.Warn("attempt failed", "attempt", attempt, "err", err)
+		kafkatrace.Retry(ctx, attempt, err)
 	}
 
 	return fmt.Errorf("all retry attempts exhausted: %w", err)
 }
 
-func processMessage(record *kgo.Record) error {
+func processMessage(record *kgo.Record, logger *slog.Logger) error {
 	time.Sleep(200 * time.Millisecond)
 
 	message := string(record.Value)
@@ -86,6 +123,6 @@ func processMessage(record *kgo.Record) error {
 		return fmt.Errorf("simulated error: message contains 'fail'")
 	}
 
-	log.Printf("processing order: %s\n", message)
+	logger.Info("processing order", "order", message)
 	return nil
 }
@@ -0,0 +1,66 @@
+// Package confluentlog does for the confluent-kafka-go clients of this
+// exercise what kafkaobs does for franz-go: librdkafka logs into the slog
+// logger of the program, and the position of a message in the logs about it.
+//
+//	cm := kafka.ConfigMap{"bootstrap.servers": brokers}
+//	confluentlog.Configure(app.Logger, cm)
+//	consumer, err := kafka.NewConsumer(&cm)
+package confluentlog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Configure makes the client created from cm log into l with a
+// component=kafka field. librdkafka logs its warnings and errors, its
+// informational and debug logs only with -log-level debug, like the
+// franz-go clients.
+func Configure(l *slog.Logger, cm kafka.ConfigMap) {
+	level := 4 // syslog warning
+	if l.Enabled(context.Background(), slog.LevelDebug) {
+		level = 7
+	}
+	logs := make(chan kafka.LogEvent, 100)
+	cm["go.logs.channel.enable"] = true
+	cm["go.logs.channel"] = logs
+	cm["log_level"] = level
+
+	l = l.With("component", "kafka")
+	go func() {
+		for e := range logs {
+			l.Log(context.Background(), slogLevel(e.Level), e.Message, "client", e.Name, "tag", e.Tag)
+		}
+	}()
+}
+
+// slogLevel maps the syslog level of a librdkafka log
+func slogLevel(level int) slog.Level {
+	switch {
+	case level <= 3:
+		return slog.LevelError
+	case level == 4:
+		return slog.LevelWarn
+	case level <= 6:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// Message returns l with the topic, partition and offset of m, for the logs
+// about a consumed message or a delivered one. A message that failed to be
+// delivered has no offset.
+func Message(l *slog.Logger, m *kafka.Message) *slog.Logger {
+	tp := m.TopicPartition
+	if tp.Topic != nil {
+		l = l.With("topic", *tp.Topic)
+	}
+	l = l.With("partition", tp.Partition)
+	if tp.Offset >= 0 {
+		l = l.With("offset", int64(tp.Offset))
+	}
+	return l
+}
@@ -0,0 +1,5 @@
+module confluentlog
+
+go 1.24.0
+
+require github.com/confluentinc/confluent-kafka-go/v2 v2.3.0
@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"encoding/binary"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"confluentlog"
+	"kafkaobs"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
 	hamba "github.com/hamba/avro/v2"
@@ -23,135 +27,133 @@ type User struct {
 }
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("consumer failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("schema-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+
 	// Configuration
 	brokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	schemaRegistryURL := getEnv("SCHEMA_REGISTRY_URL", "http://localhost:8081")
 	topic := "users"
 	groupID := "user-consumer-group"
+	logger := app.Logger.With("group", groupID)
 
 	// Create Kafka consumer
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+	config := kafka.ConfigMap{
 		"bootstrap.servers":  brokers,
 		"group.id":           groupID,
 		"auto.offset.reset":  "earliest",
 		"enable.auto.commit": true,
-	})
+	}
+	confluentlog.Configure(logger, config)
+	consumer, err := kafka.NewConsumer(&config)
 	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
+		return fmt.Errorf("creating consumer: %w", err)
 	}
 	defer consumer.Close()
 
 	// Subscribe to topic
 	err = consumer.Subscribe(topic, nil)
 	if err != nil {
-		log.Fatalf("Failed to subscribe to topic: %v", err)
+		return fmt.Errorf("subscribing to %s: %w", topic, err)
 	}
 
 	// Create Schema Registry client
 	client, err := schemaregistry.NewClient(schemaregistry.NewConfig(schemaRegistryURL))
 	if err != nil {
-		log.Fatalf("Failed to create schema registry client: %v", err)
+		return fmt.Errorf("creating schema registry client: %w", err)
 	}
 
 	// Cache for schemas by ID
 	schemaCache := make(map[int]*hamba.RecordSchema)
 
 	// Setup graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("Received shutdown signal, closing consumer...")
-		cancel()
-	}()
-
-	log.Printf("Starting consumer, subscribed to topic: %s\n", topic)
-	log.Println("Waiting for messages... (Press Ctrl+C to exit)")
+	logger.Info("consuming messages, press Ctrl+C to exit", "topic", topic, "brokers", brokers)
 
 	messageCount := 0
 
 	// Consume messages
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Shutting down consumer...")
-			return
-		default:
-			msg, err := consumer.ReadMessage(100 * time.Millisecond)
-			if err != nil {
-				// Timeout is expected when no messages are available
-				if err.(kafka.Error).Code() == kafka.ErrTimedOut {
-					continue
-				}
-				log.Printf("Consumer error: %v\n", err)
+	for ctx.Err() == nil {
+		msg, err := consumer.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			// Timeout is expected when no messages are available
+			if err.(kafka.Error).Code() == kafka.ErrTimedOut {
 				continue
 			}
+			logger.Error("consume failed", "err", err)
+			continue
+		}
+		msgLogger := confluentlog.Message(logger, msg)
 
-			// Parse Schema Registry wire format: [magic_byte] [schema_id] [avro_payload]
-			if len(msg.Value) < 5 {
-				log.Printf("Message too short to be valid Avro with Schema Registry format\n")
+		// Parse Schema Registry wire format: [magic_byte] [schema_id] [avro_payload]
+		if len(msg.Value) < 5 {
+			msgLogger.Warn("message too short to be valid Avro with Schema Registry format", "bytes", len(msg.Value))
+			continue
+		}
+
+		if msg.Value[0] != 0 {
+			msgLogger.Warn("invalid magic byte, expected 0", "magic", msg.Value[0])
+			continue
+		}
+
+		schemaID := int(binary.BigEndian.Uint32(msg.Value[1:5]))
+		avroPayload := msg.Value[5:]
+
+		// Get schema from cache or Schema Registry
+		avroSchema, ok := schemaCache[schemaID]
+		if !ok {
+			schemaInfo, err := client.GetBySubjectAndID(topic+"-value", schemaID)
+			if err != nil {
+				msgLogger.Error("fetching schema failed", "schema_id", schemaID, "err", err)
 				continue
 			}
 
-			if msg.Value[0] != 0 {
-				log.Printf("Invalid magic byte: expected 0, got %d\n", msg.Value[0])
+			parsedSchema, err := hamba.Parse(schemaInfo.Schema)
+			if err != nil {
+				msgLogger.Error("parsing schema failed", "schema_id", schemaID, "err", err)
 				continue
 			}
 
-			schemaID := int(binary.BigEndian.Uint32(msg.Value[1:5]))
-			avroPayload := msg.Value[5:]
-
-			// Get schema from cache or Schema Registry
-			avroSchema, ok := schemaCache[schemaID]
+			recordSchema, ok := parsedSchema.(*hamba.RecordSchema)
 			if !ok {
-				schemaInfo, err := client.GetBySubjectAndID(topic+"-value", schemaID)
-				if err != nil {
-					log.Printf("Failed to fetch schema %d: %v\n", schemaID, err)
-					continue
-				}
-
-				parsedSchema, err := hamba.Parse(schemaInfo.Schema)
-				if err != nil {
-					log.Printf("Failed to parse schema: %v\n", err)
-					continue
-				}
-
-				recordSchema, ok := parsedSchema.(*hamba.RecordSchema)
-				if !ok {
-					log.Printf("Schema is not a record schema\n")
-					continue
-				}
-
-				schemaCache[schemaID] = recordSchema
-				avroSchema = recordSchema
-			}
-
-			// Deserialize the Avro payload
-			var user User
-			err = hamba.Unmarshal(avroSchema, avroPayload, &user)
-			if err != nil {
-				log.Printf("Failed to unmarshal Avro data: %v\n", err)
+				msgLogger.Error("schema is not a record schema", "schema_id", schemaID)
 				continue
 			}
 
-			messageCount++
-			createdTime := time.UnixMilli(user.CreatedAt)
-
-			log.Printf("📨 Message %d | Partition: %d, Offset: %d\n",
-				messageCount,
-				msg.TopicPartition.Partition,
-				msg.TopicPartition.Offset)
-			log.Printf("   User ID: %d\n", user.ID)
-			log.Printf("   Username: %s\n", user.Username)
-			log.Printf("   Email: %s\n", user.Email)
-			log.Printf("   Created: %s\n", createdTime.Format(time.RFC3339))
-			log.Println("   " + strings.Repeat("-", 50))
+			schemaCache[schemaID] = recordSchema
+			avroSchema = recordSchema
+		}
+
+		// Deserialize the Avro payload
+		var user User
+		err = hamba.Unmarshal(avroSchema, avroPayload, &user)
+		if err != nil {
+			msgLogger.Error("unmarshaling Avro data failed", "schema_id", schemaID, "err", err)
+			continue
 		}
+
+		messageCount++
+		createdTime := time.UnixMilli(user.CreatedAt)
+
+		msgLogger.Info("consumed user", "number", messageCount, "user_id", user.ID, "username", user.Username,
+			"email", user.Email, "created", createdTime.Format(time.RFC3339))
 	}
+
+	logger.Info("consumer stopped", "consumed", messageCount)
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
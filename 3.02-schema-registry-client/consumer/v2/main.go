@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"encoding/binary"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"confluentlog"
+	"kafkaobs"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
 	hamba "github.com/hamba/avro/v2"
@@ -24,142 +28,138 @@ type UserV2 struct {
 }
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("consumer failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("schema-consumer-v2")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+
 	// Configuration
 	brokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	schemaRegistryURL := getEnv("SCHEMA_REGISTRY_URL", "http://localhost:8081")
 	topic := "users"
 	groupID := "user-consumer-group-v2"
+	logger := app.Logger.With("group", groupID)
 
 	// Create Kafka consumer
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+	config := kafka.ConfigMap{
 		"bootstrap.servers":  brokers,
 		"group.id":           groupID,
 		"auto.offset.reset":  "earliest",
 		"enable.auto.commit": true,
-	})
+	}
+	confluentlog.Configure(logger, config)
+	consumer, err := kafka.NewConsumer(&config)
 	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
+		return fmt.Errorf("creating consumer: %w", err)
 	}
 	defer consumer.Close()
 
 	// Subscribe to topic
 	err = consumer.Subscribe(topic, nil)
 	if err != nil {
-		log.Fatalf("Failed to subscribe to topic: %v", err)
+		return fmt.Errorf("subscribing to %s: %w", topic, err)
 	}
 
 	// Create Schema Registry client
 	client, err := schemaregistry.NewClient(schemaregistry.NewConfig(schemaRegistryURL))
 	if err != nil {
-		log.Fatalf("Failed to create schema registry client: %v", err)
+		return fmt.Errorf("creating schema registry client: %w", err)
 	}
 
 	// Cache for schemas by ID
 	schemaCache := make(map[int]*hamba.RecordSchema)
 
 	// Setup graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	go func() {
-		<-sigChan
-		log.Println("Received shutdown signal, closing consumer...")
-		cancel()
-	}()
-
-	log.Printf("Starting consumer (v2), subscribed to topic: %s\n", topic)
-	log.Println("Waiting for messages... (Press Ctrl+C to exit)")
+	logger.Info("consuming messages, press Ctrl+C to exit", "topic", topic, "brokers", brokers)
 
 	messageCount := 0
 
 	// Consume messages
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Shutting down consumer...")
-			return
-		default:
-			msg, err := consumer.ReadMessage(100 * time.Millisecond)
-			if err != nil {
-				// Timeout is expected when no messages are available
-				if err.(kafka.Error).Code() == kafka.ErrTimedOut {
-					continue
-				}
-				log.Printf("Consumer error: %v\n", err)
+	for ctx.Err() == nil {
+		msg, err := consumer.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			// Timeout is expected when no messages are available
+			if err.(kafka.Error).Code() == kafka.ErrTimedOut {
 				continue
 			}
+			logger.Error("consume failed", "err", err)
+			continue
+		}
+		msgLogger := confluentlog.Message(logger, msg)
 
-			// Parse Schema Registry wire format: [magic_byte] [schema_id] [avro_payload]
-			if len(msg.Value) < 5 {
-				log.Printf("Message too short to be valid Avro with Schema Registry format\n")
-				continue
-			}
+		// Parse Schema Registry wire format: [magic_byte] [schema_id] [avro_payload]
+		if len(msg.Value) < 5 {
+			msgLogger.Warn("message too short to be valid Avro with Schema Registry format", "bytes", len(msg.Value))
+			continue
+		}
 
-			if msg.Value[0] != 0 {
-				log.Printf("Invalid magic byte: expected 0, got %d\n", msg.Value[0])
-				continue
-			}
+		if msg.Value[0] != 0 {
+			msgLogger.Warn("invalid magic byte, expected 0", "magic", msg.Value[0])
+			continue
+		}
 
-			schemaID := int(binary.BigEndian.Uint32(msg.Value[1:5]))
-			avroPayload := msg.Value[5:]
+		schemaID := int(binary.BigEndian.Uint32(msg.Value[1:5]))
+		avroPayload := msg.Value[5:]
 
-			// Get schema from cache or Schema Registry
-			avroSchema, ok := schemaCache[schemaID]
-			if !ok {
-				schemaInfo, err := client.GetBySubjectAndID(topic+"-value", schemaID)
-				if err != nil {
-					log.Printf("Failed to fetch schema %d: %v\n", schemaID, err)
-					continue
-				}
-
-				parsedSchema, err := hamba.Parse(schemaInfo.Schema)
-				if err != nil {
-					log.Printf("Failed to parse schema: %v\n", err)
-					continue
-				}
-
-				recordSchema, ok := parsedSchema.(*hamba.RecordSchema)
-				if !ok {
-					log.Printf("Schema is not a record schema\n")
-					continue
-				}
-
-				schemaCache[schemaID] = recordSchema
-				avroSchema = recordSchema
-				log.Printf("Cached schema ID %d (version with %d fields)\n", schemaID, len(recordSchema.Fields()))
+		// Get schema from cache or Schema Registry
+		avroSchema, ok := schemaCache[schemaID]
+		if !ok {
+			schemaInfo, err := client.GetBySubjectAndID(topic+"-value", schemaID)
+			if err != nil {
+				msgLogger.Error("fetching schema failed", "schema_id", schemaID, "err", err)
+				continue
 			}
 
-			// Deserialize the Avro payload
-			var user UserV2
-			err = hamba.Unmarshal(avroSchema, avroPayload, &user)
+			parsedSchema, err := hamba.Parse(schemaInfo.Schema)
 			if err != nil {
-				log.Printf("Failed to unmarshal Avro data: %v\n", err)
+				msgLogger.Error("parsing schema failed", "schema_id", schemaID, "err", err)
 				continue
 			}
 
-			messageCount++
-			createdTime := time.UnixMilli(user.CreatedAt)
-
-			log.Printf("📨 Message %d | Partition: %d, Offset: %d | Schema ID: %d\n",
-				messageCount,
-				msg.TopicPartition.Partition,
-				msg.TopicPartition.Offset,
-				schemaID)
-			log.Printf("   User ID: %d\n", user.ID)
-			log.Printf("   Username: %s\n", user.Username)
-			log.Printf("   Email: %s\n", user.Email)
-			log.Printf("   Created: %s\n", createdTime.Format(time.RFC3339))
-			if user.Phone != nil {
-				log.Printf("   Phone: %s\n", *user.Phone)
-			} else {
-				log.Printf("   Phone: <not set>\n")
+			recordSchema, ok := parsedSchema.(*hamba.RecordSchema)
+			if !ok {
+				msgLogger.Error("schema is not a record schema", "schema_id", schemaID)
+				continue
 			}
-			log.Println("   " + strings.Repeat("-", 50))
+
+			schemaCache[schemaID] = recordSchema
+			msgLogger.Info("cached schema", "schema_id", schemaID, "fields", len(recordSchema.Fields()))
+			avroSchema = recordSchema
+		}
+
+		// Deserialize the Avro payload
+		var user UserV2
+		err = hamba.Unmarshal(avroSchema, avroPayload, &user)
+		if err != nil {
+			msgLogger.Error("unmarshaling Avro data failed", "schema_id", schemaID, "err", err)
+			continue
 		}
+
+		messageCount++
+		createdTime := time.UnixMilli(user.CreatedAt)
+
+		phone := "<not set>"
+		if user.Phone != nil {
+			phone = *user.Phone
+		}
+		msgLogger.Info("consumed user", "number", messageCount, "schema_id", schemaID, "user_id", user.ID,
+			"username", user.Username, "email", user.Email, "created", createdTime.Format(time.RFC3339), "phone", phone)
 	}
+
+	logger.Info("consumer stopped", "consumed", messageCount)
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -2,11 +2,15 @@ package main
 
 import (
 	"encoding/binary"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
+	"confluentlog"
+	"kafkaobs"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
 	hamba "github.com/hamba/avro/v2"
@@ -21,38 +25,55 @@ type UserV2 struct {
 }
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("producer failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("schema-producer-v2")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
 	// Configuration
 	brokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	schemaRegistryURL := getEnv("SCHEMA_REGISTRY_URL", "http://localhost:8081")
 	topic := "users"
 
 	// Create Kafka producer
-	producer, err := kafka.NewProducer(&kafka.ConfigMap{
+	config := kafka.ConfigMap{
 		"bootstrap.servers": brokers,
 		"client.id":         "user-producer-v2",
 		"acks":              "all",
-	})
+	}
+	confluentlog.Configure(logger, config)
+	producer, err := kafka.NewProducer(&config)
 	if err != nil {
-		log.Fatalf("Failed to create producer: %v", err)
+		return fmt.Errorf("creating producer: %w", err)
 	}
 	defer producer.Close()
 
 	// Create Schema Registry client
 	client, err := schemaregistry.NewClient(schemaregistry.NewConfig(schemaRegistryURL))
 	if err != nil {
-		log.Fatalf("Failed to create schema registry client: %v", err)
+		return fmt.Errorf("creating schema registry client: %w", err)
 	}
 
 	// Read schema v2
 	schemaBytes, err := os.ReadFile("../../schemas/user-v2.avsc")
 	if err != nil {
-		log.Fatalf("Failed to read schema file: %v", err)
+		return fmt.Errorf("reading schema file: %w", err)
 	}
 
 	// Parse schema using hamba/avro
 	avroSchema, err := hamba.Parse(string(schemaBytes))
 	if err != nil {
-		log.Fatalf("Failed to parse schema: %v", err)
+		return fmt.Errorf("parsing schema: %w", err)
 	}
 
 	// Register schema with Schema Registry
@@ -66,12 +87,12 @@ func main() {
 		// Try to get existing schema
 		schema, err2 := client.GetLatestSchemaMetadata(topic + "-value")
 		if err2 != nil {
-			log.Fatalf("Failed to register or get schema: register error: %v, get error: %v", err, err2)
+			return fmt.Errorf("registering schema: %w, getting the latest: %w", err, err2)
 		}
 		schemaID = schema.ID
-		log.Printf("Using existing schema ID: %d\n", schemaID)
+		logger.Info("using existing schema", "subject", topic+"-value", "schema_id", schemaID)
 	} else {
-		log.Printf("Registered new schema with ID: %d\n", schemaID)
+		logger.Info("registered new schema", "subject", topic+"-value", "schema_id", schemaID)
 	}
 
 	// Sample users to produce with phone numbers
@@ -90,12 +111,9 @@ func main() {
 			switch ev := e.(type) {
 			case *kafka.Message:
 				if ev.TopicPartition.Error != nil {
-					log.Printf("Failed to deliver message: %v\n", ev.TopicPartition.Error)
+					confluentlog.Message(logger, ev).Error("delivery failed", "err", ev.TopicPartition.Error)
 				} else {
-					log.Printf("Delivered message to %v [partition %d] at offset %v\n",
-						*ev.TopicPartition.Topic,
-						ev.TopicPartition.Partition,
-						ev.TopicPartition.Offset)
+					confluentlog.Message(logger, ev).Info("delivered message")
 				}
 			}
 		}
@@ -106,7 +124,7 @@ func main() {
 		// Serialize using hamba/avro
 		avroBytes, err := hamba.Marshal(avroSchema, user)
 		if err != nil {
-			log.Printf("Failed to marshal user %s: %v\n", user.Username, err)
+			logger.Error("marshaling user failed", "username", user.Username, "err", err)
 			continue
 		}
 
@@ -124,22 +142,25 @@ func main() {
 		}, nil)
 
 		if err != nil {
-			log.Printf("Failed to produce message: %v\n", err)
+			logger.Error("producing user failed", "username", user.Username, "err", err)
 			continue
 		}
 
-		phoneStr := "none"
+		phone := "none"
 		if user.Phone != nil {
-			phoneStr = *user.Phone
+			phone = *user.Phone
 		}
-		log.Printf("Produced user: %s (%s) - phone: %s\n", user.Username, phoneStr)
+		logger.Info("produced user", "user_id", user.ID, "username", user.Username, "phone", phone)
 		time.Sleep(500 * time.Millisecond)
 	}
 
 	// Wait for all messages to be delivered
-	log.Println("Flushing remaining messages...")
-	producer.Flush(15 * 1000)
-	log.Println("All messages sent!")
+	logger.Info("flushing remaining messages")
+	if remaining := producer.Flush(15 * 1000); remaining > 0 {
+		return fmt.Errorf("%d messages were not delivered", remaining)
+	}
+	logger.Info("all messages sent")
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
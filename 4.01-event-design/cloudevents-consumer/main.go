@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"events"
+	"kafkaclient"
+	"kafkaobs"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("consumer stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("cloudevents-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
+	if err := app.Start(ctx, ":9307"); err != nil {
+		return err
+	}
+	metrics := app.Metrics
+	valid := metrics.Counter("events_valid_total", "Records that are valid CloudEvents")
+	invalid := metrics.Counter("events_invalid_total", "CloudEvents that failed validation")
+	skipped := metrics.Counter("events_skipped_total", "Records that are not CloudEvents")
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, app.Opts()...)
+	client, err := kgo.NewClient(append(append(opts, metrics.GroupOpts()...),
+		kgo.ConsumerGroup("cloudevents-consumer"),
+		kgo.ConsumeTopics("events"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)...)
+	if err != nil {
+		return fmt.Errorf("error creating client: %w", err)
+	}
+	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
+
+	logger.Info("consuming CloudEvents", "topic", "events", "brokers", cfg.String())
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if errs := fetches.Errors(); len(errs) > 0 {
+			return fmt.Errorf("fetch errors: %v", errs)
+		}
+
+		iter := fetches.RecordIter()
+		for !iter.Done() {
+			record := iter.Next()
+			recordLogger := kafkaobs.Record(logger, record)
+
+			env, mode, err := events.FromRecord(record)
+			if errors.Is(err, events.ErrNotCloudEvent) {
+				skipped.Inc()
+				recordLogger.Info("skipping record that is not a CloudEvent")
+				continue
+			}
+			if err != nil {
+				invalid.Inc()
+				recordLogger.Warn("invalid event", "mode", mode, "err", err)
+				continue
+			}
+			valid.Inc()
+
+			attrs := []any{"mode", mode, "type", env.EventType, "version", env.EventVersion,
+				"id", env.EventID, "event_time", env.EventTimestamp}
+			if env.Source != nil {
+				attrs = append(attrs, "source", *env.Source)
+			}
+			if env.CorrelationID != nil {
+				attrs = append(attrs, "correlation_id", *env.CorrelationID)
+			}
+			recordLogger.Info("received event", append(attrs, "payload", env.Payload)...)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"events"
+	"kafkaclient"
+	"kafkaobs"
+
+	"github.com/google/uuid"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("producer stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("cloudevents-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	// The producer sends its events and exits, it serves no endpoint
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	opts, err := kafkaclient.Options(ctx, "localhost:9092")
+	if err != nil {
+		return err
+	}
+	client, err := kgo.NewClient(append(append(opts, app.Opts()...),
+		kgo.AllowAutoTopicCreation(),
+	)...)
+	if err != nil {
+		return fmt.Errorf("error creating client: %w", err)
+	}
+	defer client.Close()
+
+	topic := "events"
+
+	modes := []events.Mode{events.ModeBinary, events.ModeStructured}
+	if mode := os.Getenv("CE_MODE"); mode != "" {
+		switch mode {
+		case "binary":
+			modes = []events.Mode{events.ModeBinary}
+		case "structured":
+			modes = []events.Mode{events.ModeStructured}
+		default:
+			return fmt.Errorf("unknown CE_MODE %q, expected binary or structured", mode)
+		}
+	}
+
+	// The same envelope is emitted once per content mode
+	orderID := "order-" + uuid.NewString()[:8]
+	env := &events.EventEnvelope{
+		EventType:      "OrderCreated",
+		EventVersion:   "1.0.0",
+		EventID:        uuid.NewString(),
+		EventTimestamp: time.Now().UTC().Format(time.RFC3339),
+		CorrelationID:  events.StringPtr("api-request-" + uuid.NewString()[:8]),
+		Source:         events.StringPtr("/services/order-service"),
+		Payload:        fmt.Sprintf(`{"orderId": %q, "customerId": "customer-456", "totalAmount": 149.99, "currency": "USD"}`, orderID),
+	}
+
+	for _, mode := range modes {
+		record, err := events.ToRecord(topic, []byte(orderID), env, mode)
+		if err != nil {
+			return fmt.Errorf("encoding %s mode event: %w", mode, err)
+		}
+
+		if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
+			return fmt.Errorf("producing %s mode event: %w", mode, err)
+		}
+
+		kafkaobs.Record(app.Logger, record).Info("sent event", "type", env.EventType, "id", env.EventID, "mode", mode)
+	}
+
+	return nil
+}
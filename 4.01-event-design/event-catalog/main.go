@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"kafkaclient"
+	"kafkaobs"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("event-catalog failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("event-catalog")
+	app.BindFlags(flag.CommandLine)
+	schemaDirs := flag.String("schemas", "../..", "comma-separated directories to scan for *.avsc files")
+	brokers := flag.String("brokers", "", "comma-separated seed brokers, sample topics when set (e.g. localhost:9092), TLS and SASL come from the KAFKA_* variables")
+	topics := flag.String("topics", "", "comma-separated topics to sample, defaults to all non-internal topics")
+	samples := flag.Int64("samples", 100, "number of most recent records to sample per partition")
+	registry := flag.String("schema-registry", "", "Schema Registry URL used to name Avro records (e.g. http://localhost:8081)")
+	format := flag.String("format", "markdown", "output format: markdown or html")
+	out := flag.String("out", "", "output file, defaults to stdout")
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	if *format != "markdown" && *format != "html" {
+		return fmt.Errorf("unknown format %q, expected markdown or html", *format)
+	}
+
+	schemas, err := scanSchemas(logger, splitList(*schemaDirs))
+	if err != nil {
+		return err
+	}
+	logger.Info("scanned schema files", "event_types", len(schemas))
+
+	var sampled *SampleResult
+	if *brokers != "" {
+		ctx := context.Background()
+		// The flag wins over KAFKA_BROKERS, the rest of the connection comes from kafkaclient
+		cfg, err := kafkaclient.Load(splitList(*brokers)...)
+		if err != nil {
+			return err
+		}
+		cfg.Brokers = splitList(*brokers)
+		opts, err := cfg.Opts(ctx)
+		if err != nil {
+			return err
+		}
+		sampled, err = sampleTopics(ctx, logger, append(opts, app.Opts()...), splitList(*topics), *samples, *registry)
+		if err != nil {
+			return fmt.Errorf("sampling topics: %w", err)
+		}
+		logger.Info("sampled topics", "topics", len(sampled.Topics), "event_types", len(sampled.Events))
+	}
+
+	catalog := buildCatalog(schemas, sampled)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "html" {
+		err = renderHTML(w, catalog)
+	} else {
+		err = renderMarkdown(w, catalog)
+	}
+	if err != nil {
+		return fmt.Errorf("rendering catalog: %w", err)
+	}
+
+	if *out != "" {
+		logger.Info("wrote catalog", "file", *out, "format", *format)
+	}
+
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Catalog is the model both output formats are rendered from
+type Catalog struct {
+	Generated string
+	Sampled   bool
+	Events    []EventEntry
+	Topics    []TopicEntry
+}
+
+// EventEntry describes one event type, from its schema files and/or sampled records
+type EventEntry struct {
+	Name      string
+	Anchor    string
+	Doc       string
+	HasSchema bool
+	Fields    []Field
+	Versions  []VersionEntry
+
+	Observed         bool
+	ObservedVersions []string
+	ObservedFields   []string
+	Sources          []string
+	Topics           []string
+	Count            int
+	LastSeen         string
+}
+
+// VersionEntry is a schema file and how it changed compared to the previous version
+type VersionEntry struct {
+	Version string
+	File    string
+	Changes []string
+}
+
+// TopicEntry answers "which events are on this topic?"
+type TopicEntry struct {
+	Name         string
+	Anchor       string
+	Events       []string
+	Unclassified int
+}
+
+func buildCatalog(schemas map[string][]SchemaVersion, samples *SampleResult) *Catalog {
+	catalog := &Catalog{
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Sampled:   samples != nil,
+	}
+
+	names := make(map[string]bool)
+	for name := range schemas {
+		names[name] = true
+	}
+	if samples != nil {
+		for name := range samples.Events {
+			names[name] = true
+		}
+	}
+
+	topicEvents := make(map[string][]string)
+	for _, name := range sortedKeys(names) {
+		entry := EventEntry{
+			Name:   name,
+			Anchor: "event-" + anchor(name),
+		}
+
+		if versions := schemas[name]; len(versions) > 0 {
+			latest := versions[len(versions)-1]
+			entry.HasSchema = true
+			entry.Doc = latest.Doc
+			entry.Fields = latest.Fields
+
+			// Variants such as user-incompatible.avsc are listed but never used as
+			// the base for the next version's changes
+			var prev *SchemaVersion
+			for i, v := range versions {
+				version := VersionEntry{Version: v.Version, File: v.File}
+				if prev != nil && path.Dir(prev.File) == path.Dir(v.File) {
+					version.Changes = fieldChanges(*prev, v)
+				}
+				if !strings.Contains(v.Version, "-") {
+					prev = &versions[i]
+				}
+				entry.Versions = append(entry.Versions, version)
+			}
+		}
+
+		if samples != nil {
+			if obs, ok := samples.Events[name]; ok {
+				entry.Observed = true
+				entry.ObservedVersions = sortedKeys(obs.Versions)
+				entry.ObservedFields = sortedKeys(obs.Fields)
+				entry.Sources = sortedKeys(obs.Sources)
+				entry.Topics = sortedKeys(obs.Topics)
+				entry.Count = obs.Count
+				if !obs.LastSeen.IsZero() {
+					entry.LastSeen = obs.LastSeen.UTC().Format(time.RFC3339)
+				}
+
+				for _, topic := range entry.Topics {
+					topicEvents[topic] = append(topicEvents[topic], name)
+				}
+			}
+		}
+
+		catalog.Events = append(catalog.Events, entry)
+	}
+
+	if samples != nil {
+		for _, topic := range samples.Topics {
+			catalog.Topics = append(catalog.Topics, TopicEntry{
+				Name:         topic,
+				Anchor:       "topic-" + anchor(topic),
+				Events:       topicEvents[topic],
+				Unclassified: samples.Unclassified[topic],
+			})
+		}
+	}
+
+	return catalog
+}
+
+func renderMarkdown(w io.Writer, catalog *Catalog) error {
+	return markdownTemplate.Execute(w, catalog)
+}
+
+func renderHTML(w io.Writer, catalog *Catalog) error {
+	return htmlTemplate.Execute(w, catalog)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func anchor(name string) string {
+	return strings.ToLower(strings.NewReplacer(".", "-", "_", "-", " ", "-").Replace(name))
+}
+
+var funcs = map[string]any{
+	"join": strings.Join,
+	// cell keeps Markdown tables intact when a value contains a pipe
+	"cell":   func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+	"anchor": anchor,
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(funcs).Parse(`# Event Catalog
+
+_Generated {{.Generated}}{{if not .Sampled}} from schema files only, run with -brokers to include topics and producers{{end}}._
+
+## Event Types
+
+| Event | Schema versions | Producers | Topics |
+|-------|-----------------|-----------|--------|
+{{- range .Events}}
+| [{{.Name}}](#{{.Anchor}}) | {{len .Versions}} | {{join .Sources ", "}} | {{join .Topics ", "}} |
+{{- end}}
+{{if .Topics}}
+## Topics
+
+| Topic | Event types | Unclassified records |
+|-------|-------------|----------------------|
+{{- range .Topics}}
+| <a id="{{.Anchor}}"></a>{{.Name}} | {{range $i, $e := .Events}}{{if $i}}, {{end}}[{{$e}}](#event-{{anchor $e}}){{end}} | {{.Unclassified}} |
+{{- end}}
+{{end}}
+{{- range .Events}}
+---
+
+<a id="{{.Anchor}}"></a>
+## {{.Name}}
+{{if .Doc}}
+{{.Doc}}
+{{end}}
+{{- if .HasSchema}}
+### Fields (latest version)
+
+| Field | Type | Default | Description |
+|-------|------|---------|-------------|
+{{- range .Fields}}
+| ` + "`{{.Name}}`" + ` | {{cell .Type}} | {{cell .Default}} | {{cell .Doc}} |
+{{- end}}
+
+### Versions
+{{range .Versions}}
+- **{{.Version}}** — ` + "`{{.File}}`" + `{{if .Changes}}: {{join .Changes "; "}}{{end}}
+{{- end}}
+{{else}}
+_No schema file found for this event type._
+{{end}}
+{{- if .Observed}}
+### Observed on Kafka
+
+- **Topics:** {{join .Topics ", "}}
+- **Producers (source):** {{if .Sources}}{{join .Sources ", "}}{{else}}unknown{{end}}
+- **Versions:** {{if .ObservedVersions}}{{join .ObservedVersions ", "}}{{else}}unknown{{end}}
+- **Fields:** {{join .ObservedFields ", "}}
+- **Sampled records:** {{.Count}}{{if .LastSeen}}, last seen {{.LastSeen}}{{end}}
+{{end}}
+{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Event Catalog</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2rem auto; max-width: 1100px; padding: 0 1rem; color: #222; }
+  table { border-collapse: collapse; width: 100%; margin-bottom: 1.5rem; }
+  th, td { border: 1px solid #ddd; padding: 0.4rem 0.6rem; text-align: left; vertical-align: top; }
+  th { background: #f4f6f8; }
+  code { background: #f4f6f8; padding: 0 0.2rem; }
+  section { border-top: 1px solid #ddd; margin-top: 2rem; }
+  .muted { color: #777; }
+  #filter { width: 100%; padding: 0.5rem; font-size: 1rem; margin-bottom: 1rem; }
+</style>
+</head>
+<body>
+<h1>Event Catalog</h1>
+<p class="muted">Generated {{.Generated}}{{if not .Sampled}} from schema files only, run with -brokers to include topics and producers{{end}}.</p>
+
+<input id="filter" placeholder="Filter event types and topics, e.g. OrderShipped" oninput="filter(this.value)">
+
+<h2>Event Types</h2>
+<table id="events">
+<tr><th>Event</th><th>Schema versions</th><th>Producers</th><th>Topics</th></tr>
+{{- range .Events}}
+<tr><td><a href="#{{.Anchor}}">{{.Name}}</a></td><td>{{len .Versions}}</td><td>{{join .Sources ", "}}</td><td>{{range $i, $t := .Topics}}{{if $i}}, {{end}}<a href="#topic-{{anchor $t}}">{{$t}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+{{if .Topics}}
+<h2>Topics</h2>
+<table id="topics">
+<tr><th>Topic</th><th>Event types</th><th>Unclassified records</th></tr>
+{{- range .Topics}}
+<tr id="{{.Anchor}}"><td>{{.Name}}</td><td>{{range $i, $e := .Events}}{{if $i}}, {{end}}<a href="#event-{{anchor $e}}">{{$e}}</a>{{end}}</td><td>{{.Unclassified}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- range .Events}}
+<section id="{{.Anchor}}">
+<h2>{{.Name}}</h2>
+{{if .Doc}}<p>{{.Doc}}</p>{{end}}
+{{if .HasSchema}}
+<h3>Fields (latest version)</h3>
+<table>
+<tr><th>Field</th><th>Type</th><th>Default</th><th>Description</th></tr>
+{{- range .Fields}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{.Default}}</td><td>{{.Doc}}</td></tr>
+{{- end}}
+</table>
+<h3>Versions</h3>
+<ul>
+{{- range .Versions}}
+<li><strong>{{.Version}}</strong> — <code>{{.File}}</code>{{if .Changes}}: {{join .Changes "; "}}{{end}}</li>
+{{- end}}
+</ul>
+{{else}}
+<p class="muted">No schema file found for this event type.</p>
+{{end}}
+{{if .Observed}}
+<h3>Observed on Kafka</h3>
+<ul>
+<li><strong>Topics:</strong> {{join .Topics ", "}}</li>
+<li><strong>Producers (source):</strong> {{if .Sources}}{{join .Sources ", "}}{{else}}unknown{{end}}</li>
+<li><strong>Versions:</strong> {{if .ObservedVersions}}{{join .ObservedVersions ", "}}{{else}}unknown{{end}}</li>
+<li><strong>Fields:</strong> {{join .ObservedFields ", "}}</li>
+<li><strong>Sampled records:</strong> {{.Count}}{{if .LastSeen}}, last seen {{.LastSeen}}{{end}}</li>
+</ul>
+{{end}}
+</section>
+{{- end}}
+
+<script>
+function filter(query) {
+  query = query.toLowerCase();
+  for (const table of document.querySelectorAll("#events, #topics")) {
+    for (const row of Array.from(table.rows).slice(1)) {
+      row.style.display = row.textContent.toLowerCase().includes(query) ? "" : "none";
+    }
+  }
+}
+</script>
+</body>
+</html>
+`))
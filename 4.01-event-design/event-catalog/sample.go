@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"events"
+
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// envelopeFields are the metadata fields of a JSON event, everything else is business data
+var envelopeFields = map[string]bool{
+	"eventType":      true,
+	"eventVersion":   true,
+	"eventId":        true,
+	"eventTimestamp": true,
+	"correlationId":  true,
+	"causationId":    true,
+	"source":         true,
+	"metadata":       true,
+	"payload":        true,
+}
+
+// Observation is what was learned about an event type from sampled records
+type Observation struct {
+	Versions map[string]bool
+	Sources  map[string]bool
+	Topics   map[string]bool
+	Fields   map[string]bool
+	Count    int
+	LastSeen time.Time
+}
+
+// SampleResult holds the observations per event type and the topics that were sampled
+type SampleResult struct {
+	Events map[string]*Observation
+	// Unclassified counts records per topic that did not look like an event
+	Unclassified map[string]int
+	Topics       []string
+}
+
+type sampler struct {
+	registryURL string
+	schemaNames map[int]string
+	result      *SampleResult
+}
+
+// sampleTopics reads up to perPartition of the most recent records of every
+// partition and classifies them. Without explicit topics all non-internal topics are sampled.
+func sampleTopics(ctx context.Context, logger *slog.Logger, opts []kgo.Opt, topics []string, perPartition int64, registryURL string) (*SampleResult, error) {
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	defer client.Close()
+
+	admin := kadm.NewClient(client)
+
+	details, err := admin.ListTopics(ctx, topics...)
+	if err != nil {
+		return nil, fmt.Errorf("listing topics: %w", err)
+	}
+
+	ends, err := admin.ListEndOffsets(ctx, details.Names()...)
+	if err != nil {
+		return nil, fmt.Errorf("listing end offsets: %w", err)
+	}
+	starts, err := admin.ListStartOffsets(ctx, details.Names()...)
+	if err != nil {
+		return nil, fmt.Errorf("listing start offsets: %w", err)
+	}
+
+	s := &sampler{
+		registryURL: strings.TrimSuffix(registryURL, "/"),
+		schemaNames: make(map[int]string),
+		result: &SampleResult{
+			Events:       make(map[string]*Observation),
+			Unclassified: make(map[string]int),
+		},
+	}
+
+	// Start every partition perPartition records before its end
+	offsets := make(map[string]map[int32]kgo.Offset)
+	remaining := 0
+	ends.Each(func(end kadm.ListedOffset) {
+		if end.Err != nil || details[end.Topic].IsInternal {
+			return
+		}
+		start, _ := starts.Lookup(end.Topic, end.Partition)
+		from := max(end.Offset-perPartition, start.Offset)
+		if from >= end.Offset {
+			return
+		}
+		if offsets[end.Topic] == nil {
+			offsets[end.Topic] = make(map[int32]kgo.Offset)
+		}
+		offsets[end.Topic][end.Partition] = kgo.NewOffset().At(from)
+		remaining += int(end.Offset - from)
+	})
+
+	for topic := range details {
+		if !details[topic].IsInternal {
+			s.result.Topics = append(s.result.Topics, topic)
+		}
+	}
+	sort.Strings(s.result.Topics)
+
+	if remaining == 0 {
+		return s.result, nil
+	}
+
+	consumer, err := kgo.NewClient(append(opts,
+		kgo.ConsumePartitions(offsets),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("creating consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	// Compacted topics may have fewer records than the offsets suggest,
+	// so stop when nothing arrives for a while.
+	for remaining > 0 {
+		pollCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		fetches := consumer.PollFetches(pollCtx)
+		cancel()
+
+		if errors.Is(fetches.Err0(), context.DeadlineExceeded) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		fetches.EachError(func(topic string, partition int32, err error) {
+			logger.Warn("fetch failed", "topic", topic, "partition", partition, "err", err)
+		})
+
+		fetches.EachRecord(func(record *kgo.Record) {
+			remaining--
+			s.classify(ctx, record)
+		})
+	}
+
+	return s.result, nil
+}
+
+// classify recognizes CloudEvents, Schema Registry framed Avro and JSON envelopes
+func (s *sampler) classify(ctx context.Context, record *kgo.Record) {
+	if env, _, err := events.FromRecord(record); err == nil {
+		s.observe(record, env.EventType, env.EventVersion, deref(env.Source), payloadFields(env.Payload))
+		return
+	}
+
+	if len(record.Value) > 5 && record.Value[0] == 0 && s.registryURL != "" {
+		id := int(binary.BigEndian.Uint32(record.Value[1:5]))
+		if name, err := s.schemaName(ctx, id); err == nil {
+			s.observe(record, name, fmt.Sprintf("schema id %d", id), "", nil)
+			return
+		}
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(record.Value, &body); err == nil {
+		eventType := jsonString(body["eventType"])
+		if eventType != "" {
+			source := jsonString(body["source"])
+			if source == "" {
+				var metadata map[string]json.RawMessage
+				if json.Unmarshal(body["metadata"], &metadata) == nil {
+					source = jsonString(metadata["source"])
+				}
+			}
+
+			fields := make([]string, 0, len(body))
+			for name := range body {
+				if !envelopeFields[name] {
+					fields = append(fields, name)
+				}
+			}
+			fields = append(fields, payloadFields(jsonString(body["payload"]))...)
+
+			s.observe(record, eventType, jsonString(body["eventVersion"]), source, fields)
+			return
+		}
+	}
+
+	s.result.Unclassified[record.Topic]++
+}
+
+func (s *sampler) observe(record *kgo.Record, eventType, version, source string, fields []string) {
+	obs, ok := s.result.Events[eventType]
+	if !ok {
+		obs = &Observation{
+			Versions: make(map[string]bool),
+			Sources:  make(map[string]bool),
+			Topics:   make(map[string]bool),
+			Fields:   make(map[string]bool),
+		}
+		s.result.Events[eventType] = obs
+	}
+
+	obs.Count++
+	obs.Topics[record.Topic] = true
+	if version != "" {
+		obs.Versions[version] = true
+	}
+	if source != "" {
+		obs.Sources[source] = true
+	}
+	for _, f := range fields {
+		obs.Fields[f] = true
+	}
+	if record.Timestamp.After(obs.LastSeen) {
+		obs.LastSeen = record.Timestamp
+	}
+}
+
+// schemaName resolves a Schema Registry ID to the record name of its schema
+func (s *sampler) schemaName(ctx context.Context, id int) (string, error) {
+	if name, ok := s.schemaNames[id]; ok {
+		return name, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", s.registryURL, id), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("schema registry returned %s", res.Status)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	schema, err := avro.ParseWithCache(body.Schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return "", err
+	}
+
+	named, ok := schema.(avro.NamedSchema)
+	if !ok {
+		return "", fmt.Errorf("schema %d is not a named type", id)
+	}
+
+	s.schemaNames[id] = named.Name()
+	return named.Name(), nil
+}
+
+// payloadFields returns the top-level keys of a JSON-encoded payload
+func payloadFields(payload string) []string {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		return nil
+	}
+
+	fields := make([]string, 0, len(body))
+	for name := range body {
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+func jsonString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
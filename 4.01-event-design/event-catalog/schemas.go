@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+)
+
+// versionPattern picks the version out of file names such as user-v2.avsc
+var versionPattern = regexp.MustCompile(`-v(\d+)\.avsc$`)
+
+// SchemaVersion is a single .avsc file describing an event type
+type SchemaVersion struct {
+	Version string
+	File    string
+	Doc     string
+	Fields  []Field
+}
+
+// Field is a record field as shown in the catalog
+type Field struct {
+	Name    string
+	Type    string
+	Default string
+	Doc     string
+}
+
+// scanSchemas walks the given directories and parses every *.avsc file.
+// The result is keyed by the record name, versions are sorted oldest first.
+func scanSchemas(logger *slog.Logger, dirs []string) (map[string][]SchemaVersion, error) {
+	schemas := make(map[string][]SchemaVersion)
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if strings.HasPrefix(d.Name(), ".") && file != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(file) != ".avsc" {
+				return nil
+			}
+
+			name, version, err := parseSchemaFile(file)
+			if err != nil {
+				logger.Warn("skipping schema file", "file", file, "err", err)
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				rel = file
+			}
+			version.File = filepath.ToSlash(rel)
+
+			schemas[name] = append(schemas[name], version)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", dir, err)
+		}
+	}
+
+	// Versions of the same record are grouped per directory, so the changes
+	// between consecutive versions are only computed within one exercise
+	for _, versions := range schemas {
+		sort.SliceStable(versions, func(i, j int) bool {
+			di, dj := path.Dir(versions[i].File), path.Dir(versions[j].File)
+			if di != dj {
+				return di < dj
+			}
+			return versionLess(versions[i].Version, versions[j].Version)
+		})
+	}
+
+	return schemas, nil
+}
+
+func parseSchemaFile(file string) (string, SchemaVersion, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return "", SchemaVersion{}, err
+	}
+
+	// Every file gets its own cache, different versions share the same record name
+	schema, err := avro.ParseBytesWithCache(raw, "", &avro.SchemaCache{})
+	if err != nil {
+		return "", SchemaVersion{}, fmt.Errorf("parsing schema: %w", err)
+	}
+
+	record, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return "", SchemaVersion{}, fmt.Errorf("top-level schema is a %s, not a record", schema.Type())
+	}
+
+	version := SchemaVersion{
+		Version: strings.TrimSuffix(filepath.Base(file), ".avsc"),
+		Doc:     record.Doc(),
+	}
+	if match := versionPattern.FindStringSubmatch(filepath.Base(file)); match != nil {
+		version.Version = "v" + match[1]
+	}
+
+	for _, f := range record.Fields() {
+		field := Field{
+			Name: f.Name(),
+			Type: typeString(f.Type()),
+			Doc:  f.Doc(),
+		}
+		if f.HasDefault() {
+			def, _ := json.Marshal(f.Default())
+			field.Default = string(def)
+		}
+		version.Fields = append(version.Fields, field)
+	}
+
+	return record.Name(), version, nil
+}
+
+// typeString renders an Avro type the way it is written in the schema file
+func typeString(schema avro.Schema) string {
+	switch s := schema.(type) {
+	case *avro.PrimitiveSchema:
+		if s.Logical() != nil {
+			return fmt.Sprintf("%s (%s)", s.Type(), s.Logical().Type())
+		}
+		return string(s.Type())
+	case *avro.UnionSchema:
+		types := make([]string, 0, len(s.Types()))
+		for _, t := range s.Types() {
+			types = append(types, typeString(t))
+		}
+		return strings.Join(types, " | ")
+	case *avro.ArraySchema:
+		return "array<" + typeString(s.Items()) + ">"
+	case *avro.MapSchema:
+		return "map<" + typeString(s.Values()) + ">"
+	case *avro.EnumSchema:
+		return fmt.Sprintf("enum %s {%s}", s.Name(), strings.Join(s.Symbols(), ", "))
+	case avro.NamedSchema:
+		return s.Name()
+	case *avro.RefSchema:
+		return s.Schema().Name()
+	default:
+		return string(schema.Type())
+	}
+}
+
+// versionLess orders "v2" before "v10", unnumbered files sort first
+func versionLess(a, b string) bool {
+	var na, nb int
+	fmt.Sscanf(a, "v%d", &na)
+	fmt.Sscanf(b, "v%d", &nb)
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// fieldChanges describes how a version differs from the previous one
+func fieldChanges(prev, next SchemaVersion) []string {
+	before := make(map[string]Field, len(prev.Fields))
+	for _, f := range prev.Fields {
+		before[f.Name] = f
+	}
+
+	var changes []string
+	after := make(map[string]bool, len(next.Fields))
+	for _, f := range next.Fields {
+		after[f.Name] = true
+		old, ok := before[f.Name]
+		switch {
+		case !ok:
+			changes = append(changes, "added "+f.Name)
+		case old.Type != f.Type:
+			changes = append(changes, fmt.Sprintf("changed %s from %s to %s", f.Name, old.Type, f.Type))
+		case old.Default != f.Default:
+			changes = append(changes, "changed default of "+f.Name)
+		}
+	}
+	for _, f := range prev.Fields {
+		if !after[f.Name] {
+			changes = append(changes, "removed "+f.Name)
+		}
+	}
+
+	return changes
+}
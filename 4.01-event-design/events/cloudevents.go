@@ -0,0 +1,291 @@
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Mode selects how a CloudEvent is laid out on a Kafka record, see
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md
+type Mode int
+
+const (
+	// ModeBinary puts the attributes in ce_ headers and the payload in the record value
+	ModeBinary Mode = iota
+	// ModeStructured puts the whole event, attributes and data, in a JSON record value
+	ModeStructured
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeBinary:
+		return "binary"
+	case ModeStructured:
+		return "structured"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+const (
+	SpecVersion = "1.0"
+
+	// StructuredContentType is the content-type header value of a structured mode record
+	StructuredContentType = "application/cloudevents+json; charset=UTF-8"
+	// DataContentType is the content type of the envelope payload
+	DataContentType = "application/json"
+
+	headerPrefix      = "ce_"
+	headerContentType = "content-type"
+
+	// Envelope fields without a CloudEvents counterpart travel as extension
+	// attributes. Extension names must be lower-case alphanumeric.
+	extEventVersion  = "eventversion"
+	extCorrelationID = "correlationid"
+	extCausationID   = "causationid"
+)
+
+// ErrNotCloudEvent is returned when a record is neither a binary nor a structured mode CloudEvent
+var ErrNotCloudEvent = errors.New("record is not a CloudEvent")
+
+// structuredEvent is the JSON event format used in structured mode
+type structuredEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	EventVersion    string          `json:"eventversion,omitempty"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	CausationID     string          `json:"causationid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// ToRecord encodes the envelope as a CloudEvent on a Kafka record using the given mode.
+// The CloudEvents source attribute is required, so the envelope must carry a source.
+func ToRecord(topic string, key []byte, env *EventEnvelope, mode Mode) (*kgo.Record, error) {
+	if err := env.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if env.Source == nil || *env.Source == "" {
+		return nil, fmt.Errorf("invalid envelope: source is required for CloudEvents")
+	}
+
+	timestamp, _ := time.Parse(time.RFC3339, env.EventTimestamp)
+	record := &kgo.Record{
+		Topic:     topic,
+		Key:       key,
+		Timestamp: timestamp,
+	}
+
+	switch mode {
+	case ModeBinary:
+		attributes := map[string]string{
+			"specversion":    SpecVersion,
+			"id":             env.EventID,
+			"source":         *env.Source,
+			"type":           env.EventType,
+			"time":           env.EventTimestamp,
+			extEventVersion:  env.EventVersion,
+			extCorrelationID: deref(env.CorrelationID),
+			extCausationID:   deref(env.CausationID),
+		}
+		for _, name := range []string{"specversion", "id", "source", "type", "time", extEventVersion, extCorrelationID, extCausationID} {
+			if attributes[name] == "" {
+				continue
+			}
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: headerPrefix + name, Value: []byte(attributes[name])})
+		}
+
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: headerContentType, Value: []byte(DataContentType)})
+		record.Value = []byte(env.Payload)
+	case ModeStructured:
+		event := structuredEvent{
+			SpecVersion:     SpecVersion,
+			ID:              env.EventID,
+			Source:          *env.Source,
+			Type:            env.EventType,
+			Time:            env.EventTimestamp,
+			DataContentType: DataContentType,
+			EventVersion:    env.EventVersion,
+			CorrelationID:   deref(env.CorrelationID),
+			CausationID:     deref(env.CausationID),
+			Data:            json.RawMessage(env.Payload),
+		}
+
+		value, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling structured event: %w", err)
+		}
+
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: headerContentType, Value: []byte(StructuredContentType)})
+		record.Value = value
+	default:
+		return nil, fmt.Errorf("unknown mode: %v", mode)
+	}
+
+	return record, nil
+}
+
+// FromRecord decodes a CloudEvent in either content mode back into an envelope.
+// It returns the detected mode so callers can report what they received.
+func FromRecord(record *kgo.Record) (*EventEnvelope, Mode, error) {
+	contentType := header(record, headerContentType)
+	if mediaType, _, _ := mime.ParseMediaType(contentType); strings.HasPrefix(mediaType, "application/cloudevents") {
+		if mediaType != "application/cloudevents+json" {
+			return nil, ModeStructured, fmt.Errorf("unsupported event format: %s", mediaType)
+		}
+
+		env, err := fromStructured(record)
+		return env, ModeStructured, err
+	}
+
+	if header(record, headerPrefix+"specversion") != "" {
+		env, err := fromBinary(record, contentType)
+		return env, ModeBinary, err
+	}
+
+	return nil, 0, ErrNotCloudEvent
+}
+
+func fromBinary(record *kgo.Record, contentType string) (*EventEnvelope, error) {
+	if version := header(record, headerPrefix+"specversion"); version != SpecVersion {
+		return nil, fmt.Errorf("unsupported specversion: %s", version)
+	}
+
+	payload, err := jsonPayload(contentType, record.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &EventEnvelope{
+		EventType:      header(record, headerPrefix+"type"),
+		EventVersion:   header(record, headerPrefix+extEventVersion),
+		EventID:        header(record, headerPrefix+"id"),
+		EventTimestamp: header(record, headerPrefix+"time"),
+		CorrelationID:  optional(header(record, headerPrefix+extCorrelationID)),
+		CausationID:    optional(header(record, headerPrefix+extCausationID)),
+		Source:         optional(header(record, headerPrefix+"source")),
+		Payload:        payload,
+	}
+
+	return env, finish(env, record)
+}
+
+func fromStructured(record *kgo.Record) (*EventEnvelope, error) {
+	var event structuredEvent
+	if err := json.Unmarshal(record.Value, &event); err != nil {
+		return nil, fmt.Errorf("unmarshaling structured event: %w", err)
+	}
+	if event.SpecVersion != SpecVersion {
+		return nil, fmt.Errorf("unsupported specversion: %s", event.SpecVersion)
+	}
+
+	data := []byte(event.Data)
+	if event.DataBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("decoding data_base64: %w", err)
+		}
+		data = decoded
+	}
+
+	payload, err := jsonPayload(event.DataContentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &EventEnvelope{
+		EventType:      event.Type,
+		EventVersion:   event.EventVersion,
+		EventID:        event.ID,
+		EventTimestamp: event.Time,
+		CorrelationID:  optional(event.CorrelationID),
+		CausationID:    optional(event.CausationID),
+		Source:         optional(event.Source),
+		Payload:        payload,
+	}
+
+	return env, finish(env, record)
+}
+
+// finish fills in what a foreign producer may have left out and validates the result.
+// CloudEvents makes time optional, in that case the record timestamp is used, but
+// id, source and type are required.
+func finish(env *EventEnvelope, record *kgo.Record) error {
+	switch {
+	case env.EventID == "":
+		return fmt.Errorf("invalid event: id is required")
+	case env.Source == nil:
+		return fmt.Errorf("invalid event: source is required")
+	case env.EventType == "":
+		return fmt.Errorf("invalid event: type is required")
+	}
+
+	if env.EventTimestamp == "" && !record.Timestamp.IsZero() {
+		env.EventTimestamp = record.Timestamp.UTC().Format(time.RFC3339)
+	}
+	if env.EventVersion == "" {
+		env.EventVersion = "1.0.0"
+	}
+
+	if err := env.Validate(); err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+
+	return nil
+}
+
+// jsonPayload checks that the event data can be stored in the JSON-encoded envelope payload
+func jsonPayload(contentType string, data []byte) (string, error) {
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", fmt.Errorf("parsing datacontenttype: %w", err)
+		}
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			return "", fmt.Errorf("unsupported datacontenttype: %s", mediaType)
+		}
+	}
+
+	if len(data) == 0 {
+		return "", nil
+	}
+	if !json.Valid(data) {
+		return "", fmt.Errorf("event data is not valid JSON")
+	}
+
+	return string(data), nil
+}
+
+func header(record *kgo.Record, key string) string {
+	for _, h := range record.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
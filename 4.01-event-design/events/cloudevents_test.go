@@ -0,0 +1,121 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var modes = []Mode{ModeBinary, ModeStructured}
+
+func testEnvelope() *EventEnvelope {
+	return &EventEnvelope{
+		EventType:      "OrderPlaced",
+		EventVersion:   "2.1.0",
+		EventID:        "evt-1",
+		EventTimestamp: "2026-10-18T09:30:00Z",
+		CorrelationID:  StringPtr("req-1"),
+		Source:         StringPtr("/services/order-service"),
+		Payload:        `{"orderId":"order-1","total":42.5}`,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, mode := range modes {
+		env := testEnvelope()
+		record, err := ToRecord("orders", []byte("order-1"), env, mode)
+		if err != nil {
+			t.Fatalf("%s: ToRecord: %v", mode, err)
+		}
+		got, gotMode, err := FromRecord(record)
+		if err != nil {
+			t.Fatalf("%s: FromRecord: %v", mode, err)
+		}
+		if gotMode != mode {
+			t.Errorf("%s: decoded as %s", mode, gotMode)
+		}
+		// Structured mode re-encodes the data, so compare payloads as JSON
+		if !jsonEqual(t, got.Payload, env.Payload) {
+			t.Errorf("%s: payload %s, want %s", mode, got.Payload, env.Payload)
+		}
+		got.Payload = env.Payload
+		if !reflect.DeepEqual(got, env) {
+			t.Errorf("%s: decoded %+v, want %+v", mode, got, env)
+		}
+	}
+}
+
+// withoutAttribute returns the record of a foreign producer that left out an
+// attribute, in either mode
+func withoutAttribute(t *testing.T, mode Mode, name string) *kgo.Record {
+	t.Helper()
+	record, err := ToRecord("orders", []byte("order-1"), testEnvelope(), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch mode {
+	case ModeBinary:
+		record.Headers = slices.DeleteFunc(record.Headers, func(h kgo.RecordHeader) bool {
+			return h.Key == headerPrefix+name
+		})
+	case ModeStructured:
+		var event map[string]any
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		delete(event, name)
+		if record.Value, err = json.Marshal(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return record
+}
+
+func TestWithoutTime(t *testing.T) {
+	timestamp := time.Date(2026, 10, 18, 11, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	for _, mode := range modes {
+		record := withoutAttribute(t, mode, "time")
+		record.Timestamp = timestamp
+		env, _, err := FromRecord(record)
+		if err != nil {
+			t.Fatalf("%s: an event without time is rejected: %v", mode, err)
+		}
+		if env.EventTimestamp != "2026-10-18T09:00:00Z" {
+			t.Errorf("%s: eventTimestamp = %q, want the record timestamp 2026-10-18T09:00:00Z", mode, env.EventTimestamp)
+		}
+	}
+}
+
+func TestRequiredAttributes(t *testing.T) {
+	for _, mode := range modes {
+		for _, name := range []string{"id", "source", "type"} {
+			if _, _, err := FromRecord(withoutAttribute(t, mode, name)); err == nil {
+				t.Errorf("%s: accepted an event without %s", mode, name)
+			}
+		}
+	}
+}
+
+func TestNotCloudEvent(t *testing.T) {
+	record := &kgo.Record{Value: []byte(`{"eventType":"OrderPlaced"}`)}
+	if _, _, err := FromRecord(record); !errors.Is(err, ErrNotCloudEvent) {
+		t.Errorf("FromRecord of a plain JSON record: err = %v, want ErrNotCloudEvent", err)
+	}
+}
+
+func jsonEqual(t *testing.T, a, b string) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal([]byte(a), &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(b), &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
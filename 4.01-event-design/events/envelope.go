@@ -0,0 +1,49 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventEnvelope mirrors schemas/event-envelope.avsc. Metadata lives in the
+// envelope fields, the business data is carried as a JSON string in Payload.
+type EventEnvelope struct {
+	EventType      string  `avro:"eventType" json:"eventType"`
+	EventVersion   string  `avro:"eventVersion" json:"eventVersion"`
+	EventID        string  `avro:"eventId" json:"eventId"`
+	EventTimestamp string  `avro:"eventTimestamp" json:"eventTimestamp"`
+	CorrelationID  *string `avro:"correlationId" json:"correlationId,omitempty"`
+	CausationID    *string `avro:"causationId" json:"causationId,omitempty"`
+	Source         *string `avro:"source" json:"source,omitempty"`
+	Payload        string  `avro:"payload" json:"payload"`
+}
+
+// Validate checks the fields required by the envelope schema
+func (e *EventEnvelope) Validate() error {
+	switch {
+	case e.EventType == "":
+		return fmt.Errorf("eventType is required")
+	case e.EventVersion == "":
+		return fmt.Errorf("eventVersion is required")
+	case e.EventID == "":
+		return fmt.Errorf("eventId is required")
+	case e.EventTimestamp == "":
+		return fmt.Errorf("eventTimestamp is required")
+	}
+
+	if _, err := time.Parse(time.RFC3339, e.EventTimestamp); err != nil {
+		return fmt.Errorf("eventTimestamp is not ISO 8601: %w", err)
+	}
+
+	if e.Payload != "" && !json.Valid([]byte(e.Payload)) {
+		return fmt.Errorf("payload is not valid JSON")
+	}
+
+	return nil
+}
+
+// StringPtr is a helper for filling the optional envelope fields
+func StringPtr(s string) *string {
+	return &s
+}
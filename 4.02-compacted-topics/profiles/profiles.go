@@ -0,0 +1,25 @@
+// Package profiles holds the user profile of the user-profiles topic and the
+// version rule every consumer of the topic applies, so the state store and
+// the query service can't disagree about which update wins.
+package profiles
+
+import "fmt"
+
+// UserProfile is the value of a user-profiles record, keyed by user ID
+type UserProfile struct {
+	UserID  string `json:"userId"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Age     int    `json:"age"`
+	Version int    `json:"version"`
+}
+
+// CheckVersion rejects updates that do not move a profile to a newer version,
+// so a late, out-of-order record cannot overwrite newer state. It is the
+// check passed to statestore.WithCheck.
+func CheckVersion(key string, current *UserProfile, exists bool, next *UserProfile) error {
+	if exists && next.Version <= current.Version {
+		return fmt.Errorf("stale version %d for %s, store has version %d", next.Version, key, current.Version)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// keepAliveInterval keeps proxies from closing idle change feeds
+const keepAliveInterval = 15 * time.Second
+
+// handleChanges streams upserts and deletes as Server-Sent Events. Clients
+// resume with the Last-Event-ID header (or ?from=), ?key= limits the feed to
+// the given user IDs and ?snapshot=true starts with the current state.
+func (qs *QueryService) handleChanges(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var keys []string
+	for _, key := range r.URL.Query()["key"] {
+		keys = append(keys, strings.Split(key, ",")...)
+	}
+	matches := func(key string) bool {
+		return len(keys) == 0 || slices.Contains(keys, key)
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("from")
+	}
+	var from Position
+	if lastEventID != "" {
+		var err error
+		if from, err = ParsePosition(lastEventID); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	ch, backlog, current, resumed := qs.feed.Subscribe(from)
+	defer qs.feed.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// The events the client missed are no longer buffered, tell it to drop its
+	// view and send the current state instead
+	if !resumed || r.URL.Query().Get("snapshot") == "true" {
+		id := current.String()
+		if !resumed {
+			writeEvent(w, "reset", id, map[string]string{"reason": "Last-Event-ID is older than the buffered changes"})
+		}
+		for key, profile := range qs.store.All() {
+			if matches(key) && qs.router.Owns(key) {
+				writeEvent(w, "upsert", id, map[string]any{"type": "upsert", "key": key, "profile": profile, "snapshot": true})
+			}
+		}
+	}
+	for _, event := range backlog {
+		if matches(event.Key) {
+			writeEvent(w, event.Type, event.ID, event)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				// Dropped for falling behind, the client reconnects with its Last-Event-ID
+				return
+			}
+			if !matches(event.Key) {
+				continue
+			}
+			writeEvent(w, event.Type, event.ID, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event, id string, data any) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, payload)
+}
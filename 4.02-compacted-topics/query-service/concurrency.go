@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafkaobs"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Audit event types
+const (
+	// AuditPreconditionFailed is a write refused because If-Match did not
+	// match the stored version, it never reached the topic
+	AuditPreconditionFailed = "precondition-failed"
+	// AuditStaleWrite is a write refused because its explicit version was
+	// not newer than the stored one, it never reached the topic
+	AuditStaleWrite = "stale-write"
+	// AuditStaleRecord is a record on the topic the store refused to apply
+	// because it did not carry a newer version
+	AuditStaleRecord = "stale-record"
+)
+
+// AuditEvent is written to the audit topic for every conflicting write
+type AuditEvent struct {
+	Type             string       `json:"type"`
+	UserID           string       `json:"userId"`
+	ExpectedVersion  *int         `json:"expectedVersion,omitempty"`
+	CurrentVersion   int          `json:"currentVersion"`
+	AttemptedVersion int          `json:"attemptedVersion"`
+	Attempted        *UserProfile `json:"attempted,omitempty"`
+	Partition        *int32       `json:"partition,omitempty"`
+	Offset           *int64       `json:"offset,omitempty"`
+	Reason           string       `json:"reason"`
+	Instance         string       `json:"instance"`
+	Timestamp        time.Time    `json:"timestamp"`
+}
+
+// Auditor produces audit events keyed by user ID
+type Auditor struct {
+	client   *kgo.Client
+	topic    string
+	instance string
+	logger   *slog.Logger
+}
+
+// Record produces the event asynchronously, failures are only logged because
+// the audit trail must never block or fail the write path
+func (a *Auditor) Record(event AuditEvent) {
+	event.Instance = a.instance
+	event.Timestamp = time.Now().UTC()
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		a.logger.Error("failed to encode audit event", "user_id", event.UserID, "err", err)
+		return
+	}
+
+	record := &kgo.Record{Topic: a.topic, Key: []byte(event.UserID), Value: value}
+	a.client.Produce(context.Background(), record, func(r *kgo.Record, err error) {
+		if err != nil {
+			kafkaobs.Record(a.logger, r).Error("failed to write audit event", "user_id", event.UserID, "err", err)
+		}
+	})
+}
+
+// etag formats a profile version as a strong entity tag
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseIfMatch returns the version required by an If-Match header. Both the
+// quoted entity tag returned in ETag and a bare number are accepted, "*" only
+// requires the user to exist and is reported as any.
+func parseIfMatch(header string) (version int, any bool, err error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true, nil
+	}
+	version, err = strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil {
+		return 0, false, fmt.Errorf("If-Match must be a version number or *, got %q", header)
+	}
+	return version, false, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is disconnected, it can then resume with its Last-Event-ID
+const subscriberBuffer = 256
+
+// Position is the next offset to apply per partition. It is used as the SSE
+// event ID, so a client resuming with Last-Event-ID continues on every
+// partition exactly where it left off.
+type Position map[int32]int64
+
+// String formats the position as "partition:offset" pairs, e.g. "0:12,1:5,2:9"
+func (p Position) String() string {
+	parts := make([]string, 0, len(p))
+	for _, partition := range slices.Sorted(maps.Keys(p)) {
+		parts = append(parts, fmt.Sprintf("%d:%d", partition, p[partition]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParsePosition parses the format written by Position.String
+func ParsePosition(s string) (Position, error) {
+	position := make(Position)
+	for _, part := range strings.Split(s, ",") {
+		partition, offset, ok := strings.Cut(strings.TrimSpace(part), ":")
+		p, err := strconv.ParseInt(partition, 10, 32)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid event ID %q, expected partition:offset pairs", s)
+		}
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event ID %q, expected partition:offset pairs", s)
+		}
+		position[int32(p)] = o
+	}
+	return position, nil
+}
+
+// ChangeEvent is a single upsert or delete applied to the store
+type ChangeEvent struct {
+	Type      string       `json:"type"`
+	Key       string       `json:"key"`
+	Partition int32        `json:"partition"`
+	Offset    int64        `json:"offset"`
+	Profile   *UserProfile `json:"profile,omitempty"`
+	// ID is the position right after this change
+	ID string `json:"-"`
+}
+
+// Feed fans applied changes out to subscribers and keeps the most recent ones
+// so that reconnecting clients can catch up on what they missed
+type Feed struct {
+	mu       sync.Mutex
+	capacity int
+	buffer   []ChangeEvent
+	// floor is the position before the oldest buffered event, positions
+	// below it can no longer be served from the buffer
+	floor       Position
+	position    Position
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+// NewFeed creates a feed that starts at the store's current position
+func NewFeed(capacity int, start Position) *Feed {
+	return &Feed{
+		capacity:    capacity,
+		floor:       maps.Clone(start),
+		position:    maps.Clone(start),
+		subscribers: make(map[chan ChangeEvent]struct{}),
+	}
+}
+
+// Publish records an applied change and hands it to every subscriber. A
+// subscriber that cannot keep up is dropped instead of blocking the store.
+func (f *Feed) Publish(event ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.position[event.Partition] = event.Offset + 1
+	event.ID = f.position.String()
+
+	if len(f.buffer) == f.capacity {
+		evicted := f.buffer[0]
+		f.floor[evicted.Partition] = evicted.Offset + 1
+		f.buffer = f.buffer[1:]
+	}
+	f.buffer = append(f.buffer, event)
+
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. With a from position the buffered
+// events after it are returned as backlog. If from is older than the buffer
+// reaches back, ok is false and the caller has to start over from the
+// current state, which corresponds to the returned position.
+func (f *Feed) Subscribe(from Position) (ch chan ChangeEvent, backlog []ChangeEvent, current Position, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch = make(chan ChangeEvent, subscriberBuffer)
+	f.subscribers[ch] = struct{}{}
+	current = maps.Clone(f.position)
+
+	if from == nil {
+		return ch, nil, current, true
+	}
+	for partition, floor := range f.floor {
+		if from[partition] < floor {
+			return ch, nil, current, false
+		}
+	}
+	for _, event := range f.buffer {
+		if event.Offset >= from[event.Partition] {
+			backlog = append(backlog, event)
+		}
+	}
+	return ch, backlog, current, true
+}
+
+// Unsubscribe removes a subscriber that is still registered
+func (f *Feed) Unsubscribe(ch chan ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subscribers[ch]; ok {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
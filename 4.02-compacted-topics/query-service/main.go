@@ -3,200 +3,634 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 
+	"kafkaclient"
+	"kafkametrics"
+	"kafkaobs"
+	"profiles"
+	"statestore"
+
+	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
-// UserProfile represents a user profile
-type UserProfile struct {
-	UserID  string `json:"userId"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Age     int    `json:"age"`
-	Version int    `json:"version"`
-}
+const (
+	// topic is the compacted topic the state is built from
+	topic = "user-profiles"
+	// writeTimeout bounds producing a write and waiting for it to be applied
+	writeTimeout = 10 * time.Second
+)
 
-// StateStore holds the current state
-type StateStore struct {
-	mu       sync.RWMutex
-	profiles map[string]*UserProfile
+// UserProfile is the value of a user-profiles record
+type UserProfile = profiles.UserProfile
+
+// Store holds the current state
+type Store = statestore.Store[*UserProfile]
+
+// QueryService provides HTTP API for the state store
+type QueryService struct {
+	store     *Store
+	router    *Router
+	readiness *Readiness
+	indexes   *Indexes
+	feed      *Feed
+	producer  *kgo.Client
+	auditor   *Auditor
+	metrics   *kafkametrics.Metrics
+	logger    *slog.Logger
 }
 
-// NewStateStore creates a new state store
-func NewStateStore() *StateStore {
-	return &StateStore{
-		profiles: make(map[string]*UserProfile),
+func (qs *QueryService) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	w.Header().Set("Content-Type", "application/json")
+	profile, exists := qs.store.Get(userID)
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
 	}
+	w.Header().Set("ETag", etag(profile.Version))
+	json.NewEncoder(w).Encode(profile)
 }
 
-func (s *StateStore) Set(userID string, profile *UserProfile) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.profiles[userID] = profile
+func (qs *QueryService) handleGetCount(w http.ResponseWriter, r *http.Request) {
+	count := 0
+	for key := range qs.store.All() {
+		if qs.router.Owns(key) {
+			count++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
 }
 
-func (s *StateStore) Delete(userID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.profiles, userID)
+// handlePutUser produces the profile to the topic and only replies once the
+// local store applied it, so the client's next GET sees its own write.
+// Without a version the next one is assigned, an explicit version must be
+// newer than the stored one.
+func (qs *QueryService) handlePutUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	w.Header().Set("Content-Type", "application/json")
+
+	var profile UserProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid profile: " + err.Error()})
+		return
+	}
+	if profile.UserID == "" {
+		profile.UserID = userID
+	}
+	if profile.UserID != userID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "userId does not match the URL"})
+		return
+	}
+
+	current, exists := qs.store.Get(userID)
+	if !qs.checkPrecondition(w, r, userID, current, exists, &profile) {
+		return
+	}
+	switch {
+	case profile.Version == 0 && exists:
+		profile.Version = current.Version + 1
+	case profile.Version == 0:
+		profile.Version = 1
+	case exists && profile.Version <= current.Version:
+		qs.auditor.Record(AuditEvent{
+			Type:             AuditStaleWrite,
+			UserID:           userID,
+			CurrentVersion:   current.Version,
+			AttemptedVersion: profile.Version,
+			Attempted:        &profile,
+			Reason:           "version is not newer than the stored version",
+		})
+		qs.conflict(w, current, fmt.Sprintf("Version %d is not newer than the stored version %d", profile.Version, current.Version))
+		return
+	}
+
+	value, err := json.Marshal(profile)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !qs.write(w, r, &kgo.Record{Key: []byte(userID), Value: value}) {
+		return
+	}
+
+	// The profile as written, a concurrent delete may already have removed it from the store
+	w.Header().Set("ETag", etag(profile.Version))
+	json.NewEncoder(w).Encode(profile)
 }
 
-func (s *StateStore) Get(userID string) (*UserProfile, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	profile, exists := s.profiles[userID]
-	return profile, exists
+// handleDeleteUser produces a tombstone for the user
+func (qs *QueryService) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	current, exists := qs.store.Get(userID)
+	if !qs.checkPrecondition(w, r, userID, current, exists, nil) {
+		return
+	}
+	if !exists {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+
+	if !qs.write(w, r, &kgo.Record{Key: []byte(userID), Value: nil}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *StateStore) GetAll() []*UserProfile {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	profiles := make([]*UserProfile, 0, len(s.profiles))
-	for _, v := range s.profiles {
-		profiles = append(profiles, v)
+// checkPrecondition enforces the If-Match header against the stored version.
+// It writes a 409 response, audits the conflict and returns false on mismatch.
+func (qs *QueryService) checkPrecondition(w http.ResponseWriter, r *http.Request, userID string, current *UserProfile, exists bool, attempted *UserProfile) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	expected, anyVersion, err := parseIfMatch(header)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return false
+	}
+	if exists && (anyVersion || current.Version == expected) {
+		return true
+	}
+
+	event := AuditEvent{
+		Type:      AuditPreconditionFailed,
+		UserID:    userID,
+		Attempted: attempted,
+		Reason:    "If-Match " + header + " does not match the stored version",
+	}
+	if !anyVersion {
+		event.ExpectedVersion = &expected
+	}
+	if exists {
+		event.CurrentVersion = current.Version
+	}
+	if attempted != nil {
+		event.AttemptedVersion = attempted.Version
 	}
-	return profiles
+	qs.auditor.Record(event)
+
+	if !exists {
+		current = nil
+	}
+	qs.conflict(w, current, fmt.Sprintf("If-Match %s does not match the stored version", header))
+	return false
 }
 
-func (s *StateStore) Count() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.profiles)
+// conflict writes a 409 response with the stored version, if there is one
+func (qs *QueryService) conflict(w http.ResponseWriter, current *UserProfile, message string) {
+	body := map[string]any{"error": message}
+	if current != nil {
+		w.Header().Set("ETag", etag(current.Version))
+		body["currentVersion"] = current.Version
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(body)
 }
 
-// QueryService provides HTTP API for the state store
-type QueryService struct {
-	store *StateStore
+// write produces the record and waits until the store applied its offset.
+// It writes an error response and returns false when that did not happen.
+func (qs *QueryService) write(w http.ResponseWriter, r *http.Request, record *kgo.Record) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), writeTimeout)
+	defer cancel()
+
+	if err := qs.producer.ProduceSync(ctx, record).FirstErr(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to produce: " + err.Error()})
+		return false
+	}
+
+	w.Header().Set("X-Kafka-Partition", strconv.Itoa(int(record.Partition)))
+	w.Header().Set("X-Kafka-Offset", strconv.FormatInt(record.Offset, 10))
+
+	err := qs.store.WaitFor(ctx, topic, record.Partition, record.Offset)
+	if errors.Is(err, statestore.ErrRejected) {
+		// A concurrent write got the version first, the consume loop audits it
+		current, _ := qs.store.Get(string(record.Key))
+		qs.conflict(w, current, "Write lost against a concurrent update: "+err.Error())
+		return false
+	}
+	if err != nil {
+		// The write is durable in Kafka, it is just not visible on this instance yet
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Write stored at offset %d of partition %d but not applied yet", record.Offset, record.Partition),
+		})
+		return false
+	}
+
+	return true
 }
 
-func (qs *QueryService) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	profiles := qs.store.GetAll()
+// handleInstances returns which instance owns which partition
+func (qs *QueryService) handleInstances(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(profiles)
+	json.NewEncoder(w).Encode(map[string]any{"self": qs.router.self, "partitions": qs.router.Table()})
 }
 
-func (qs *QueryService) handleGetUser(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Path[len("/users/"):]
+// handleLive reports whether the process and its consume loop are running
+func (qs *QueryService) handleLive(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	profile, exists := qs.store.Get(userID)
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+	if err := qs.readiness.Err(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "dead", "error": err.Error()})
 		return
 	}
-	json.NewEncoder(w).Encode(profile)
+	json.NewEncoder(w).Encode(map[string]string{"status": "alive"})
 }
 
-func (qs *QueryService) handleGetCount(w http.ResponseWriter, r *http.Request) {
-	count := qs.store.Count()
+// handleReady reports whether the store caught up with the end offsets seen at startup
+func (qs *QueryService) handleReady(w http.ResponseWriter, r *http.Request) {
+	report := qs.readiness.Report(qs.store.Offsets(topic))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"count": count})
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
 }
 
-func (qs *QueryService) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+func main() {
+	if err := run(); err != nil {
+		slog.Error("query service failed", "err", err)
+		os.Exit(1)
+	}
 }
 
-func main() {
+func run() error {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8090"
 	}
 
-	fmt.Printf("🚀 Starting Query Service on port %s...\n", port)
+	// The service serves /metrics and its own health checks on the API port
+	app := kafkaobs.New("query-service")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger.With("instance", "query-service:"+port)
+
+	// Every instance needs its own state file, bbolt allows a single process per file
+	statePath := getEnv("STATE_FILE", "data/query-service-"+port+".db")
+	backend, err := statestore.NewBackend(getEnv("STATE_BACKEND", "bolt"), statePath)
+	if err != nil {
+		return fmt.Errorf("opening state store: %w", err)
+	}
+
+	// A fresh instance starts from the newest snapshot and only consumes the tail of the topic
+	var snapshots statestore.SnapshotTarget
+	if location := os.Getenv("SNAPSHOT_TARGET"); location != "" {
+		snapshots, err = statestore.NewSnapshotTarget(location)
+		if err != nil {
+			backend.Close()
+			return fmt.Errorf("opening snapshot target: %w", err)
+		}
+		name, header, err := statestore.Bootstrap(context.Background(), backend, snapshots, "query-service")
+		if err != nil {
+			backend.Close()
+			return fmt.Errorf("bootstrapping from snapshot: %w", err)
+		}
+		if header != nil {
+			logger.Info("restored users from snapshot", "users", header.Keys, "snapshot", name,
+				"taken", header.CreatedAt.Format(time.RFC3339))
+		}
+	}
+	indexes := NewIndexes()
+	store, err := statestore.Open(backend, statestore.JSON[*UserProfile](),
+		statestore.WithCheck(profiles.CheckVersion),
+		statestore.WithIndex(indexes.Email),
+		statestore.WithIndex(indexes.Age),
+	)
+	if err != nil {
+		backend.Close()
+		return fmt.Errorf("opening state store: %w", err)
+	}
+	defer store.Close()
+
+	if store.Count() > 0 {
+		logger.Info("restored users from state file", "users", store.Count(), "path", statePath)
+	}
 
-	store := NewStateStore()
+	// All Kafka clients of the instance report to /metrics and log into the logger
+	metrics := app.Metrics
+	clientOpts, err := kafkaclient.Options(context.Background(), "localhost:9092")
+	if err != nil {
+		return err
+	}
+	clientOpts = append(clientOpts, app.Opts()...)
 
-	// Build state in background
-	go buildStateFromKafka(store)
+	// Writes are produced to the topic, the store picks them up like any other update
+	producer, err := kgo.NewClient(append(clientOpts,
+		kgo.DefaultProduceTopic(topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	)...)
+	if err != nil {
+		return fmt.Errorf("creating Kafka producer: %w", err)
+	}
+	defer producer.Close()
+
+	// Conflicting writes and stale records are logged to the audit topic
+	auditor := &Auditor{
+		client:   producer,
+		topic:    getEnv("AUDIT_TOPIC", "user-profiles-audit"),
+		instance: "query-service:" + port,
+		logger:   logger,
+	}
+
+	admin, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return fmt.Errorf("creating Kafka admin client: %w", err)
+	}
+	defer admin.Close()
+
+	// Other instances forward requests for our partitions to the advertised host
+	group := getEnv("GROUP_ID", "query-service")
+	router := NewRouter(kadm.NewClient(admin), group, getEnv("ADVERTISED_HOST", "localhost:"+port), logger)
+	go router.Run(context.Background())
+
+	qs := &QueryService{
+		store:     store,
+		router:    router,
+		readiness: NewReadiness(),
+		indexes:   indexes,
+		feed:      NewFeed(getEnvInt("FEED_BUFFER", 10000), store.Offsets(topic)),
+		producer:  producer,
+		auditor:   auditor,
+		metrics:   metrics,
+		logger:    logger.With("group", group),
+	}
+
+	if snapshots != nil {
+		go qs.saveSnapshots(snapshots, getEnvDuration("SNAPSHOT_INTERVAL", 10*time.Minute))
+	}
+
+	// Build state in background, /ready turns green once it caught up
+	go func() {
+		if err := qs.buildStateFromKafka(kadm.NewClient(admin), clientOpts, group); err != nil {
+			qs.logger.Error("state consumer stopped", "err", err)
+			qs.readiness.Fail(err)
+		}
+	}()
 
 	// Setup HTTP handlers
-	qs := &QueryService{store: store}
-	http.HandleFunc("/users", qs.handleGetUsers)
-	http.HandleFunc("/users/", qs.handleGetUser)
-	http.HandleFunc("/users/count", qs.handleGetCount)
-	http.HandleFunc("/health", qs.handleHealth)
-
-	// Wait a bit for initial state load
-	time.Sleep(2 * time.Second)
-
-	fmt.Println()
-	fmt.Println("📡 API Endpoints:")
-	fmt.Printf("  GET  http://localhost:%s/users        - List all users\n", port)
-	fmt.Printf("  GET  http://localhost:%s/users/:id    - Get specific user\n", port)
-	fmt.Printf("  GET  http://localhost:%s/users/count  - Get user count\n", port)
-	fmt.Printf("  GET  http://localhost:%s/health       - Health check\n", port)
-	fmt.Println()
-
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
-
-func buildStateFromKafka(store *StateStore) {
-	fmt.Println("📖 Building state from Kafka topic 'user-profiles'...")
-
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
-		kgo.ConsumeTopics("user-profiles"),
-		kgo.ConsumerGroup("query-service-"+time.Now().Format("20060102150405")),
-		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
-	)
+	http.HandleFunc("GET /users", qs.handleGetUsers)
+	http.HandleFunc("GET /users/{id}", qs.routeByKey(qs.handleGetUser))
+	http.HandleFunc("PUT /users/{id}", qs.routeByKey(qs.handlePutUser))
+	http.HandleFunc("DELETE /users/{id}", qs.routeByKey(qs.handleDeleteUser))
+	http.HandleFunc("GET /users/count", qs.handleGetCount)
+	http.HandleFunc("GET /users/changes", qs.handleChanges)
+	http.HandleFunc("GET /instances", qs.handleInstances)
+	http.HandleFunc("GET /live", qs.handleLive)
+	http.HandleFunc("GET /ready", qs.handleReady)
+	http.HandleFunc("GET /health", qs.handleReady)
+	http.Handle("GET /metrics", metrics.Handler())
+
+	// The README describes the endpoints, /live and /ready are the health checks
+	logger.Info("serving API", "url", "http://localhost:"+port, "ready", "http://localhost:"+port+"/ready")
+	return http.ListenAndServe(":"+port, nil)
+}
+
+func (qs *QueryService) buildStateFromKafka(admin *kadm.Client, clientOpts []kgo.Opt, group string) error {
+	store, readiness, logger := qs.store, qs.readiness, qs.logger
+	logger.Info("building state from compacted topic", "topic", topic)
+
+	ctx := context.Background()
+
+	// Instances share the group, each one owns a subset of the partitions
+	client, err := kgo.NewClient(append(clientOpts,
+		kgo.ClientID(qs.router.ClientID()),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(topic),
+		kgo.Balancers(kgo.CooperativeStickyBalancer()),
+		// The checkpoints in the state file decide where to resume, not the committed offsets
+		kgo.AdjustFetchOffsetsFn(func(ctx context.Context, fetched map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+			return qs.assign(ctx, admin, fetched)
+		}),
+		kgo.OnPartitionsAssigned(qs.metrics.Assigned(func(_ context.Context, _ *kgo.Client, assigned map[string][]int32) {
+			if len(assigned[topic]) > 0 {
+				logger.Info("assigned partitions", "topic", topic, "partitions", assigned[topic])
+			}
+			qs.router.Assign(assigned[topic])
+			if len(assigned[topic]) == 0 {
+				// No offsets are fetched for an empty assignment, an instance
+				// without partitions, e.g. one more than there are partitions,
+				// is ready right away
+				qs.readiness.Assign(nil, nil)
+				if qs.readiness.Update(qs.store.Offsets(topic)) {
+					logger.Info("state is up to date", "users", qs.store.Count())
+				}
+			}
+		})),
+		kgo.OnPartitionsRevoked(qs.metrics.Revoked(qs.revoke)),
+		kgo.OnPartitionsLost(qs.metrics.Lost(qs.revoke)),
+		kgo.AutoCommitCallback(qs.metrics.Committed),
+	)...)
 	if err != nil {
-		log.Printf("❌ Failed to create Kafka client: %v", err)
-		return
+		return fmt.Errorf("creating Kafka client: %w", err)
 	}
 	defer client.Close()
 
-	ctx := context.Background()
 	messagesProcessed := 0
-	initialLoadComplete := false
+	lastReport := time.Now()
 
 	for {
 		fetches := client.PollFetches(ctx)
-		if errs := fetches.Errors(); len(errs) > 0 {
-			for _, err := range errs {
-				log.Printf("❌ Fetch error: %v", err)
-			}
-			continue
+		// A failed partition returns no records, the others are applied: skipping
+		// them would checkpoint their next batch past the records of this one
+		for _, err := range fetches.Errors() {
+			logger.Error("fetch failed", "topic", err.Topic, "partition", err.Partition, "err", err.Err)
 		}
 
-		iter := fetches.RecordIter()
-		recordsInBatch := 0
-		for !iter.Done() {
-			record := iter.Next()
-			recordsInBatch++
-			messagesProcessed++
-
-			userID := string(record.Key)
+		records := fetches.Records()
+		messagesProcessed += len(records)
 
-			if record.Value == nil {
-				store.Delete(userID)
-				continue
+		changes, err := store.Apply(records...)
+		if err != nil {
+			return fmt.Errorf("applying batch: %w", err)
+		}
+		for _, change := range changes {
+			switch {
+			case change.Rejected():
+				kafkaobs.Record(logger, change.Record).Warn("rejected update", "key", change.Key, "err", change.Err)
+				qs.auditStaleRecord(change)
+			case change.Err != nil:
+				kafkaobs.Record(logger, change.Record).Warn("failed to parse profile", "key", change.Key, "err", change.Err)
+			case change.Deleted:
+				qs.feed.Publish(ChangeEvent{Type: "delete", Key: change.Key, Partition: change.Record.Partition, Offset: change.Record.Offset})
+			default:
+				qs.feed.Publish(ChangeEvent{Type: "upsert", Key: change.Key, Profile: change.Value, Partition: change.Record.Partition, Offset: change.Record.Offset})
 			}
+		}
 
-			var profile UserProfile
-			if err := json.Unmarshal(record.Value, &profile); err != nil {
-				log.Printf("⚠️  Failed to parse profile: %v", err)
-				continue
+		current := store.Offsets(topic)
+		if readiness.Update(current) {
+			report := readiness.Report(current)
+			logger.Info("caught up", "duration", report.Elapsed, "messages", messagesProcessed, "users", store.Count())
+		} else if !readiness.Ready() && time.Since(lastReport) > 2*time.Second {
+			lastReport = time.Now()
+			report := readiness.Report(current)
+			logger.Info("catching up", "remaining", report.Remaining)
+			for _, p := range report.Partitions {
+				logger.Info("partition progress", "topic", topic, "partition", p.Partition,
+					"offset", p.Current, "target", p.Target, "percent", fmt.Sprintf("%.1f", p.Percent))
 			}
-
-			store.Set(userID, &profile)
 		}
+	}
+}
 
-		if !initialLoadComplete && recordsInBatch > 0 {
-			initialLoadComplete = true
-			fmt.Printf("✅ Initial state loaded: %d messages processed, %d users in store\n",
-				messagesProcessed, store.Count())
+// saveSnapshots writes a snapshot of the store every interval. All instances
+// share the snapshot name prefix, a fresh instance resumes the partitions of
+// the newest snapshot at its offsets and consumes the others from the start.
+func (qs *QueryService) saveSnapshots(target statestore.SnapshotTarget, interval time.Duration) {
+	for range time.Tick(interval) {
+		name, header, err := qs.store.SaveSnapshot(context.Background(), target, "query-service", getEnvInt("SNAPSHOT_KEEP", 3))
+		if err != nil {
+			qs.logger.Error("failed to save snapshot", "err", err)
+			continue
 		}
+		qs.logger.Info("saved snapshot", "snapshot", name, "users", header.Keys)
+	}
+}
+
+// auditStaleRecord reports a record the store refused to apply. Only the
+// instance owning the partition reports it, partition and offset identify
+// duplicates after a rebalance.
+func (qs *QueryService) auditStaleRecord(change statestore.Change[*UserProfile]) {
+	event := AuditEvent{
+		Type:             AuditStaleRecord,
+		UserID:           change.Key,
+		AttemptedVersion: change.Value.Version,
+		Attempted:        change.Value,
+		Partition:        &change.Record.Partition,
+		Offset:           &change.Record.Offset,
+		Reason:           change.Err.Error(),
+	}
+	if current, ok := qs.store.Get(change.Key); ok {
+		event.CurrentVersion = current.Version
+	}
+	qs.auditor.Record(event)
+}
+
+// assign resumes newly assigned partitions at their checkpoint and records
+// the end offsets they have to reach before the instance is ready again
+func (qs *QueryService) assign(ctx context.Context, admin *kadm.Client, fetched map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	offsets, start, targets, err := resumeOffsets(ctx, qs.store, admin)
+	if err != nil {
+		qs.readiness.Fail(err)
+		return nil, err
+	}
+
+	assignedStart := make(map[int32]int64)
+	assignedTargets := make(map[int32]int64)
+	for partition := range fetched[topic] {
+		fetched[topic][partition] = offsets[topic][partition]
+		assignedStart[partition] = start[partition]
+		assignedTargets[partition] = targets[partition]
+	}
+	qs.readiness.Assign(assignedStart, assignedTargets)
+
+	// Partitions that are already caught up (or empty) are ready before the first fetch
+	if qs.readiness.Update(qs.store.Offsets(topic)) {
+		qs.logger.Info("state is up to date", "users", qs.store.Count())
+	}
 
-		if recordsInBatch == 0 {
-			time.Sleep(100 * time.Millisecond)
+	return fetched, nil
+}
+
+// revoke stops serving partitions that moved to another instance. Their
+// state stays in the store, so they catch up quickly should they come back.
+func (qs *QueryService) revoke(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	if len(revoked[topic]) > 0 {
+		qs.logger.Info("revoked partitions", "topic", topic, "partitions", revoked[topic])
+	}
+	qs.router.Revoke(revoked[topic])
+	qs.readiness.Revoke(revoked[topic])
+	// The revoked partitions may have been the last ones still catching up
+	if qs.readiness.Update(qs.store.Offsets(topic)) {
+		qs.logger.Info("state is up to date", "users", qs.store.Count())
+	}
+}
+
+// resumeOffsets returns where to resume every partition, the offset each
+// partition starts at and the end offsets the store has to reach to be ready
+func resumeOffsets(ctx context.Context, store *Store, admin *kadm.Client) (map[string]map[int32]kgo.Offset, map[int32]int64, map[int32]int64, error) {
+	ends, err := admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("listing end offsets: %w", err)
+	}
+
+	starts, err := admin.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("listing start offsets: %w", err)
+	}
+
+	offsets, err := store.ResumeOffsets(ctx, admin, topic)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("determining resume offsets: %w", err)
+	}
+
+	checkpoints := store.Offsets(topic)
+	start := make(map[int32]int64)
+	targets := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		targets[end.Partition] = end.Offset
+		if checkpoint, ok := checkpoints[end.Partition]; ok {
+			start[end.Partition] = checkpoint
+		} else if listed, ok := starts.Lookup(topic, end.Partition); ok {
+			start[end.Partition] = listed.Offset
 		}
+	})
+
+	return offsets, start, targets, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
 	}
+	return defaultValue
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"statestore"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// Indexes are maintained by the store while the topic is applied
+type Indexes struct {
+	Email *statestore.Index[*UserProfile, string]
+	Age   *statestore.Index[*UserProfile, int]
+}
+
+// NewIndexes creates the secondary indexes of the query service
+func NewIndexes() *Indexes {
+	return &Indexes{
+		Email: statestore.NewIndex(func(p *UserProfile) string { return strings.ToLower(p.Email) }),
+		Age:   statestore.NewIndex(func(p *UserProfile) int { return p.Age }),
+	}
+}
+
+// UserQuery is the parsed query string of GET /users
+type UserQuery struct {
+	Email  string
+	Name   string
+	MinAge int
+	MaxAge int
+	Sort   string
+	Desc   bool
+	Limit  int
+	After  *Cursor
+}
+
+// Cursor points at the last user of a page. Pages continue after its sort
+// value and key rather than at a position, so users added or removed
+// in the meantime never shift a page: users that did not change are
+// returned exactly once.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	Key   string `json:"k"`
+}
+
+// UserPage is the response of GET /users
+type UserPage struct {
+	Users      []*UserProfile `json:"users"`
+	Count      int            `json:"count"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// sortField is the value users are ordered by, as it is stored in a cursor,
+// and how two of those values compare
+type sortField struct {
+	value   func(*UserProfile) string
+	compare func(a, b string) int
+}
+
+// sortFields maps the sort parameter to the value users are ordered by
+var sortFields = map[string]sortField{
+	"userId": {func(p *UserProfile) string { return p.UserID }, cmp.Compare[string]},
+	"name":   {func(p *UserProfile) string { return strings.ToLower(p.Name) }, cmp.Compare[string]},
+	"email":  {func(p *UserProfile) string { return strings.ToLower(p.Email) }, cmp.Compare[string]},
+	// Ages compare as numbers, as strings -1 would sort after 1
+	"age": {func(p *UserProfile) string { return strconv.Itoa(p.Age) }, compareInts},
+}
+
+// compareInts compares two integers formatted by strconv.Itoa, cursors are
+// checked to hold one
+func compareInts(a, b string) int {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return cmp.Compare(x, y)
+}
+
+// userEntry is a candidate of a query, the store key next to its value.
+// The key decides the partition, the userId in the value may differ.
+type userEntry struct {
+	key     string
+	profile *UserProfile
+}
+
+func parseUserQuery(values url.Values) (*UserQuery, error) {
+	q := &UserQuery{
+		Email:  strings.ToLower(values.Get("email")),
+		Name:   strings.ToLower(values.Get("name")),
+		MinAge: math.MinInt,
+		MaxAge: math.MaxInt,
+		Sort:   "userId",
+		Limit:  defaultPageSize,
+	}
+
+	var err error
+	if v := values.Get("minAge"); v != "" {
+		if q.MinAge, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid minAge %q", v)
+		}
+	}
+	if v := values.Get("maxAge"); v != "" {
+		if q.MaxAge, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid maxAge %q", v)
+		}
+	}
+	if v := values.Get("sort"); v != "" {
+		q.Sort, q.Desc = strings.CutPrefix(v, "-")
+		if _, ok := sortFields[q.Sort]; !ok {
+			return nil, fmt.Errorf("invalid sort %q, expected userId, name, email or age with an optional - prefix", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxPageSize {
+			return nil, fmt.Errorf("invalid limit %q, expected 1 to %d", v, maxPageSize)
+		}
+	}
+	if v := values.Get("cursor"); v != "" {
+		if q.After, err = decodeCursor(v); err != nil {
+			return nil, err
+		}
+		if q.After.Sort != q.Sort || q.After.Desc != q.Desc {
+			return nil, fmt.Errorf("cursor belongs to a different sort order")
+		}
+		if _, err := strconv.Atoi(q.After.Value); q.Sort == "age" && err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return q, nil
+}
+
+// Matches reports whether the profile passes all filters
+func (q *UserQuery) Matches(p *UserProfile) bool {
+	if q.Email != "" && strings.ToLower(p.Email) != q.Email {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(p.Name), q.Name) {
+		return false
+	}
+	return p.Age >= q.MinAge && p.Age <= q.MaxAge
+}
+
+// handleGetUsers lists users, filtered by email, name and age range, sorted
+// and paginated with a cursor
+func (qs *QueryService) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q, err := parseUserQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(qs.queryUsers(q))
+}
+
+func (qs *QueryService) queryUsers(q *UserQuery) UserPage {
+	// Narrow the candidates down with an index, the filters are checked
+	// again on the values because a batch may be applied in between
+	var candidates []userEntry
+	switch {
+	case q.Email != "":
+		candidates = qs.lookup(qs.indexes.Email.Lookup(q.Email))
+	case q.MinAge != math.MinInt || q.MaxAge != math.MaxInt:
+		candidates = qs.lookup(qs.indexes.Age.Range(q.MinAge, q.MaxAge))
+	default:
+		for key, profile := range qs.store.All() {
+			candidates = append(candidates, userEntry{key: key, profile: profile})
+		}
+	}
+
+	// Users are ordered by the sort value, then by key
+	field := sortFields[q.Sort]
+	compare := func(value, key, otherValue, otherKey string) int {
+		c := cmp.Or(field.compare(value, otherValue), cmp.Compare(key, otherKey))
+		if q.Desc {
+			return -c
+		}
+		return c
+	}
+
+	var matches []userEntry
+	for _, entry := range candidates {
+		// Partitions revoked from this instance are still in the store but no longer updated
+		if !qs.router.Owns(entry.key) || !q.Matches(entry.profile) {
+			continue
+		}
+		if q.After != nil && compare(field.value(entry.profile), entry.key, q.After.Value, q.After.Key) <= 0 {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	slices.SortFunc(matches, func(a, b userEntry) int {
+		return compare(field.value(a.profile), a.key, field.value(b.profile), b.key)
+	})
+
+	page := UserPage{Users: []*UserProfile{}}
+	if len(matches) > q.Limit {
+		last := matches[q.Limit-1]
+		page.NextCursor = encodeCursor(Cursor{Sort: q.Sort, Desc: q.Desc, Value: field.value(last.profile), Key: last.key})
+		matches = matches[:q.Limit]
+	}
+	for _, entry := range matches {
+		page.Users = append(page.Users, entry.profile)
+	}
+	page.Count = len(page.Users)
+
+	return page
+}
+
+// lookup resolves index keys to profiles, skipping keys deleted in the meantime
+func (qs *QueryService) lookup(keys []string) []userEntry {
+	entries := make([]userEntry, 0, len(keys))
+	for _, key := range keys {
+		if profile, ok := qs.store.Get(key); ok {
+			entries = append(entries, userEntry{key: key, profile: profile})
+		}
+	}
+	return entries
+}
+
+func encodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
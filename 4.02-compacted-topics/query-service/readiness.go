@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Readiness decides when the store has caught up with the partitions this
+// instance owns. The end offsets of every partition are captured when it is
+// assigned, the service is ready when the store has applied everything up to
+// those offsets.
+type Readiness struct {
+	mu      sync.RWMutex
+	started time.Time
+	readyAt time.Time
+	start   map[int32]int64
+	targets map[int32]int64
+	// assigned is set once the group assigned partitions, possibly none:
+	// an instance without partitions is ready, one that did not join yet is not
+	assigned bool
+	// consumerErr is set when the consume loop stopped, the service is no longer live
+	consumerErr error
+}
+
+// PartitionProgress is the catch-up state of a single partition
+type PartitionProgress struct {
+	Partition int32   `json:"partition"`
+	Start     int64   `json:"startOffset"`
+	Current   int64   `json:"currentOffset"`
+	Target    int64   `json:"targetOffset"`
+	Remaining int64   `json:"remaining"`
+	Percent   float64 `json:"percent"`
+	CaughtUp  bool    `json:"caughtUp"`
+}
+
+// ReadinessReport is returned by the /ready endpoint
+type ReadinessReport struct {
+	Ready      bool                `json:"ready"`
+	Elapsed    string              `json:"elapsed"`
+	Remaining  int64               `json:"remaining"`
+	Partitions []PartitionProgress `json:"partitions"`
+}
+
+// NewReadiness creates a tracker that is neither ready nor targeted yet
+func NewReadiness() *Readiness {
+	return &Readiness{
+		started: time.Now(),
+		start:   make(map[int32]int64),
+		targets: make(map[int32]int64),
+	}
+}
+
+// Assign records where consumption of newly assigned partitions starts and
+// the end offsets to reach, the service is not ready until they caught up.
+// An assignment without new partitions keeps the service ready.
+func (r *Readiness) Assign(start, targets map[int32]int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assigned = true
+	for partition, target := range targets {
+		r.start[partition] = start[partition]
+		r.targets[partition] = target
+	}
+	if len(targets) > 0 && !r.readyAt.IsZero() {
+		r.started = time.Now()
+		r.readyAt = time.Time{}
+	}
+}
+
+// Revoke stops tracking partitions that were assigned to another instance
+func (r *Readiness) Revoke(partitions []int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, partition := range partitions {
+		delete(r.start, partition)
+		delete(r.targets, partition)
+	}
+}
+
+// Update compares the applied offsets with the targets and returns true the
+// moment the store becomes ready. Without targets, because the instance owns
+// no partitions, it is ready once assigned.
+func (r *Readiness) Update(current map[int32]int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.assigned || !r.readyAt.IsZero() {
+		return false
+	}
+
+	for partition, target := range r.targets {
+		if position(current, r.start, partition) < target {
+			return false
+		}
+	}
+
+	r.readyAt = time.Now()
+	return true
+}
+
+// Ready reports whether the initial catch-up finished
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.readyAt.IsZero() && r.consumerErr == nil
+}
+
+// Fail marks the consume loop as stopped
+func (r *Readiness) Fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consumerErr = err
+}
+
+// Err returns why the consume loop stopped, if it did
+func (r *Readiness) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.consumerErr
+}
+
+// Report builds the per-partition catch-up progress
+func (r *Readiness) Report(current map[int32]int64) ReadinessReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := ReadinessReport{
+		Ready:      !r.readyAt.IsZero() && r.consumerErr == nil,
+		Partitions: make([]PartitionProgress, 0, len(r.targets)),
+	}
+	if r.readyAt.IsZero() {
+		report.Elapsed = time.Since(r.started).Round(time.Millisecond).String()
+	} else {
+		report.Elapsed = r.readyAt.Sub(r.started).Round(time.Millisecond).String()
+	}
+
+	for partition, target := range r.targets {
+		progress := PartitionProgress{
+			Partition: partition,
+			Start:     r.start[partition],
+			Current:   position(current, r.start, partition),
+			Target:    target,
+			Percent:   100,
+		}
+		progress.Remaining = max(target-progress.Current, 0)
+		progress.CaughtUp = progress.Remaining == 0
+		if total := target - progress.Start; total > 0 {
+			progress.Percent = float64(min(progress.Current, target)-progress.Start) / float64(total) * 100
+		}
+
+		report.Remaining += progress.Remaining
+		report.Partitions = append(report.Partitions, progress)
+	}
+
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		return report.Partitions[i].Partition < report.Partitions[j].Partition
+	})
+
+	return report
+}
+
+// position is the next offset the store will apply, partitions without a
+// checkpoint are still at their start offset
+func position(current, start map[int32]int64, partition int32) int64 {
+	if offset, ok := current[partition]; ok {
+		return offset
+	}
+	return start[partition]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	// clientIDPrefix marks group members that are query services, the rest
+	// of the client ID is the host they advertise
+	clientIDPrefix = "query-service@"
+	// forwardedHeader is set on forwarded requests so they are never forwarded twice
+	forwardedHeader = "X-Forwarded-By"
+	// refreshInterval is how often the group is described to learn about other instances
+	refreshInterval = 5 * time.Second
+)
+
+// Router knows which instance owns which partition of the topic. Every
+// instance puts its advertised host into its Kafka client ID, describing the
+// consumer group then tells which host is assigned which partitions. This is
+// the interactive queries model of Kafka Streams.
+type Router struct {
+	admin       *kadm.Client
+	group       string
+	self        string
+	partitioner kgo.TopicPartitioner
+	logger      *slog.Logger
+
+	mu         sync.RWMutex
+	partitions int
+	// assigned are the partitions this instance consumes, straight from the
+	// group callbacks
+	assigned map[int32]bool
+	// owners maps every partition to the host of the instance consuming it
+	owners map[int32]string
+}
+
+// PartitionOwner is one entry of the routing table returned by /instances
+type PartitionOwner struct {
+	Partition int32  `json:"partition"`
+	Host      string `json:"host"`
+	Self      bool   `json:"self"`
+}
+
+// NewRouter creates a router for the given group, self is the advertised host of this instance
+func NewRouter(admin *kadm.Client, group, self string, logger *slog.Logger) *Router {
+	return &Router{
+		admin:  admin,
+		group:  group,
+		self:   self,
+		logger: logger,
+		// The same partitioner the producer uses, so keys map to the same partition
+		partitioner: kgo.StickyKeyPartitioner(nil).ForTopic(topic),
+		assigned:    make(map[int32]bool),
+		owners:      make(map[int32]string),
+	}
+}
+
+// ClientID returns the Kafka client ID that advertises this instance
+func (rt *Router) ClientID() string {
+	return clientIDPrefix + rt.self
+}
+
+// Assign records partitions assigned to this instance
+func (rt *Router) Assign(partitions []int32) {
+	rt.mu.Lock()
+	for _, p := range partitions {
+		rt.assigned[p] = true
+		rt.owners[p] = rt.self
+	}
+	rt.mu.Unlock()
+	go rt.refresh(context.Background())
+}
+
+// Revoke records partitions taken away from this instance
+func (rt *Router) Revoke(partitions []int32) {
+	rt.mu.Lock()
+	for _, p := range partitions {
+		delete(rt.assigned, p)
+		if rt.owners[p] == rt.self {
+			delete(rt.owners, p)
+		}
+	}
+	rt.mu.Unlock()
+	go rt.refresh(context.Background())
+}
+
+// Run refreshes the routing table until ctx is canceled
+func (rt *Router) Run(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		rt.refresh(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rt *Router) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, refreshInterval)
+	defer cancel()
+
+	topics, err := rt.admin.ListTopics(ctx, topic)
+	if err != nil {
+		rt.logger.Warn("failed to load metadata", "topic", topic, "err", err)
+		return
+	}
+	groups, err := rt.admin.DescribeGroups(ctx, rt.group)
+	if err == nil {
+		err = groups.Error()
+	}
+	if err != nil {
+		rt.logger.Warn("failed to describe group", "group", rt.group, "err", err)
+		return
+	}
+
+	owners := make(map[int32]string)
+	for _, member := range groups[rt.group].Members {
+		host, ok := strings.CutPrefix(member.ClientID, clientIDPrefix)
+		if !ok {
+			continue
+		}
+		assignment, ok := member.Assigned.AsConsumer()
+		if !ok {
+			continue
+		}
+		for _, t := range assignment.Topics {
+			if t.Topic != topic {
+				continue
+			}
+			for _, p := range t.Partitions {
+				owners[p] = host
+			}
+		}
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.partitions = len(topics[topic].Partitions)
+	// Our own callbacks are more recent than a describe that raced with a rebalance
+	for p := range rt.assigned {
+		owners[p] = rt.self
+	}
+	for p, host := range owners {
+		if host == rt.self && !rt.assigned[p] {
+			delete(owners, p)
+		}
+	}
+	rt.owners = owners
+}
+
+// Partition returns the partition key is produced to, or false while the
+// partition count is unknown
+func (rt *Router) Partition(key string) (int32, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	if rt.partitions == 0 {
+		return 0, false
+	}
+	return int32(rt.partitioner.Partition(&kgo.Record{Key: []byte(key)}, rt.partitions)), true
+}
+
+// Owns reports whether this instance consumes the partition of key
+func (rt *Router) Owns(key string) bool {
+	partition, ok := rt.Partition(key)
+	if !ok {
+		return false
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.assigned[partition]
+}
+
+// Owner returns the host of the instance consuming the partition of key
+func (rt *Router) Owner(key string) (host string, partition int32, err error) {
+	partition, ok := rt.Partition(key)
+	if !ok {
+		return "", 0, fmt.Errorf("partition count of %s is not known yet", topic)
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	host, ok = rt.owners[partition]
+	if !ok {
+		return "", partition, fmt.Errorf("partition %d is not assigned to any instance", partition)
+	}
+	return host, partition, nil
+}
+
+// Table returns the current routing table
+func (rt *Router) Table() []PartitionOwner {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	table := make([]PartitionOwner, 0, rt.partitions)
+	for p := range int32(rt.partitions) {
+		table = append(table, PartitionOwner{Partition: p, Host: rt.owners[p], Self: rt.owners[p] == rt.self})
+	}
+	return table
+}
+
+// routeByKey serves requests for keys of our own partitions and forwards
+// everything else to the owning instance
+func (qs *QueryService) routeByKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("id")
+		host, partition, err := qs.router.Owner(userID)
+		if err == nil && host == qs.router.self {
+			w.Header().Set("X-Served-By", qs.router.self)
+			next(w, r)
+			return
+		}
+
+		// A rebalance moved the partition while the request was forwarded
+		if err == nil && r.Header.Get(forwardedHeader) != "" {
+			err = fmt.Errorf("partition %d moved to %s during a rebalance", partition, host)
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		target := &url.URL{Scheme: "http", Host: host}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			qs.logger.Warn("failed to forward request", "method", r.Method, "path", r.URL.Path,
+				"host", host, "partition", partition, "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to reach %s, the owner of partition %d", host, partition),
+			})
+		}
+		r.Header.Set(forwardedHeader, qs.router.self)
+		proxy.ServeHTTP(w, r)
+	}
+}
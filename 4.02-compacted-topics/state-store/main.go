@@ -2,173 +2,195 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"sync"
+	"strconv"
 	"syscall"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+	"profiles"
+	"statestore"
+
+	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
-// UserProfile represents a user profile in the state store
-type UserProfile struct {
-	UserID  string `json:"userId"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Age     int    `json:"age"`
-	Version int    `json:"version"`
-}
+// UserProfile is the value of a user-profiles record
+type UserProfile = profiles.UserProfile
 
-// StateStore holds the current state built from the compacted topic
-type StateStore struct {
-	mu       sync.RWMutex
-	profiles map[string]*UserProfile
-}
+// Store holds the current state built from the compacted topic
+type Store = statestore.Store[*UserProfile]
 
-// NewStateStore creates a new state store
-func NewStateStore() *StateStore {
-	return &StateStore{
-		profiles: make(map[string]*UserProfile),
+func main() {
+	if err := run(); err != nil {
+		slog.Error("state store stopped", "err", err)
+		os.Exit(1)
 	}
 }
 
-// Set adds or updates a profile in the state store
-func (s *StateStore) Set(userID string, profile *UserProfile) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.profiles[userID] = profile
-	fmt.Printf("✓ Updated state: %s -> %s (v%d)\n", userID, profile.Name, profile.Version)
-}
+func run() error {
+	app := kafkaobs.New("state-store")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
 
-// Delete removes a profile from the state store (tombstone handling)
-func (s *StateStore) Delete(userID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.profiles, userID)
-	fmt.Printf("✗ Deleted from state: %s\n", userID)
-}
+	// Setup graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := app.Start(ctx, ":9308"); err != nil {
+		return err
+	}
+	logger := app.Logger
+	logger.Info("building local cache from compacted topic", "topic", "user-profiles")
 
-// Get retrieves a profile from the state store
-func (s *StateStore) Get(userID string) (*UserProfile, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	profile, exists := s.profiles[userID]
-	return profile, exists
-}
+	// Open the persistent state store, it remembers the last applied offset per partition
+	statePath := getEnv("STATE_FILE", "data/state-store.db")
+	backend, err := statestore.NewBackend(getEnv("STATE_BACKEND", "bolt"), statePath)
+	if err != nil {
+		return err
+	}
 
-// GetAll returns all profiles in the state store
-func (s *StateStore) GetAll() map[string]*UserProfile {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	// Return a copy to avoid race conditions
-	copy := make(map[string]*UserProfile, len(s.profiles))
-	for k, v := range s.profiles {
-		copy[k] = v
+	// A fresh store starts from the newest snapshot and only consumes the tail of the topic
+	var snapshots statestore.SnapshotTarget
+	if location := os.Getenv("SNAPSHOT_TARGET"); location != "" {
+		snapshots, err = statestore.NewSnapshotTarget(location)
+		if err != nil {
+			backend.Close()
+			return err
+		}
+		name, header, err := statestore.Bootstrap(ctx, backend, snapshots, "state-store")
+		if err != nil {
+			backend.Close()
+			return err
+		}
+		if header != nil {
+			logger.Info("restored users from snapshot", "users", header.Keys, "snapshot", name,
+				"taken", header.CreatedAt.Format(time.RFC3339))
+		}
 	}
-	return copy
-}
+	store, err := statestore.Open(backend, statestore.JSON[*UserProfile](), statestore.WithCheck(profiles.CheckVersion))
+	if err != nil {
+		backend.Close()
+		return err
+	}
+	defer store.Close()
 
-// Count returns the number of profiles in the state store
-func (s *StateStore) Count() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.profiles)
-}
+	if store.Count() > 0 {
+		logger.Info("restored users from state file", "users", store.Count(), "path", statePath)
+	}
 
-func main() {
-	fmt.Println("🚀 Starting State Store Consumer...")
-	fmt.Println("Building local cache from compacted topic 'user-profiles'")
-	fmt.Println()
-
-	// Create state store
-	store := NewStateStore()
-
-	// Create Kafka consumer
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092"),
-		kgo.ConsumeTopics("user-profiles"),
-		kgo.ConsumerGroup("state-store-consumer"),
-		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()), // Always start from beginning
-	)
+	opts, err := kafkaclient.Options(ctx, "localhost:9092")
+	if err != nil {
+		return err
+	}
+
+	metrics := app.Metrics
+	updated := metrics.Counter("state_updates_total", "Profiles written to the state store")
+	deleted := metrics.Counter("state_deletes_total", "Profiles deleted by tombstones")
+	rejected := metrics.Counter("state_rejected_total", "Records rejected by the version check or that failed to parse")
+	opts = append(opts, app.Opts()...)
+
+	admin, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	offsets, err := store.ResumeOffsets(ctx, kadm.NewClient(admin), "user-profiles")
+	admin.Close()
+	if err != nil {
+		return err
+	}
+
+	checkpoints := store.Offsets("user-profiles")
+	for partition := range int32(len(offsets["user-profiles"])) {
+		if checkpoint, ok := checkpoints[partition]; ok {
+			logger.Info("resuming partition", "partition", partition, "offset", checkpoint)
+		} else {
+			logger.Info("starting partition from the beginning", "partition", partition)
+		}
+	}
+
+	// Create Kafka consumer, partitions are assigned directly at the checkpointed offsets
+	client, err := kgo.NewClient(append(opts,
+		kgo.ConsumePartitions(offsets),
+	)...)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
 
-	// Setup graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		fmt.Println("\n🛑 Shutting down gracefully...")
-		cancel()
-	}()
+	if snapshots != nil {
+		go saveSnapshots(ctx, store, snapshots, getEnvDuration("SNAPSHOT_INTERVAL", 10*time.Minute), logger)
+	}
 
 	// Stats
 	startTime := time.Now()
 	messagesProcessed := 0
 	initialLoadComplete := false
 
-	fmt.Println("📖 Reading all messages from beginning to build state...")
-	fmt.Println()
+	logger.Info("reading messages since the last checkpoint to build state")
 
 	// Consume messages
 	for {
 		select {
 		case <-ctx.Done():
-			printStateSummary(store, messagesProcessed, time.Since(startTime))
-			return
+			logger.Info("shutting down gracefully")
+			logStateSummary(logger, store, messagesProcessed, time.Since(startTime))
+			if snapshots != nil {
+				// A final snapshot lets the next fresh instance skip everything consumed so far
+				saveSnapshot(context.Background(), store, snapshots, logger)
+			}
+			return nil
 		default:
 			fetches := client.PollFetches(ctx)
-			if errs := fetches.Errors(); len(errs) > 0 {
-				for _, err := range errs {
-					fmt.Printf("❌ Fetch error: %v\n", err)
+			// A failed partition returns no records, the others are applied:
+			// skipping them would checkpoint their next batch past the records
+			// of this one
+			for _, err := range fetches.Errors() {
+				if ctx.Err() == nil {
+					logger.Error("fetch failed", "topic", err.Topic, "partition", err.Partition, "err", err.Err)
 				}
-				continue
 			}
 
-			// Process each record
-			iter := fetches.RecordIter()
-			recordsInBatch := 0
-			for !iter.Done() {
-				record := iter.Next()
-				recordsInBatch++
-				messagesProcessed++
-
-				// Extract key (user ID)
-				userID := string(record.Key)
-
-				// Check for tombstone (null value = deletion)
-				if record.Value == nil {
-					store.Delete(userID)
-					continue
-				}
+			// Apply the whole batch, values and offsets are written together
+			records := fetches.Records()
+			recordsInBatch := len(records)
+			messagesProcessed += recordsInBatch
 
-				// Parse profile
-				var profile UserProfile
-				if err := json.Unmarshal(record.Value, &profile); err != nil {
-					fmt.Printf("⚠️  Failed to parse profile for %s: %v\n", userID, err)
-					continue
-				}
+			changes, err := store.Apply(records...)
+			if err != nil {
+				// The fetched records are gone, stop instead of silently skipping them
+				return fmt.Errorf("applying batch: %w", err)
+			}
 
-				// Update state store
-				store.Set(userID, &profile)
+			for _, change := range changes {
+				recordLogger := kafkaobs.Record(logger, change.Record).With("key", change.Key)
+				switch {
+				case change.Rejected():
+					rejected.Inc()
+					recordLogger.Warn("rejected update", "err", change.Err)
+				case change.Err != nil:
+					rejected.Inc()
+					recordLogger.Warn("failed to parse profile", "err", change.Err)
+				case change.Deleted:
+					deleted.Inc()
+					recordLogger.Info("deleted from state")
+				default:
+					updated.Inc()
+					recordLogger.Info("updated state", "name", change.Value.Name, "version", change.Value.Version)
+				}
 			}
 
 			// After first batch, consider initial load complete
 			if !initialLoadComplete && recordsInBatch > 0 {
 				initialLoadComplete = true
-				fmt.Println()
-				fmt.Println("✅ Initial state load complete!")
-				fmt.Println()
-				printStateSummary(store, messagesProcessed, time.Since(startTime))
-				fmt.Println()
-				fmt.Println("👀 Watching for updates... (Press Ctrl+C to exit)")
-				fmt.Println()
+				logger.Info("initial state load complete")
+				logStateSummary(logger, store, messagesProcessed, time.Since(startTime))
+				logger.Info("watching for updates, press Ctrl+C to exit")
 			}
 
 			// Small delay to avoid tight loop when no messages
@@ -179,24 +201,57 @@ func main() {
 	}
 }
 
-func printStateSummary(store *StateStore, messagesProcessed int, duration time.Duration) {
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Printf("📊 State Store Summary\n")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Printf("Messages processed: %d\n", messagesProcessed)
-	fmt.Printf("Current state size: %d users\n", store.Count())
-	fmt.Printf("Processing time: %v\n", duration.Round(time.Millisecond))
-	fmt.Println()
-	fmt.Println("Current State (Latest values only):")
-	fmt.Println("─────────────────────────────────────────────")
-	profiles := store.GetAll()
-	if len(profiles) == 0 {
-		fmt.Println("  (empty)")
-	} else {
-		for userID, profile := range profiles {
-			fmt.Printf("  • %s: %s <%s> (age: %d, version: %d)\n",
-				userID, profile.Name, profile.Email, profile.Age, profile.Version)
+// logStateSummary logs the counts and the current state, the latest value of
+// every user
+func logStateSummary(logger *slog.Logger, store *Store, messagesProcessed int, duration time.Duration) {
+	logger.Info("state store summary", "messages", messagesProcessed, "users", store.Count(),
+		"duration", duration.Round(time.Millisecond))
+	for userID, profile := range store.All() {
+		logger.Info("current state", "user_id", userID, "name", profile.Name, "email", profile.Email,
+			"age", profile.Age, "version", profile.Version)
+	}
+}
+
+// saveSnapshots writes a snapshot every interval until ctx is canceled
+func saveSnapshots(ctx context.Context, store *Store, target statestore.SnapshotTarget, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			saveSnapshot(ctx, store, target, logger)
+		case <-ctx.Done():
+			return
 		}
 	}
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+func saveSnapshot(ctx context.Context, store *Store, target statestore.SnapshotTarget, logger *slog.Logger) {
+	name, header, err := store.SaveSnapshot(ctx, target, "state-store", getEnvInt("SNAPSHOT_KEEP", 3))
+	if err != nil {
+		logger.Error("failed to save snapshot", "err", err)
+		return
+	}
+	logger.Info("saved snapshot", "snapshot", name, "users", header.Keys)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
 }
@@ -0,0 +1,42 @@
+package statestore
+
+import "fmt"
+
+// Op is a single change to the stored values. A nil Value deletes the key.
+type Op struct {
+	Key   string
+	Value []byte
+}
+
+// Batch is a set of changes that a backend must write atomically together
+// with the offsets they were read up to, so a crash never leaves values and
+// checkpoints out of sync.
+type Batch struct {
+	Ops []Op
+	// Offsets holds the next offset to consume per topic and partition
+	Offsets map[string]map[int32]int64
+}
+
+// Backend persists the raw record values and the per-partition checkpoints
+type Backend interface {
+	// ForEach calls fn for every stored key
+	ForEach(fn func(key string, value []byte) error) error
+	// Offsets returns the checkpoints written by previous batches
+	Offsets() (map[string]map[int32]int64, error)
+	// Write applies the batch atomically
+	Write(batch *Batch) error
+	Close() error
+}
+
+// NewBackend creates a backend by name, "bolt" stores its file at path and
+// "memory" keeps nothing across restarts
+func NewBackend(kind, path string) (Backend, error) {
+	switch kind {
+	case "bolt":
+		return NewBoltBackend(path)
+	case "memory":
+		return NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %q, expected bolt or memory", kind)
+	}
+}
@@ -0,0 +1,126 @@
+package statestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	valuesBucket  = []byte("values")
+	offsetsBucket = []byte("offsets")
+)
+
+// BoltBackend stores values and checkpoints in a single bbolt file. Every
+// batch is one transaction, so values and offsets are always consistent.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// NewBoltBackend opens (or creates) the database file at path
+func NewBoltBackend(path string) (*BoltBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s (is another instance using it?): %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{valuesBucket, offsetsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating buckets: %w", err)
+	}
+
+	return &BoltBackend{db: db}, nil
+}
+
+func (b *BoltBackend) ForEach(fn func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(valuesBucket).ForEach(func(k, v []byte) error {
+			// bbolt values are only valid during the transaction
+			return fn(string(k), append([]byte(nil), v...))
+		})
+	})
+}
+
+func (b *BoltBackend) Offsets() (map[string]map[int32]int64, error) {
+	offsets := make(map[string]map[int32]int64)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(offsetsBucket).ForEach(func(k, v []byte) error {
+			topic, partition, err := parseOffsetKey(string(k))
+			if err != nil {
+				return err
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]int64)
+			}
+			offsets[topic][partition] = int64(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	return offsets, err
+}
+
+func (b *BoltBackend) Write(batch *Batch) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		values := tx.Bucket(valuesBucket)
+		for _, op := range batch.Ops {
+			var err error
+			if op.Value == nil {
+				err = values.Delete([]byte(op.Key))
+			} else {
+				err = values.Put([]byte(op.Key), op.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		offsets := tx.Bucket(offsetsBucket)
+		for topic, partitions := range batch.Offsets {
+			for partition, offset := range partitions {
+				value := binary.BigEndian.AppendUint64(nil, uint64(offset))
+				if err := offsets.Put([]byte(offsetKey(topic, partition)), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+func offsetKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+func parseOffsetKey(key string) (string, int32, error) {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid offset key %q", key)
+	}
+	partition, err := strconv.ParseInt(key[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid offset key %q: %w", key, err)
+	}
+	return key[:i], int32(partition), nil
+}
@@ -0,0 +1,106 @@
+package statestore
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// Indexer is implemented by secondary indexes, the store keeps them up to
+// date while values are loaded and applied
+type Indexer[V any] interface {
+	put(key string, value V)
+	remove(key string)
+}
+
+// WithIndex maintains index for every value written to or deleted from the store
+func WithIndex[V any](index Indexer[V]) Option[V] {
+	return func(s *Store[V]) {
+		s.indexes = append(s.indexes, index)
+	}
+}
+
+// Index is an ordered secondary index over a field of the stored values. It
+// answers exact and range lookups with the matching store keys.
+type Index[V any, K cmp.Ordered] struct {
+	extract func(V) K
+
+	mu sync.RWMutex
+	// entries is sorted by indexed value, then by store key
+	entries []indexEntry[K]
+	// values remembers what every key was indexed under, to remove it again
+	values map[string]K
+}
+
+type indexEntry[K cmp.Ordered] struct {
+	value K
+	key   string
+}
+
+// NewIndex creates an index on the value returned by extract
+func NewIndex[V any, K cmp.Ordered](extract func(V) K) *Index[V, K] {
+	return &Index[V, K]{
+		extract: extract,
+		values:  make(map[string]K),
+	}
+}
+
+// Lookup returns the keys indexed under value, sorted
+func (i *Index[V, K]) Lookup(value K) []string {
+	return i.Range(value, value)
+}
+
+// Range returns the keys indexed under a value between from and to, both
+// inclusive, ordered by value and then key
+func (i *Index[V, K]) Range(from, to K) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	start, _ := slices.BinarySearchFunc(i.entries, from, func(e indexEntry[K], v K) int {
+		return cmp.Compare(e.value, v)
+	})
+
+	var keys []string
+	for _, e := range i.entries[start:] {
+		if cmp.Compare(e.value, to) > 0 {
+			break
+		}
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func (i *Index[V, K]) put(key string, value V) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.removeLocked(key)
+	entry := indexEntry[K]{value: i.extract(value), key: key}
+	pos, _ := slices.BinarySearchFunc(i.entries, entry, compareEntries[K])
+	i.entries = slices.Insert(i.entries, pos, entry)
+	i.values[key] = entry.value
+}
+
+func (i *Index[V, K]) remove(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.removeLocked(key)
+}
+
+func (i *Index[V, K]) removeLocked(key string) {
+	value, ok := i.values[key]
+	if !ok {
+		return
+	}
+	if pos, found := slices.BinarySearchFunc(i.entries, indexEntry[K]{value, key}, compareEntries[K]); found {
+		i.entries = slices.Delete(i.entries, pos, pos+1)
+	}
+	delete(i.values, key)
+}
+
+func compareEntries[K cmp.Ordered](a, b indexEntry[K]) int {
+	if c := cmp.Compare(a.value, b.value); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.key, b.key)
+}
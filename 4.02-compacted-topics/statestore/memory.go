@@ -0,0 +1,71 @@
+package statestore
+
+import "sync"
+
+// MemoryBackend keeps everything in memory, state is rebuilt from the topic on every start
+type MemoryBackend struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	offsets map[string]map[int32]int64
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		values:  make(map[string][]byte),
+		offsets: make(map[string]map[int32]int64),
+	}
+}
+
+func (b *MemoryBackend) ForEach(fn func(key string, value []byte) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k, v := range b.values {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Offsets() (map[string]map[int32]int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return copyOffsets(b.offsets), nil
+}
+
+func (b *MemoryBackend) Write(batch *Batch) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, op := range batch.Ops {
+		if op.Value == nil {
+			delete(b.values, op.Key)
+			continue
+		}
+		b.values[op.Key] = op.Value
+	}
+	for topic, partitions := range batch.Offsets {
+		if b.offsets[topic] == nil {
+			b.offsets[topic] = make(map[int32]int64)
+		}
+		for partition, offset := range partitions {
+			b.offsets[topic][partition] = offset
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+func copyOffsets(offsets map[string]map[int32]int64) map[string]map[int32]int64 {
+	copy := make(map[string]map[int32]int64, len(offsets))
+	for topic, partitions := range offsets {
+		copy[topic] = make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			copy[topic][partition] = offset
+		}
+	}
+	return copy
+}
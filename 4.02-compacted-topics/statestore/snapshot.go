@@ -0,0 +1,179 @@
+package statestore
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// snapshotFormat identifies the snapshot layout, it is checked on restore
+const snapshotFormat = "statestore-snapshot/v1"
+
+// ErrNoSnapshot is returned by SnapshotTarget.Latest when there is none yet
+var ErrNoSnapshot = errors.New("no snapshot found")
+
+// SnapshotHeader is the first line of a snapshot. The offsets are the next
+// offsets to consume, they belong to exactly the values in the snapshot.
+type SnapshotHeader struct {
+	Format    string                     `json:"format"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	Offsets   map[string]map[int32]int64 `json:"offsets"`
+	Keys      int                        `json:"keys"`
+}
+
+// snapshotEntry is a single key, the value is stored as it was on the topic
+type snapshotEntry struct {
+	Key   string `json:"k"`
+	Value []byte `json:"v"`
+}
+
+// WriteSnapshot writes every value and the offsets they belong to as gzipped
+// JSON lines. Batches are held back while the snapshot is written.
+func (s *Store[V]) WriteSnapshot(w io.Writer) (*SnapshotHeader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	header := &SnapshotHeader{
+		Format:    snapshotFormat,
+		CreatedAt: time.Now().UTC(),
+		Offsets:   copyOffsets(s.offsets),
+		Keys:      len(s.values),
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("writing snapshot header: %w", err)
+	}
+	err := s.backend.ForEach(func(key string, value []byte) error {
+		return enc.Encode(snapshotEntry{Key: key, Value: value})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("writing snapshot entries: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	return header, nil
+}
+
+// RestoreSnapshot loads a snapshot into an empty backend, after which Open
+// resumes consuming at the offsets of the snapshot
+func RestoreSnapshot(backend Backend, r io.Reader) (*SnapshotHeader, error) {
+	existing, err := backend.Offsets()
+	if err != nil {
+		return nil, fmt.Errorf("loading offsets: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil, errors.New("backend already contains state, restore into an empty store")
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	var header SnapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading snapshot header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return nil, fmt.Errorf("unsupported snapshot format %q", header.Format)
+	}
+
+	batch := &Batch{Offsets: header.Offsets}
+	for {
+		var entry snapshotEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading snapshot entry: %w", err)
+		}
+		batch.Ops = append(batch.Ops, Op{Key: entry.Key, Value: entry.Value})
+	}
+	if len(batch.Ops) != header.Keys {
+		return nil, fmt.Errorf("snapshot is truncated: expected %d keys, found %d", header.Keys, len(batch.Ops))
+	}
+
+	if err := backend.Write(batch); err != nil {
+		return nil, fmt.Errorf("writing snapshot to backend: %w", err)
+	}
+	return &header, nil
+}
+
+// SaveSnapshot writes a snapshot to target as <prefix>-<timestamp>.snapshot.gz
+// and removes all but the newest keep snapshots of prefix
+func (s *Store[V]) SaveSnapshot(ctx context.Context, target SnapshotTarget, prefix string, keep int) (string, *SnapshotHeader, error) {
+	// Spool to a temporary file first, so the store is not held back by a slow upload
+	tmp, err := os.CreateTemp("", prefix+"-*.snapshot.gz")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temporary snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	header, err := s.WriteSnapshot(tmp)
+	if err != nil {
+		return "", nil, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+
+	name := snapshotName(prefix, header.CreatedAt)
+	if err := target.Put(ctx, name, tmp, size); err != nil {
+		return "", nil, fmt.Errorf("uploading snapshot %s: %w", name, err)
+	}
+	if keep > 0 {
+		if err := target.Prune(ctx, prefix, keep); err != nil {
+			return name, header, fmt.Errorf("pruning snapshots: %w", err)
+		}
+	}
+	return name, header, nil
+}
+
+// Bootstrap restores the newest snapshot of prefix into an empty backend. It
+// returns a nil header if the backend already has state or there is no
+// snapshot yet, the topic is then consumed from the checkpoint or beginning.
+func Bootstrap(ctx context.Context, backend Backend, target SnapshotTarget, prefix string) (string, *SnapshotHeader, error) {
+	existing, err := backend.Offsets()
+	if err != nil {
+		return "", nil, fmt.Errorf("loading offsets: %w", err)
+	}
+	if len(existing) > 0 {
+		return "", nil, nil
+	}
+
+	name, r, err := target.Latest(ctx, prefix)
+	if errors.Is(err, ErrNoSnapshot) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("finding the latest snapshot: %w", err)
+	}
+	defer r.Close()
+
+	header, err := RestoreSnapshot(backend, r)
+	if err != nil {
+		return "", nil, fmt.Errorf("restoring snapshot %s: %w", name, err)
+	}
+	return name, header, nil
+}
+
+// snapshotName sorts lexically in creation order
+func snapshotName(prefix string, createdAt time.Time) string {
+	return fmt.Sprintf("%s-%s.snapshot.gz", prefix, createdAt.UTC().Format("20060102T150405.000Z"))
+}
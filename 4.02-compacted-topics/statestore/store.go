@@ -0,0 +1,327 @@
+// Package statestore materializes a compacted topic into a keyed store.
+//
+// Record values are persisted as-is in a pluggable Backend together with the
+// next offset to consume per partition, so a restart resumes from the last
+// checkpoint instead of replaying the topic from offset 0.
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// DecodeFunc turns a record value into the stored type
+type DecodeFunc[V any] func(value []byte) (V, error)
+
+// JSON decodes record values as JSON into V
+func JSON[V any]() DecodeFunc[V] {
+	return func(value []byte) (V, error) {
+		var v V
+		err := json.Unmarshal(value, &v)
+		return v, err
+	}
+}
+
+// ErrRejected is wrapped by the errors of records refused by a CheckFunc
+var ErrRejected = errors.New("record rejected")
+
+// maxRejections bounds how many rejected offsets are remembered for WaitFor
+const maxRejections = 1024
+
+// CheckFunc decides whether next may replace the current value of key.
+// Returning an error rejects the record, it is then not applied.
+type CheckFunc[V any] func(key string, current V, exists bool, next V) error
+
+// Option configures a Store
+type Option[V any] func(*Store[V])
+
+// WithCheck rejects records for which check returns an error, for example
+// updates carrying an older version than the stored value
+func WithCheck[V any](check CheckFunc[V]) Option[V] {
+	return func(s *Store[V]) {
+		s.check = check
+	}
+}
+
+// Change describes what applying a single record did to the store
+type Change[V any] struct {
+	Key     string
+	Value   V
+	Deleted bool
+	Record  *kgo.Record
+	// Err is set when the record could not be decoded or was rejected, the
+	// store is left untouched but the offset still advances past the record.
+	Err error
+}
+
+// Rejected reports whether the record was refused by the store's CheckFunc
+func (c Change[V]) Rejected() bool {
+	return errors.Is(c.Err, ErrRejected)
+}
+
+// Store is a keyed view over a compacted topic. Reads are served from memory,
+// writes go through the backend first.
+type Store[V any] struct {
+	mu      sync.RWMutex
+	backend Backend
+	decode  DecodeFunc[V]
+	check   CheckFunc[V]
+	indexes []Indexer[V]
+	values  map[string]V
+	offsets map[string]map[int32]int64
+	// applied is closed and replaced after every batch to wake up waiters
+	applied chan struct{}
+	// rejections remembers recently rejected offsets so writers can learn
+	// that their record lost, order keeps the oldest first for trimming
+	rejections map[rejectionKey]error
+	order      []rejectionKey
+}
+
+type rejectionKey struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+// Open loads the values and checkpoints that are already in the backend
+func Open[V any](backend Backend, decode DecodeFunc[V], opts ...Option[V]) (*Store[V], error) {
+	s := &Store[V]{
+		backend:    backend,
+		decode:     decode,
+		values:     make(map[string]V),
+		applied:    make(chan struct{}),
+		rejections: make(map[rejectionKey]error),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	err := backend.ForEach(func(key string, value []byte) error {
+		v, err := decode(value)
+		if err != nil {
+			return fmt.Errorf("decoding stored value for %q: %w", key, err)
+		}
+		s.values[key] = v
+		for _, index := range s.indexes {
+			index.put(key, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading values: %w", err)
+	}
+
+	s.offsets, err = backend.Offsets()
+	if err != nil {
+		return nil, fmt.Errorf("loading offsets: %w", err)
+	}
+
+	return s, nil
+}
+
+// Apply writes a batch of records and their offsets to the backend in one go.
+// Tombstones (nil values) delete the key.
+func (s *Store[V]) Apply(records ...*kgo.Record) ([]Change[V], error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	batch := &Batch{Offsets: make(map[string]map[int32]int64)}
+	changes := make([]Change[V], 0, len(records))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// pending holds the values written earlier in this batch, later records
+	// for the same key are checked against those
+	pending := make(map[string]*Change[V])
+
+	for _, record := range records {
+		if batch.Offsets[record.Topic] == nil {
+			batch.Offsets[record.Topic] = make(map[int32]int64)
+		}
+		batch.Offsets[record.Topic][record.Partition] = record.Offset + 1
+
+		change := Change[V]{Key: string(record.Key), Record: record}
+		if record.Value == nil {
+			change.Deleted = true
+			batch.Ops = append(batch.Ops, Op{Key: change.Key})
+			changes = append(changes, change)
+			pending[change.Key] = &changes[len(changes)-1]
+			continue
+		}
+
+		change.Value, change.Err = s.decode(record.Value)
+		if change.Err == nil && s.check != nil {
+			current, exists := s.values[change.Key]
+			if p, ok := pending[change.Key]; ok {
+				current, exists = p.Value, !p.Deleted
+			}
+			if err := s.check(change.Key, current, exists, change.Value); err != nil {
+				change.Err = fmt.Errorf("%w: %w", ErrRejected, err)
+			}
+		}
+		if change.Err == nil {
+			batch.Ops = append(batch.Ops, Op{Key: change.Key, Value: record.Value})
+		}
+		changes = append(changes, change)
+		if change.Err == nil {
+			pending[change.Key] = &changes[len(changes)-1]
+		}
+	}
+
+	if err := s.backend.Write(batch); err != nil {
+		return nil, fmt.Errorf("writing batch: %w", err)
+	}
+
+	for _, change := range changes {
+		switch {
+		case change.Rejected():
+			s.remember(change)
+		case change.Err != nil:
+		case change.Deleted:
+			delete(s.values, change.Key)
+			for _, index := range s.indexes {
+				index.remove(change.Key)
+			}
+		default:
+			s.values[change.Key] = change.Value
+			for _, index := range s.indexes {
+				index.put(change.Key, change.Value)
+			}
+		}
+	}
+	for topic, partitions := range batch.Offsets {
+		if s.offsets[topic] == nil {
+			s.offsets[topic] = make(map[int32]int64)
+		}
+		for partition, offset := range partitions {
+			s.offsets[topic][partition] = offset
+		}
+	}
+
+	close(s.applied)
+	s.applied = make(chan struct{})
+
+	return changes, nil
+}
+
+// WaitFor blocks until the record at offset of the given partition has been
+// applied, which gives writers read-your-writes consistency. If the record
+// was rejected by the store's CheckFunc the rejection error is returned.
+func (s *Store[V]) WaitFor(ctx context.Context, topic string, partition int32, offset int64) error {
+	for {
+		s.mu.RLock()
+		next, applied := s.offsets[topic][partition], s.applied
+		rejected := s.rejections[rejectionKey{topic, partition, offset}]
+		s.mu.RUnlock()
+
+		if next > offset {
+			return rejected
+		}
+
+		select {
+		case <-applied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// remember keeps a rejected record around for WaitFor, the caller holds the lock
+func (s *Store[V]) remember(change Change[V]) {
+	key := rejectionKey{change.Record.Topic, change.Record.Partition, change.Record.Offset}
+	s.rejections[key] = change.Err
+	s.order = append(s.order, key)
+	if len(s.order) > maxRejections {
+		delete(s.rejections, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get retrieves a value from the store
+func (s *Store[V]) Get(key string) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// All returns a copy of all values in the store
+func (s *Store[V]) All() map[string]V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	copy := make(map[string]V, len(s.values))
+	for k, v := range s.values {
+		copy[k] = v
+	}
+	return copy
+}
+
+// Count returns the number of keys in the store
+func (s *Store[V]) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.values)
+}
+
+// Offsets returns the next offset to consume per partition of topic
+func (s *Store[V]) Offsets(topic string) map[int32]int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	offsets := make(map[int32]int64, len(s.offsets[topic]))
+	for partition, offset := range s.offsets[topic] {
+		offsets[partition] = offset
+	}
+	return offsets
+}
+
+// Close closes the backend
+func (s *Store[V]) Close() error {
+	return s.backend.Close()
+}
+
+// ResumeOffsets returns the offsets to pass to kgo.ConsumePartitions so that
+// every partition of topic continues at its checkpoint. Partitions without a
+// checkpoint start at the beginning.
+func (s *Store[V]) ResumeOffsets(ctx context.Context, admin *kadm.Client, topic string) (map[string]map[int32]kgo.Offset, error) {
+	ends, err := admin.ListEndOffsets(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("listing end offsets: %w", err)
+	}
+	if err := ends.Error(); err != nil {
+		return nil, fmt.Errorf("listing end offsets: %w", err)
+	}
+
+	checkpoints := s.Offsets(topic)
+	offsets := map[string]map[int32]kgo.Offset{topic: {}}
+
+	var failed error
+	ends.Each(func(end kadm.ListedOffset) {
+		checkpoint, ok := checkpoints[end.Partition]
+		switch {
+		case !ok:
+			offsets[topic][end.Partition] = kgo.NewOffset().AtStart()
+		case checkpoint > end.Offset:
+			// The topic was most likely deleted and recreated
+			failed = fmt.Errorf("checkpoint %d of %s[%d] is beyond the end offset %d, remove the state file to rebuild",
+				checkpoint, topic, end.Partition, end.Offset)
+		default:
+			offsets[topic][end.Partition] = kgo.NewOffset().At(checkpoint)
+		}
+	})
+	if failed != nil {
+		return nil, failed
+	}
+	if len(offsets[topic]) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+
+	return offsets, nil
+}
@@ -0,0 +1,192 @@
+package statestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// SnapshotTarget is where snapshots are uploaded to and bootstrapped from
+type SnapshotTarget interface {
+	// Put stores a snapshot of size bytes under name
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Latest opens the newest snapshot of prefix, or returns ErrNoSnapshot
+	Latest(ctx context.Context, prefix string) (string, io.ReadCloser, error)
+	// Prune removes all but the newest keep snapshots of prefix
+	Prune(ctx context.Context, prefix string, keep int) error
+}
+
+// NewSnapshotTarget creates a target from a location: a local directory, or
+// s3://bucket/path for an S3-compatible store configured by S3_ENDPOINT,
+// S3_REGION, S3_INSECURE, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+func NewSnapshotTarget(location string) (SnapshotTarget, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, path, _ := strings.Cut(rest, "/")
+		return NewS3Target(bucket, path)
+	}
+	return NewDirTarget(strings.TrimPrefix(location, "file://"))
+}
+
+// DirTarget keeps snapshots in a local (or mounted) directory
+type DirTarget struct {
+	dir string
+}
+
+// NewDirTarget creates the directory if it does not exist
+func NewDirTarget(dir string) (*DirTarget, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	return &DirTarget{dir: dir}, nil
+}
+
+// Put writes to a temporary file first, a snapshot is either complete or absent
+func (t *DirTarget) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	tmp, err := os.CreateTemp(t.dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+}
+
+func (t *DirTarget) Latest(_ context.Context, prefix string) (string, io.ReadCloser, error) {
+	names, err := t.list(prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(names) == 0 {
+		return "", nil, ErrNoSnapshot
+	}
+	name := names[len(names)-1]
+	f, err := os.Open(filepath.Join(t.dir, name))
+	return name, f, err
+}
+
+func (t *DirTarget) Prune(_ context.Context, prefix string, keep int) error {
+	names, err := t.list(prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names[:max(len(names)-keep, 0)] {
+		if err := os.Remove(filepath.Join(t.dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the snapshot names of prefix, oldest first
+func (t *DirTarget) list(prefix string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(t.dir, prefix+"-*.snapshot.gz"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, filepath.Base(match))
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// S3Target keeps snapshots in a bucket of an S3-compatible store such as
+// AWS S3 or MinIO
+type S3Target struct {
+	client *minio.Client
+	bucket string
+	path   string
+}
+
+// NewS3Target connects to the store configured in the environment
+func NewS3Target(bucket, path string) (*S3Target, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("snapshot location s3:// needs a bucket")
+	}
+
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: os.Getenv("S3_INSECURE") != "true",
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return &S3Target{client: client, bucket: bucket, path: path}, nil
+}
+
+func (t *S3Target) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := t.client.PutObject(ctx, t.bucket, t.path+name, r, size, minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	})
+	return err
+}
+
+func (t *S3Target) Latest(ctx context.Context, prefix string) (string, io.ReadCloser, error) {
+	names, err := t.list(ctx, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(names) == 0 {
+		return "", nil, ErrNoSnapshot
+	}
+	name := names[len(names)-1]
+	object, err := t.client.GetObject(ctx, t.bucket, t.path+name, minio.GetObjectOptions{})
+	return name, object, err
+}
+
+func (t *S3Target) Prune(ctx context.Context, prefix string, keep int) error {
+	names, err := t.list(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names[:max(len(names)-keep, 0)] {
+		if err := t.client.RemoveObject(ctx, t.bucket, t.path+name, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the snapshot names of prefix, oldest first
+func (t *S3Target) list(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for object := range t.client.ListObjects(ctx, t.bucket, minio.ListObjectsOptions{Prefix: t.path + prefix + "-"}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, t.path)
+		if strings.HasSuffix(name, ".snapshot.gz") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
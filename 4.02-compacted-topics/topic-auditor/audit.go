@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// maxListed bounds the keys listed per finding, the counts are always complete
+const maxListed = 20
+
+// Report is the JSON document written by the auditor
+type Report struct {
+	Topic      string      `json:"topic"`
+	ScannedAt  time.Time   `json:"scannedAt"`
+	DurationMs int64       `json:"durationMs"`
+	Config     TopicConfig `json:"config"`
+	Compacted  bool        `json:"compacted"`
+	Complete   bool        `json:"complete"`
+	Records    int64       `json:"records"`
+	Bytes      int64       `json:"bytes"`
+	// KeylessRecords are rejected by the log cleaner, a compacted topic should have none
+	KeylessRecords int64             `json:"keylessRecords"`
+	Duplicates     DuplicateReport   `json:"duplicates"`
+	Tombstones     TombstoneReport   `json:"tombstones"`
+	View           ViewReport        `json:"view"`
+	Partitions     []PartitionReport `json:"partitions"`
+	// Warnings are findings that may resolve on their own, they never fail the audit
+	Warnings   []string `json:"warnings"`
+	Violations []string `json:"violations"`
+}
+
+// TopicConfig holds the configs that drive compaction
+type TopicConfig struct {
+	CleanupPolicy          string  `json:"cleanupPolicy"`
+	DeleteRetentionMs      int64   `json:"deleteRetentionMs"`
+	MinCleanableDirtyRatio float64 `json:"minCleanableDirtyRatio"`
+	SegmentMs              int64   `json:"segmentMs"`
+	MinCompactionLagMs     int64   `json:"minCompactionLagMs"`
+	MaxCompactionLagMs     int64   `json:"maxCompactionLagMs"`
+}
+
+// DuplicateReport counts records superseded by a newer record with the same
+// key, which compaction has not removed yet
+type DuplicateReport struct {
+	Records int64 `json:"records"`
+	Bytes   int64 `json:"bytes"`
+	// DirtyRatio is the fraction of keyed records that are superseded
+	DirtyRatio float64 `json:"dirtyRatio"`
+	// ByteDirtyRatio is the same by size, closer to how the log cleaner measures it
+	ByteDirtyRatio float64    `json:"byteDirtyRatio"`
+	TopKeys        []KeyCount `json:"topKeys"`
+}
+
+// KeyCount is the number of records of a key that are still in the log
+type KeyCount struct {
+	Key       string `json:"key"`
+	Partition int32  `json:"partition"`
+	Records   int    `json:"records"`
+}
+
+// TombstoneReport describes delete markers. Only tombstones that are the
+// latest record of their key can expire, older ones are plain duplicates.
+//
+// The delete horizon of a tombstone starts when the cleaner first compacts
+// its segment, not at its timestamp. A tombstone in the active segment, or in
+// a segment the cleaner did not reach yet, stays in a correct log for longer
+// than delete.retention.ms.
+type TombstoneReport struct {
+	Total  int64 `json:"total"`
+	Latest int64 `json:"latest"`
+	// Expired are latest tombstones older than delete.retention.ms, they are
+	// removed once the cleaner compacted their segment and are only a warning
+	Expired int64 `json:"expired"`
+	// Overdue are latest tombstones older than delete.retention.ms plus
+	// segment.ms and max.compaction.lag.ms, by then their segment rolled and
+	// must have been compacted. Without a max.compaction.lag.ms the cleaner
+	// has no deadline and no tombstone is overdue.
+	Overdue     int64      `json:"overdue"`
+	OverdueKeys []string   `json:"overdueKeys"`
+	Oldest      *time.Time `json:"oldest,omitempty"`
+}
+
+// ViewReport is what a consumer materializing the topic ends up with
+type ViewReport struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PartitionReport holds the counts of a single partition
+type PartitionReport struct {
+	Partition         int32 `json:"partition"`
+	StartOffset       int64 `json:"startOffset"`
+	EndOffset         int64 `json:"endOffset"`
+	Complete          bool  `json:"complete"`
+	Records           int64 `json:"records"`
+	Keys              int64 `json:"keys"`
+	Duplicates        int64 `json:"duplicates"`
+	Tombstones        int64 `json:"tombstones"`
+	ExpiredTombstones int64 `json:"expiredTombstones"`
+	OverdueTombstones int64 `json:"overdueTombstones"`
+	Keyless           int64 `json:"keyless"`
+}
+
+// latest is the newest record seen for a key
+type latest struct {
+	records   int
+	size      int64
+	tombstone bool
+	timestamp time.Time
+}
+
+// audit reads every partition of topic from its start to the end offset seen
+// when the scan started. A partition that fetches nothing for idle is complete
+// only if a direct fetch shows nothing but empty batches before its end, the
+// others are still read to their end.
+func audit(ctx context.Context, logger *slog.Logger, opts []kgo.Opt, topic string, idle time.Duration) (*Report, error) {
+	started := time.Now()
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	defer client.Close()
+	admin := kadm.NewClient(client)
+
+	report := &Report{Topic: topic, ScannedAt: started.UTC()}
+	if report.Config, err = topicConfig(ctx, admin, topic); err != nil {
+		return nil, err
+	}
+	report.Compacted = slices.Contains(strings.Split(report.Config.CleanupPolicy, ","), "compact")
+
+	ends, err := admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing end offsets: %w", err)
+	}
+	starts, err := admin.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing start offsets: %w", err)
+	}
+
+	partitions := make(map[int32]*PartitionReport)
+	offsets := map[string]map[int32]kgo.Offset{topic: {}}
+	ends.Each(func(end kadm.ListedOffset) {
+		start, _ := starts.Lookup(topic, end.Partition)
+		p := &PartitionReport{Partition: end.Partition, StartOffset: start.Offset, EndOffset: end.Offset}
+		p.Complete = start.Offset >= end.Offset
+		partitions[end.Partition] = p
+		if !p.Complete {
+			offsets[topic][end.Partition] = kgo.NewOffset().At(start.Offset)
+		}
+	})
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+
+	keys := make(map[int32]map[string]*latest)
+	for partition := range partitions {
+		keys[partition] = make(map[string]*latest)
+	}
+
+	if len(offsets[topic]) > 0 {
+		consumer, err := kgo.NewClient(append(opts,
+			kgo.ConsumePartitions(offsets),
+			kgo.KeepControlRecords(),
+		)...)
+		if err != nil {
+			return nil, fmt.Errorf("creating consumer: %w", err)
+		}
+		defer consumer.Close()
+
+		// next is the offset after the last record read from a partition,
+		// control records count so a trailing commit marker completes it
+		next := make(map[int32]int64)
+		consume := func(record *kgo.Record) {
+			p := partitions[record.Partition]
+			if p.Complete || record.Offset >= p.EndOffset {
+				return
+			}
+			if !record.Attrs.IsControl() {
+				observe(report, p, keys[record.Partition], record)
+			}
+			next[record.Partition] = record.Offset + 1
+			if record.Offset+1 >= p.EndOffset {
+				p.Complete = true
+			}
+		}
+
+		// lastFetched is when a pending partition last returned records
+		lastFetched := make(map[int32]time.Time)
+		for partition := range offsets[topic] {
+			lastFetched[partition] = time.Now()
+			next[partition] = partitions[partition].StartOffset
+		}
+		for len(lastFetched) > 0 {
+			pollCtx, cancel := context.WithTimeout(ctx, idle)
+			fetches := consumer.PollFetches(pollCtx)
+			cancel()
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			fetches.EachError(func(_ string, partition int32, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					logger.Warn("fetch failed", "partition", partition, "err", err)
+				}
+			})
+
+			fetches.EachRecord(func(record *kgo.Record) {
+				if _, pending := lastFetched[record.Partition]; !pending {
+					return
+				}
+				consume(record)
+				lastFetched[record.Partition] = time.Now()
+				if partitions[record.Partition].Complete {
+					delete(lastFetched, record.Partition)
+				}
+			})
+
+			var stalled []int32
+			for partition, last := range lastFetched {
+				if time.Since(last) >= idle {
+					stalled = append(stalled, partition)
+					delete(lastFetched, partition)
+				}
+			}
+			if len(stalled) == 0 {
+				continue
+			}
+			consumer.PauseFetchPartitions(map[string][]int32{topic: stalled})
+
+			// The consumer returns nothing for the batches compaction
+			// emptied at the tail, so an idle partition may already be
+			// read to its end. Fetch it directly to find out, those that
+			// still fall short stay incomplete.
+			for _, partition := range stalled {
+				p := partitions[partition]
+				for next[partition] < p.EndOffset {
+					fetched, offset, err := fetchRaw(ctx, client, topic, partition, next[partition])
+					if err != nil {
+						logger.Warn("fetch failed", "partition", partition, "err", err)
+						break
+					}
+					for _, record := range fetched {
+						consume(record)
+					}
+					if offset <= next[partition] {
+						break
+					}
+					next[partition] = offset
+				}
+				p.Complete = next[partition] >= p.EndOffset
+			}
+		}
+	}
+
+	summarize(report, partitions, keys)
+	report.DurationMs = time.Since(started).Milliseconds()
+	return report, nil
+}
+
+// fetchRaw fetches one partition from offset on its leader and returns its
+// records with the offset the next fetch starts from. Unlike the records, that
+// offset moves past the batches compaction emptied and past control batches.
+func fetchRaw(ctx context.Context, client *kgo.Client, topic string, partition int32, offset int64) ([]*kgo.Record, int64, error) {
+	metadata, err := kadm.NewClient(client).Metadata(ctx, topic)
+	if err != nil {
+		return nil, 0, err
+	}
+	detail := metadata.Topics[topic]
+	if detail.Err != nil {
+		return nil, 0, detail.Err
+	}
+	leader, ok := detail.Partitions[partition]
+	if !ok {
+		return nil, 0, fmt.Errorf("partition %d has no metadata", partition)
+	}
+	if leader.Err != nil {
+		return nil, 0, leader.Err
+	}
+
+	req := kmsg.NewPtrFetchRequest()
+	req.SessionEpoch = -1
+	reqTopic := kmsg.NewFetchRequestTopic()
+	reqTopic.Topic = topic
+	reqTopic.TopicID = detail.ID
+	reqPartition := kmsg.NewFetchRequestTopicPartition()
+	reqPartition.Partition = partition
+	reqPartition.FetchOffset = offset
+	reqPartition.PartitionMaxBytes = 1 << 20
+	reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
+	req.Topics = append(req.Topics, reqTopic)
+
+	resp, err := req.RequestWith(ctx, client.Broker(int(leader.Leader)))
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := kerr.ErrorForCode(resp.ErrorCode); err != nil {
+		return nil, 0, err
+	}
+	for _, t := range resp.Topics {
+		for i := range t.Partitions {
+			if t.Partitions[i].Partition != partition {
+				continue
+			}
+			fetched, next := kgo.ProcessFetchPartition(kgo.ProcessFetchPartitionOpts{
+				KeepControlRecords: true,
+				Offset:             offset,
+				Topic:              topic,
+				Partition:          partition,
+			}, &t.Partitions[i], kgo.DefaultDecompressor(), nil)
+			return fetched.Records, next, fetched.Err
+		}
+	}
+	return nil, 0, fmt.Errorf("fetch response has no partition %d", partition)
+}
+
+func observe(report *Report, p *PartitionReport, keys map[string]*latest, record *kgo.Record) {
+	size := int64(len(record.Key) + len(record.Value))
+	report.Records++
+	report.Bytes += size
+	p.Records++
+
+	if record.Value == nil {
+		report.Tombstones.Total++
+		p.Tombstones++
+	}
+
+	if record.Key == nil {
+		report.KeylessRecords++
+		p.Keyless++
+		return
+	}
+
+	key := string(record.Key)
+	l, ok := keys[key]
+	if !ok {
+		l = &latest{}
+		keys[key] = l
+	} else {
+		// The previous record of this key is superseded
+		report.Duplicates.Records++
+		report.Duplicates.Bytes += l.size
+		p.Duplicates++
+	}
+	l.records++
+	l.size = size
+	l.tombstone = record.Value == nil
+	l.timestamp = record.Timestamp
+}
+
+// summarize derives the view, expired tombstones and ratios from the latest
+// record of every key
+func summarize(report *Report, partitions map[int32]*PartitionReport, keys map[int32]map[string]*latest) {
+	retention := time.Duration(report.Config.DeleteRetentionMs) * time.Millisecond
+	overdue := overdueAfter(report.Config)
+	now := time.Now()
+
+	var top []KeyCount
+	report.Complete = true
+	for partition, p := range partitions {
+		report.Complete = report.Complete && p.Complete
+		p.Keys = int64(len(keys[partition]))
+
+		for key, l := range keys[partition] {
+			if l.records > 1 {
+				top = append(top, KeyCount{Key: key, Partition: partition, Records: l.records})
+			}
+			if !l.tombstone {
+				report.View.Keys++
+				report.View.Bytes += l.size
+				continue
+			}
+
+			report.Tombstones.Latest++
+			if report.Tombstones.Oldest == nil || l.timestamp.Before(*report.Tombstones.Oldest) {
+				oldest := l.timestamp.UTC()
+				report.Tombstones.Oldest = &oldest
+			}
+			if report.Config.DeleteRetentionMs >= 0 && now.Sub(l.timestamp) > retention {
+				report.Tombstones.Expired++
+				p.ExpiredTombstones++
+			}
+			if overdue > 0 && now.Sub(l.timestamp) > overdue {
+				report.Tombstones.Overdue++
+				p.OverdueTombstones++
+				report.Tombstones.OverdueKeys = append(report.Tombstones.OverdueKeys, key)
+			}
+		}
+		report.Partitions = append(report.Partitions, *p)
+	}
+
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		return report.Partitions[i].Partition < report.Partitions[j].Partition
+	})
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Records != top[j].Records {
+			return top[i].Records > top[j].Records
+		}
+		return top[i].Key < top[j].Key
+	})
+	report.Duplicates.TopKeys = append([]KeyCount{}, top[:min(len(top), maxListed)]...)
+
+	sort.Strings(report.Tombstones.OverdueKeys)
+	report.Tombstones.OverdueKeys = append([]string{}, report.Tombstones.OverdueKeys[:min(len(report.Tombstones.OverdueKeys), maxListed)]...)
+
+	if keyed := report.Records - report.KeylessRecords; keyed > 0 {
+		report.Duplicates.DirtyRatio = float64(report.Duplicates.Records) / float64(keyed)
+	}
+	if report.Bytes > 0 {
+		report.Duplicates.ByteDirtyRatio = float64(report.Duplicates.Bytes) / float64(report.Bytes)
+	}
+}
+
+// overdueAfter is the age after which the cleaner must have removed a
+// tombstone, 0 when it has no deadline
+func overdueAfter(config TopicConfig) time.Duration {
+	if config.DeleteRetentionMs < 0 || config.SegmentMs < 0 || config.MaxCompactionLagMs < 0 {
+		return 0
+	}
+	ms := config.DeleteRetentionMs + config.SegmentMs + config.MaxCompactionLagMs
+	if ms < 0 || ms > int64(math.MaxInt64/time.Millisecond) {
+		// The default max.compaction.lag.ms is unbounded
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// warn lists the findings that do not fail the audit
+func (r *Report) warn() []string {
+	warnings := []string{}
+	if n := r.Tombstones.Expired - r.Tombstones.Overdue; n > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d tombstones are older than delete.retention.ms (%d ms), the cleaner removes them after it compacted their segment",
+			n, r.Config.DeleteRetentionMs))
+	}
+	return warnings
+}
+
+// check compares the report with the thresholds, negative thresholds are disabled
+func (r *Report) check(maxDirtyRatio float64, maxOverdue, maxKeyless int) []string {
+	violations := []string{}
+	if !r.Compacted {
+		violations = append(violations, fmt.Sprintf("cleanup.policy is %q, not compact", r.Config.CleanupPolicy))
+	}
+	if !r.Complete {
+		violations = append(violations, "scan did not reach the end offset of every partition")
+	}
+	if maxDirtyRatio >= 0 && r.Duplicates.DirtyRatio > maxDirtyRatio {
+		violations = append(violations, fmt.Sprintf("dirty ratio %.4f exceeds %.4f", r.Duplicates.DirtyRatio, maxDirtyRatio))
+	}
+	if maxOverdue >= 0 && r.Tombstones.Overdue > int64(maxOverdue) {
+		violations = append(violations, fmt.Sprintf("%d tombstones are older than delete.retention.ms plus segment.ms and max.compaction.lag.ms (%s), at most %d allowed",
+			r.Tombstones.Overdue, overdueAfter(r.Config), maxOverdue))
+	}
+	if maxKeyless >= 0 && r.KeylessRecords > int64(maxKeyless) {
+		violations = append(violations, fmt.Sprintf("%d records have no key, at most %d allowed", r.KeylessRecords, maxKeyless))
+	}
+	return violations
+}
+
+// topicConfig reads the effective compaction settings of topic
+func topicConfig(ctx context.Context, admin *kadm.Client, topic string) (TopicConfig, error) {
+	configs, err := admin.DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return TopicConfig{}, fmt.Errorf("describing topic config: %w", err)
+	}
+	rc, err := configs.On(topic, nil)
+	if err == nil {
+		err = rc.Err
+	}
+	if err != nil {
+		return TopicConfig{}, fmt.Errorf("describing topic config: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, c := range rc.Configs {
+		if c.Value != nil {
+			values[c.Key] = *c.Value
+		}
+	}
+
+	// Brokers that omit a config fall back to Kafka's defaults
+	config := TopicConfig{
+		CleanupPolicy:          values["cleanup.policy"],
+		DeleteRetentionMs:      parseInt(values["delete.retention.ms"], 86400000),
+		MinCleanableDirtyRatio: 0.5,
+		SegmentMs:              parseInt(values["segment.ms"], 604800000),
+		MinCompactionLagMs:     parseInt(values["min.compaction.lag.ms"], 0),
+		MaxCompactionLagMs:     parseInt(values["max.compaction.lag.ms"], math.MaxInt64),
+	}
+	if ratio, err := strconv.ParseFloat(values["min.cleanable.dirty.ratio"], 64); err == nil {
+		config.MinCleanableDirtyRatio = ratio
+	}
+	return config, nil
+}
+
+func parseInt(s string, defaultValue int64) int64 {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	return defaultValue
+}
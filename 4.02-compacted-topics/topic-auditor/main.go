@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"kafkaclient"
+	"kafkaobs"
+)
+
+func main() {
+	code, err := run()
+	if err != nil {
+		slog.Error("topic-auditor failed", "err", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func run() (int, error) {
+	app := kafkaobs.New("topic-auditor")
+	app.BindFlags(flag.CommandLine)
+	brokers := flag.String("brokers", "", "comma-separated seed brokers, overrides KAFKA_BROKERS")
+	topic := flag.String("topic", "user-profiles", "compacted topic to audit")
+	idle := flag.Duration("idle-timeout", 5*time.Second, "stop scanning a partition when nothing arrives from it for this long, it is reported incomplete unless its end was reached")
+	out := flag.String("out", "", "output file, defaults to stdout")
+	maxDirtyRatio := flag.Float64("max-dirty-ratio", -1, "fail when more than this fraction of keyed records is superseded (-1 disables)")
+	maxOverdue := flag.Int("max-overdue-tombstones", -1, "fail when more tombstones are older than delete.retention.ms plus segment.ms and max.compaction.lag.ms (-1 disables)")
+	maxKeyless := flag.Int("max-keyless", -1, "fail when more records have no key (-1 disables)")
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return 0, err
+	}
+	logger := app.Logger.With("topic", *topic)
+	logger.Info("auditing topic")
+
+	ctx := context.Background()
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return 0, err
+	}
+	if *brokers != "" {
+		cfg.Brokers = splitList(*brokers)
+	}
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	report, err := audit(ctx, logger, append(opts, app.Opts()...), *topic, *idle)
+	if err != nil {
+		return 0, err
+	}
+
+	report.Warnings = report.warn()
+	report.Violations = report.check(*maxDirtyRatio, *maxOverdue, *maxKeyless)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return 0, fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return 0, fmt.Errorf("writing report: %w", err)
+	}
+
+	logger.Info("audited topic", "records", report.Records, "keys", report.View.Keys,
+		"dirty_ratio", report.Duplicates.DirtyRatio, "expired_tombstones", report.Tombstones.Expired,
+		"overdue_tombstones", report.Tombstones.Overdue, "keyless", report.KeylessRecords)
+	for _, w := range report.Warnings {
+		logger.Warn("audit warning", "warning", w)
+	}
+
+	if len(report.Violations) > 0 {
+		for _, v := range report.Violations {
+			logger.Error("audit failed", "violation", v)
+		}
+		return 2, nil
+	}
+	logger.Info("audit passed")
+	return 0, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// currentACLs lists every ACL of the cluster
+func currentACLs(ctx context.Context, cl *kgo.Client) ([]ACL, error) {
+	filter := kadm.NewACLs().
+		AnyResource().
+		ResourcePatternType(kadm.ACLPatternAny).
+		Allow().AllowHosts().
+		Deny().DenyHosts().
+		Operations()
+	results, err := kadm.NewClient(cl).DescribeACLs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("describing ACLs: %w", err)
+	}
+
+	var acls []ACL
+	for _, r := range results {
+		if r.Err != nil {
+			switch {
+			case errors.Is(r.Err, kerr.SecurityDisabled):
+				return nil, errors.New("the cluster has no authorizer configured, ACLs are disabled")
+			case errors.Is(r.Err, kerr.ClusterAuthorizationFailed):
+				return nil, errors.New("not allowed to describe ACLs, connect as a super user like admin")
+			}
+			return nil, fmt.Errorf("describing ACLs: %w%s", r.Err, errMessage(&r.ErrMessage))
+		}
+		for _, d := range r.Described {
+			acls = append(acls, ACL{
+				Principal:  d.Principal,
+				Host:       d.Host,
+				Type:       d.Type,
+				Name:       d.Name,
+				Pattern:    d.Pattern,
+				Operation:  d.Operation,
+				Permission: d.Permission,
+			})
+		}
+	}
+	slices.SortFunc(acls, compareACLs)
+	return slices.Compact(acls), nil
+}
+
+// createACLs creates the ACLs in a single request
+func createACLs(ctx context.Context, cl *kgo.Client, acls []ACL) error {
+	if len(acls) == 0 {
+		return nil
+	}
+	req := kmsg.NewPtrCreateACLsRequest()
+	for _, a := range acls {
+		c := kmsg.NewCreateACLsRequestCreation()
+		c.ResourceType = a.Type
+		c.ResourceName = a.Name
+		c.ResourcePatternType = a.Pattern
+		c.Principal = a.Principal
+		c.Host = a.Host
+		c.Operation = a.Operation
+		c.PermissionType = a.Permission
+		req.Creations = append(req.Creations, c)
+	}
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return fmt.Errorf("creating ACLs: %w", err)
+	}
+
+	var errs []error
+	for i, r := range resp.Results {
+		if err := kerr.ErrorForCode(r.ErrorCode); err != nil {
+			errs = append(errs, fmt.Errorf("creating %s: %w%s", acls[i], err, errMessage(r.ErrorMessage)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteACLs deletes exactly the given ACLs, each filter names every field so
+// it cannot match more than one binding
+func deleteACLs(ctx context.Context, cl *kgo.Client, acls []ACL) error {
+	if len(acls) == 0 {
+		return nil
+	}
+	req := kmsg.NewPtrDeleteACLsRequest()
+	for _, a := range acls {
+		f := kmsg.NewDeleteACLsRequestFilter()
+		f.ResourceType = a.Type
+		f.ResourceName = kmsg.StringPtr(a.Name)
+		f.ResourcePatternType = a.Pattern
+		f.Principal = kmsg.StringPtr(a.Principal)
+		f.Host = kmsg.StringPtr(a.Host)
+		f.Operation = a.Operation
+		f.PermissionType = a.Permission
+		req.Filters = append(req.Filters, f)
+	}
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return fmt.Errorf("deleting ACLs: %w", err)
+	}
+
+	var errs []error
+	for i, r := range resp.Results {
+		if err := kerr.ErrorForCode(r.ErrorCode); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s: %w%s", acls[i], err, errMessage(r.ErrorMessage)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AuthorizerSettings are the broker settings that decide requests no ACL
+// allows or denies
+type AuthorizerSettings struct {
+	SuperUsers        []string
+	AllowIfNoACLFound bool
+}
+
+// authorizerSettings reads super.users and allow.everyone.if.no.acl.found
+// from a broker. Both are static configs, which brokers only return to
+// principals allowed to describe the cluster configs.
+func authorizerSettings(ctx context.Context, cl *kgo.Client) (AuthorizerSettings, error) {
+	adm := kadm.NewClient(cl)
+	brokers, err := adm.ListBrokers(ctx)
+	if err != nil {
+		return AuthorizerSettings{}, err
+	}
+	if len(brokers) == 0 {
+		return AuthorizerSettings{}, errors.New("no brokers")
+	}
+	// Every broker of the exercise clusters has the same authorizer settings
+	configs, err := adm.DescribeBrokerConfigs(ctx, brokers[0].NodeID)
+	if err != nil {
+		return AuthorizerSettings{}, err
+	}
+	rc, err := configs.On(strconv.Itoa(int(brokers[0].NodeID)), nil)
+	if err != nil || rc.Err != nil {
+		return AuthorizerSettings{}, cmp.Or(err, rc.Err)
+	}
+	var settings AuthorizerSettings
+	for _, c := range rc.Configs {
+		switch c.Key {
+		case "super.users":
+			settings.SuperUsers = splitSuperUsers(c.MaybeValue())
+		case "allow.everyone.if.no.acl.found":
+			settings.AllowIfNoACLFound = c.MaybeValue() == "true"
+		}
+	}
+	return settings, nil
+}
+
+// splitSuperUsers splits super.users, which is separated by semicolons
+func splitSuperUsers(s string) []string {
+	var users []string
+	for _, u := range strings.Split(s, ";") {
+		if u = strings.TrimSpace(u); u != "" {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+func errMessage(msg *string) string {
+	if msg == nil || *msg == "" {
+		return ""
+	}
+	return ": " + *msg
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Request is an operation a principal attempts on a resource
+type Request struct {
+	Principal string
+	Host      string
+	Type      kmsg.ACLResourceType
+	Name      string
+	Operation kmsg.ACLOperation
+}
+
+func (r Request) String() string {
+	return fmt.Sprintf("%s %s on %s %s from %s", r.Principal, r.Operation, r.Type, r.Name, r.Host)
+}
+
+// Decision is the outcome of authorizing a request and why
+type Decision struct {
+	Allowed bool
+	Reason  string
+	// Matched are the ACLs that decided the request
+	Matched []ACL
+	// Related are other ACLs of the principal on the same resource type,
+	// shown as hints when the request is denied
+	Related []ACL
+}
+
+// impliedBy lists the operations an ALLOW ACL also grants: any of them
+// implies DESCRIBE, and ALTER_CONFIGS implies DESCRIBE_CONFIGS
+var impliedBy = map[kmsg.ACLOperation][]kmsg.ACLOperation{
+	kmsg.ACLOperationDescribe: {
+		kmsg.ACLOperationRead, kmsg.ACLOperationWrite, kmsg.ACLOperationDelete, kmsg.ACLOperationAlter,
+	},
+	kmsg.ACLOperationDescribeConfigs: {kmsg.ACLOperationAlterConfigs},
+}
+
+// authorize evaluates a request the way the Kafka authorizer does: super
+// users may do anything, a matching DENY wins over any ALLOW, and without
+// a matching ALLOW the request is denied, unless no ACL exists for the
+// resource at all and allow.everyone.if.no.acl.found is set
+func authorize(acls []ACL, settings AuthorizerSettings, req Request) Decision {
+	if slices.Contains(settings.SuperUsers, req.Principal) {
+		return Decision{Allowed: true, Reason: req.Principal + " is a super user, ACLs are not checked"}
+	}
+
+	var resourceACLs, denies, allows, related []ACL
+	for _, a := range acls {
+		if !matchesResource(a, req) {
+			if a.Principal == req.Principal && a.Type == req.Type {
+				related = append(related, a)
+			}
+			continue
+		}
+		resourceACLs = append(resourceACLs, a)
+		if !matchesPrincipal(a, req) || (a.Host != "*" && a.Host != req.Host) {
+			if a.Principal == req.Principal {
+				related = append(related, a)
+			}
+			continue
+		}
+		switch {
+		case a.Permission == kmsg.ACLPermissionTypeDeny && (a.Operation == req.Operation || a.Operation == kmsg.ACLOperationAll):
+			denies = append(denies, a)
+		case a.Permission == kmsg.ACLPermissionTypeAllow && grants(a.Operation, req.Operation):
+			allows = append(allows, a)
+		default:
+			related = append(related, a)
+		}
+	}
+
+	switch {
+	case len(denies) > 0:
+		return Decision{Reason: "denied by an ACL, DENY wins over ALLOW", Matched: denies}
+	case len(allows) > 0:
+		return Decision{Allowed: true, Reason: "allowed by an ACL", Matched: allows}
+	case len(resourceACLs) == 0 && settings.AllowIfNoACLFound:
+		return Decision{Allowed: true, Reason: "no ACL exists for the resource and allow.everyone.if.no.acl.found is true"}
+	default:
+		return Decision{Reason: fmt.Sprintf("no ACL allows %s on %s %s", req.Operation, req.Type, req.Name), Related: related}
+	}
+}
+
+// matchesResource reports whether an ACL applies to the resource: literal
+// names match exactly or with the wildcard *, prefixed names match any
+// resource that starts with them
+func matchesResource(a ACL, req Request) bool {
+	if a.Type != req.Type {
+		return false
+	}
+	switch a.Pattern {
+	case kmsg.ACLResourcePatternTypeLiteral:
+		return a.Name == req.Name || a.Name == "*"
+	case kmsg.ACLResourcePatternTypePrefixed:
+		return strings.HasPrefix(req.Name, a.Name)
+	}
+	return false
+}
+
+// matchesPrincipal also accepts the wildcard principal User:*
+func matchesPrincipal(a ACL, req Request) bool {
+	return a.Principal == req.Principal || (a.Principal == "User:*" && strings.HasPrefix(req.Principal, "User:"))
+}
+
+func grants(acl, requested kmsg.ACLOperation) bool {
+	return acl == requested || acl == kmsg.ACLOperationAll || slices.Contains(impliedBy[requested], acl)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"kafkaclient"
+	"kafkaobs"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const usage = `acl-manager keeps the ACLs of a cluster in line with a policy file.
+
+Usage:
+  acl-manager plan      show the changes that apply would make
+  acl-manager apply     create missing ACLs, and delete extra ones with -prune
+  acl-manager explain   tell whether a principal may perform an operation
+
+The connection is configured like the other Go programs, see shared/kafkaclient.
+Run acl-manager <command> -h for the flags of a command.
+`
+
+// exitChanges is returned by plan when the cluster differs from the policy,
+// and by explain when the request is denied
+const exitChanges = 2
+
+func main() {
+	code, err := run(os.Args[1:])
+	if err != nil {
+		slog.Error("acl-manager failed", "err", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func run(args []string) (int, error) {
+	app := kafkaobs.New("acl-manager")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 0, errors.New("missing command")
+	}
+	switch args[0] {
+	case "plan":
+		return planCmd(app, args[1:], false)
+	case "apply":
+		return planCmd(app, args[1:], true)
+	case "explain":
+		return explainCmd(app, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 0, fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// parseFlags parses the flags of a command, with the log flags of kafkaobs,
+// and installs the logger. Results go to stdout, logs to stderr.
+func parseFlags(app *kafkaobs.App, fs *flag.FlagSet, args []string) error {
+	app.BindFlags(fs)
+	fs.Parse(args)
+	return app.StartLogging()
+}
+
+func planCmd(app *kafkaobs.App, args []string, apply bool) (int, error) {
+	name := "plan"
+	if apply {
+		name = "apply"
+	}
+	fs := flag.NewFlagSet("acl-manager "+name, flag.ExitOnError)
+	policyPath := fs.String("policy", "policy.yaml", "policy file")
+	prune := fs.Bool("prune", false, "delete ACLs of principals in the policy that the policy does not list")
+	pruneAll := fs.Bool("prune-all", false, "delete every ACL that is not in the policy, including those of other principals")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for the admin requests")
+	if err := parseFlags(app, fs, args); err != nil {
+		return 0, err
+	}
+	logger := app.Logger
+
+	mode := PruneNone
+	switch {
+	case *pruneAll:
+		mode = PruneAll
+	case *prune:
+		mode = PruneManaged
+	}
+
+	policy, err := loadPolicy(*policyPath)
+	if err != nil {
+		return 0, err
+	}
+	desired, _ := policy.ACLs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cl, err := connect(ctx, app)
+	if err != nil {
+		return 0, err
+	}
+	defer cl.Close()
+
+	current, err := currentACLs(ctx, cl)
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("compared the policy with the cluster", "policy", *policyPath, "policy_acls", len(desired), "cluster_acls", len(current))
+
+	plan := diff(policy, desired, current, mode)
+	plan.Print(os.Stdout)
+
+	if plan.Empty() {
+		logger.Info("the cluster matches the policy")
+		return 0, nil
+	}
+	if !apply {
+		return exitChanges, nil
+	}
+
+	if err := createACLs(ctx, cl, plan.Create); err != nil {
+		return 0, err
+	}
+	if err := deleteACLs(ctx, cl, plan.Delete); err != nil {
+		return 0, err
+	}
+	logger.Info("applied the plan", "created", len(plan.Create), "deleted", len(plan.Delete))
+	return 0, nil
+}
+
+func explainCmd(app *kafkaobs.App, args []string) (int, error) {
+	fs := flag.NewFlagSet("acl-manager explain", flag.ExitOnError)
+	principal := fs.String("principal", "", "principal to check, e.g. User:consumer-app")
+	operation := fs.String("operation", "", "operation, e.g. Read, Write, Describe or IdempotentWrite")
+	topic := fs.String("topic", "", "topic resource")
+	group := fs.String("group", "", "consumer group resource")
+	txnID := fs.String("transactional-id", "", "transactional ID resource")
+	cluster := fs.Bool("cluster", false, "the cluster resource")
+	host := fs.String("host", "*", "client address, ACLs restricted to other hosts don't apply")
+	policyPath := fs.String("policy", "", "explain against this policy file instead of the cluster's ACLs")
+	superUsers := fs.String("super-users", "", "semicolon-separated super users, added to those read from the broker")
+	allowIfNoACL := fs.Bool("allow-if-no-acl", false, "allow.everyone.if.no.acl.found, read from the broker when explaining against the cluster")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for the admin requests")
+	if err := parseFlags(app, fs, args); err != nil {
+		return 0, err
+	}
+
+	if err := validatePrincipal(*principal); err != nil {
+		return 0, err
+	}
+	op, err := kmsg.ParseACLOperation(*operation)
+	if err != nil || op == kmsg.ACLOperationAny || op == kmsg.ACLOperationAll {
+		return 0, fmt.Errorf("unknown operation %q", *operation)
+	}
+	req := Request{Principal: *principal, Host: *host, Operation: op}
+	resources := 0
+	for _, r := range []struct {
+		value string
+		typ   kmsg.ACLResourceType
+	}{
+		{*topic, kmsg.ACLResourceTypeTopic},
+		{*group, kmsg.ACLResourceTypeGroup},
+		{*txnID, kmsg.ACLResourceTypeTransactionalId},
+	} {
+		if r.value != "" {
+			req.Type, req.Name = r.typ, r.value
+			resources++
+		}
+	}
+	if *cluster {
+		req.Type, req.Name = kmsg.ACLResourceTypeCluster, clusterName
+		resources++
+	}
+	if resources != 1 {
+		return 0, errors.New("name exactly one resource with -topic, -group, -transactional-id or -cluster")
+	}
+
+	settings := AuthorizerSettings{SuperUsers: splitSuperUsers(*superUsers), AllowIfNoACLFound: *allowIfNoACL}
+	var acls []ACL
+	if *policyPath != "" {
+		policy, err := loadPolicy(*policyPath)
+		if err != nil {
+			return 0, err
+		}
+		acls, _ = policy.ACLs()
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		cl, err := connect(ctx, app)
+		if err != nil {
+			return 0, err
+		}
+		defer cl.Close()
+
+		if acls, err = currentACLs(ctx, cl); err != nil {
+			return 0, err
+		}
+		if broker, err := authorizerSettings(ctx, cl); err != nil {
+			app.Logger.Warn("could not read the authorizer settings of the broker, using the flags", "err", err)
+		} else {
+			settings.SuperUsers = append(settings.SuperUsers, broker.SuperUsers...)
+			settings.AllowIfNoACLFound = broker.AllowIfNoACLFound
+		}
+	}
+
+	fmt.Printf("Request: %s\n", req)
+	decision := authorize(acls, settings, req)
+	if decision.Allowed {
+		fmt.Printf("ALLOWED: %s\n", decision.Reason)
+	} else {
+		fmt.Printf("DENIED: %s\n", decision.Reason)
+	}
+	for _, a := range decision.Matched {
+		fmt.Printf("   %s\n", a)
+	}
+	if len(decision.Related) > 0 {
+		fmt.Printf("\nOther ACLs of %s on %s resources:\n", req.Principal, req.Type)
+		for _, a := range decision.Related {
+			fmt.Printf("   %s\n", a)
+		}
+	}
+
+	if !decision.Allowed {
+		return exitChanges, nil
+	}
+	return 0, nil
+}
+
+// connect creates a client and checks that the cluster is reachable,
+// so wrong credentials fail fast instead of when listing ACLs
+func connect(ctx context.Context, app *kafkaobs.App) (*kgo.Client, error) {
+	opts, err := kafkaclient.Options(ctx, "localhost:9092")
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(append(opts, app.Opts()...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Kafka: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// PruneMode decides which ACLs missing from the policy are deleted
+type PruneMode int
+
+const (
+	// PruneNone only creates ACLs
+	PruneNone PruneMode = iota
+	// PruneManaged also deletes ACLs of principals listed in the policy
+	PruneManaged
+	// PruneAll deletes every ACL that is not in the policy
+	PruneAll
+)
+
+// Plan is the difference between the policy and the cluster
+type Plan struct {
+	Create    []ACL
+	Delete    []ACL
+	Unchanged int
+	// Extra are ACLs of principals in the policy that the policy does not
+	// list, kept because pruning is off
+	Extra []ACL
+	// Unmanaged are ACLs of principals the policy does not list
+	Unmanaged []ACL
+}
+
+// diff compares the desired ACLs of the policy with the current ACLs
+func diff(policy *Policy, desired, current []ACL, prune PruneMode) *Plan {
+	plan := &Plan{}
+	for _, a := range desired {
+		if slices.Contains(current, a) {
+			plan.Unchanged++
+		} else {
+			plan.Create = append(plan.Create, a)
+		}
+	}
+	for _, a := range current {
+		if slices.Contains(desired, a) {
+			continue
+		}
+		switch managed := policy.Managed(a.Principal); {
+		case prune == PruneAll, managed && prune == PruneManaged:
+			plan.Delete = append(plan.Delete, a)
+		case managed:
+			plan.Extra = append(plan.Extra, a)
+		default:
+			plan.Unmanaged = append(plan.Unmanaged, a)
+		}
+	}
+	return plan
+}
+
+// Empty reports whether applying the plan changes nothing
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Delete) == 0
+}
+
+// Print writes the changes, followed by the ACLs that are kept although the
+// policy does not list them
+func (p *Plan) Print(w io.Writer) {
+	if p.Empty() {
+		fmt.Fprintln(w, "  no changes")
+	}
+	for _, a := range p.Create {
+		fmt.Fprintf(w, "  + %s\n", a)
+	}
+	for _, a := range p.Delete {
+		fmt.Fprintf(w, "  - %s\n", a)
+	}
+	if len(p.Extra) > 0 {
+		fmt.Fprintf(w, "\n%d ACLs of principals in the policy are not listed in it, -prune deletes them:\n", len(p.Extra))
+		for _, a := range p.Extra {
+			fmt.Fprintf(w, "  ~ %s\n", a)
+		}
+	}
+	if len(p.Unmanaged) > 0 {
+		fmt.Fprintf(w, "\n%d ACLs of principals not in the policy are left alone, -prune-all deletes them:\n", len(p.Unmanaged))
+		for _, a := range p.Unmanaged {
+			fmt.Fprintf(w, "  ? %s\n", a)
+		}
+	}
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to delete, %d unchanged\n", len(p.Create), len(p.Delete), p.Unchanged)
+}
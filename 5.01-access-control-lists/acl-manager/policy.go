@@ -0,0 +1,203 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"gopkg.in/yaml.v3"
+)
+
+// clusterName is the only name a CLUSTER resource can have
+const clusterName = "kafka-cluster"
+
+// Policy is the desired set of ACLs, grouped by principal
+type Policy struct {
+	Principals []PrincipalPolicy `yaml:"principals"`
+}
+
+// PrincipalPolicy lists what a principal may or may not do
+type PrincipalPolicy struct {
+	Name  string   `yaml:"name"`
+	Hosts []string `yaml:"hosts"`
+	Rules []Rule   `yaml:"rules"`
+}
+
+// Rule grants or denies operations on a resource
+type Rule struct {
+	Resource   string   `yaml:"resource"`
+	Name       string   `yaml:"name"`
+	Pattern    string   `yaml:"pattern"`
+	Permission string   `yaml:"permission"`
+	Operations []string `yaml:"operations"`
+	// Hosts overrides the hosts of the principal
+	Hosts []string `yaml:"hosts"`
+}
+
+// ACL is a single Kafka ACL binding. It is comparable, so ACLs can be used
+// as map keys when diffing.
+type ACL struct {
+	Principal  string
+	Host       string
+	Type       kmsg.ACLResourceType
+	Name       string
+	Pattern    kmsg.ACLResourcePatternType
+	Operation  kmsg.ACLOperation
+	Permission kmsg.ACLPermissionType
+}
+
+func (a ACL) String() string {
+	resource := a.Type.String() + " " + a.Name
+	if a.Pattern == kmsg.ACLResourcePatternTypePrefixed {
+		resource = a.Type.String() + " prefix " + a.Name
+	}
+	return fmt.Sprintf("%s %s %s on %s from %s", a.Principal, a.Permission, a.Operation, resource, a.Host)
+}
+
+// compareACLs orders ACLs by principal, resource and operation for stable output
+func compareACLs(a, b ACL) int {
+	return cmp.Or(
+		cmp.Compare(a.Principal, b.Principal),
+		cmp.Compare(a.Type, b.Type),
+		cmp.Compare(a.Name, b.Name),
+		cmp.Compare(a.Pattern, b.Pattern),
+		cmp.Compare(a.Permission, b.Permission),
+		cmp.Compare(a.Operation, b.Operation),
+		cmp.Compare(a.Host, b.Host),
+	)
+}
+
+// loadPolicy reads and validates a policy file
+func loadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policy := &Policy{}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(policy); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if _, err := policy.ACLs(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ACLs expands the policy into the ACL bindings it describes, sorted and
+// without duplicates
+func (p *Policy) ACLs() ([]ACL, error) {
+	var acls []ACL
+	var errs []error
+	seen := map[string]bool{}
+	for _, pp := range p.Principals {
+		if err := validatePrincipal(pp.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[pp.Name] {
+			errs = append(errs, fmt.Errorf("principal %s is listed twice", pp.Name))
+		}
+		seen[pp.Name] = true
+
+		for i, rule := range pp.Rules {
+			hosts := rule.Hosts
+			if len(hosts) == 0 {
+				hosts = pp.Hosts
+			}
+			if len(hosts) == 0 {
+				hosts = []string{"*"}
+			}
+			ruleACLs, err := rule.expand(pp.Name, hosts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s rule %d: %w", pp.Name, i+1, err))
+				continue
+			}
+			acls = append(acls, ruleACLs...)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(acls, compareACLs)
+	return slices.Compact(acls), nil
+}
+
+// Managed reports whether the policy lists the principal
+func (p *Policy) Managed(principal string) bool {
+	return slices.ContainsFunc(p.Principals, func(pp PrincipalPolicy) bool { return pp.Name == principal })
+}
+
+func (r Rule) expand(principal string, hosts []string) ([]ACL, error) {
+	resourceType, err := kmsg.ParseACLResourceType(r.Resource)
+	if err != nil || resourceType == kmsg.ACLResourceTypeAny {
+		return nil, fmt.Errorf("unknown resource %q, expected topic, group, cluster, transactional-id or delegation-token", r.Resource)
+	}
+	name := r.Name
+	if resourceType == kmsg.ACLResourceTypeCluster {
+		if name != "" && name != clusterName {
+			return nil, fmt.Errorf("the cluster resource is always named %s", clusterName)
+		}
+		name = clusterName
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s needs a name, use * for all", r.Resource)
+	}
+
+	pattern := kmsg.ACLResourcePatternTypeLiteral
+	switch strings.ToLower(r.Pattern) {
+	case "", "literal":
+	case "prefixed":
+		pattern = kmsg.ACLResourcePatternTypePrefixed
+	default:
+		return nil, fmt.Errorf("unknown pattern %q, expected literal or prefixed", r.Pattern)
+	}
+
+	permission := kmsg.ACLPermissionTypeAllow
+	switch strings.ToLower(r.Permission) {
+	case "", "allow":
+	case "deny":
+		permission = kmsg.ACLPermissionTypeDeny
+	default:
+		return nil, fmt.Errorf("unknown permission %q, expected allow or deny", r.Permission)
+	}
+
+	if len(r.Operations) == 0 {
+		return nil, errors.New("no operations")
+	}
+	var acls []ACL
+	for _, o := range r.Operations {
+		op, err := kmsg.ParseACLOperation(o)
+		if err != nil || op == kmsg.ACLOperationAny {
+			return nil, fmt.Errorf("unknown operation %q", o)
+		}
+		for _, host := range hosts {
+			acls = append(acls, ACL{
+				Principal:  principal,
+				Host:       host,
+				Type:       resourceType,
+				Name:       name,
+				Pattern:    pattern,
+				Operation:  op,
+				Permission: permission,
+			})
+		}
+	}
+	return acls, nil
+}
+
+func validatePrincipal(principal string) error {
+	kind, name, ok := strings.Cut(principal, ":")
+	if !ok || kind == "" || name == "" {
+		return fmt.Errorf("principal %q needs a type, like User:%s", principal, principal)
+	}
+	return nil
+}
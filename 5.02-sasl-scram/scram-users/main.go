@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"kafkaclient"
+	"kafkaobs"
+	"scramadmin"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const usage = `scram-users creates, rotates and deletes SCRAM users and keeps their
+passwords in a local secrets file.
+
+Usage:
+  scram-users create   add users with generated passwords
+  scram-users rotate   give users a new password, -window keeps the old one valid
+  scram-users finish   end rotation windows, so only the new password is valid
+  scram-users delete   remove users from the cluster and the secrets file
+  scram-users list     show the SCRAM users of the cluster and the secrets file
+  scram-users show     print the client settings of a user
+
+The admin connection is configured like the other Go programs, see shared/kafkaclient.
+Run scram-users <command> -h for the flags of a command.
+`
+
+const defaultSecrets = "scram-users.json"
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("scram-users failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	app := kafkaobs.New("scram-users")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("missing command")
+	}
+	switch args[0] {
+	case "create":
+		return createCmd(app, args[1:])
+	case "rotate":
+		return rotateCmd(app, args[1:])
+	case "finish":
+		return finishCmd(app, args[1:])
+	case "delete":
+		return deleteCmd(app, args[1:])
+	case "list":
+		return listCmd(app, args[1:])
+	case "show":
+		return showCmd(app, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// flags are shared by the commands that talk to the cluster
+type flags struct {
+	app     *kafkaobs.App
+	fs      *flag.FlagSet
+	secrets *string
+	timeout *time.Duration
+}
+
+func newFlags(app *kafkaobs.App, name string) flags {
+	fs := flag.NewFlagSet("scram-users "+name, flag.ExitOnError)
+	app.BindFlags(fs)
+	return flags{
+		app:     app,
+		fs:      fs,
+		secrets: fs.String("secrets", defaultSecrets, "file with the passwords of the managed users"),
+		timeout: fs.Duration("timeout", 30*time.Second, "timeout for the admin requests"),
+	}
+}
+
+// parse parses the flags and installs the logger. Results go to stdout,
+// what the commands did to stderr.
+func (f flags) parse(args []string) error {
+	f.fs.Parse(args)
+	return f.app.StartLogging()
+}
+
+// users returns the user arguments, at least one is required
+func (f flags) users() ([]string, error) {
+	if f.fs.NArg() == 0 {
+		return nil, fmt.Errorf("name the users, e.g. %s producer-app", f.fs.Name())
+	}
+	return f.fs.Args(), nil
+}
+
+func createCmd(app *kafkaobs.App, args []string) error {
+	f := newFlags(app, "create")
+	mechanisms := f.fs.String("mechanisms", scramadmin.SHA512+","+scramadmin.SHA256, "comma-separated mechanisms, clients are told to use the first")
+	iterations := f.fs.Int("iterations", scramadmin.DefaultIterations, "PBKDF2 iterations, 4096 to 16384")
+	length := f.fs.Int("length", scramadmin.DefaultPasswordLength, "length of the generated passwords")
+	verify := f.fs.Bool("verify", true, "log in as every new user afterwards")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	users, err := f.users()
+	if err != nil {
+		return err
+	}
+
+	return withManager(f, func(ctx context.Context, m *scramadmin.Manager) error {
+		m.Iterations = int32(*iterations)
+		m.PasswordLength = *length
+		for _, user := range users {
+			cred, err := m.Create(ctx, user, splitList(*mechanisms)...)
+			if err != nil {
+				return err
+			}
+			f.app.Logger.Info("created user", "user", user, "mechanisms", cred.Mechanisms)
+			if *verify {
+				if err := verifyLogin(ctx, f.app, user, cred.Mechanism, cred.Password); err != nil {
+					return err
+				}
+			}
+		}
+		f.app.Logger.Info("saved the passwords", "secrets", *f.secrets)
+		return nil
+	})
+}
+
+func rotateCmd(app *kafkaobs.App, args []string) error {
+	f := newFlags(app, "rotate")
+	window := f.fs.Duration("window", 0, "how long the old password stays valid, 0 replaces it at once")
+	iterations := f.fs.Int("iterations", 0, "PBKDF2 iterations, 0 keeps the count the user has")
+	length := f.fs.Int("length", scramadmin.DefaultPasswordLength, "length of the generated passwords")
+	verify := f.fs.Bool("verify", true, "log in with the new and, during a window, the old password afterwards")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	users, err := f.users()
+	if err != nil {
+		return err
+	}
+
+	return withManager(f, func(ctx context.Context, m *scramadmin.Manager) error {
+		m.Iterations = int32(*iterations)
+		m.PasswordLength = *length
+		for _, user := range users {
+			cred, err := m.Rotate(ctx, user, *window)
+			if err != nil {
+				return err
+			}
+			if prev := cred.Previous; prev != nil {
+				f.app.Logger.Info("rotated user, the old password stays valid", "user", user,
+					"mechanism", cred.Mechanism, "previous_mechanism", prev.Mechanism, "valid_until", prev.ValidUntil)
+			} else {
+				f.app.Logger.Info("rotated user, the old password is no longer valid", "user", user, "mechanism", cred.Mechanism)
+			}
+			if !*verify {
+				continue
+			}
+			if err := verifyLogin(ctx, f.app, user, cred.Mechanism, cred.Password); err != nil {
+				return err
+			}
+			if prev := cred.Previous; prev != nil {
+				if err := verifyLogin(ctx, f.app, user, prev.Mechanism, prev.Password); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func finishCmd(app *kafkaobs.App, args []string) error {
+	f := newFlags(app, "finish")
+	expired := f.fs.Bool("expired", false, "finish every rotation whose window has passed instead of naming users")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *expired && f.fs.NArg() > 0 {
+		return errors.New("either name users or use -expired")
+	}
+	var users []string
+	if !*expired {
+		var err error
+		if users, err = f.users(); err != nil {
+			return err
+		}
+	}
+
+	return withManager(f, func(ctx context.Context, m *scramadmin.Manager) error {
+		if *expired {
+			finished, err := m.FinishExpired(ctx, time.Now())
+			for _, user := range finished {
+				f.app.Logger.Info("finished the rotation", "user", user)
+			}
+			if err == nil && len(finished) == 0 {
+				f.app.Logger.Info("no rotation window has passed")
+			}
+			return err
+		}
+		for _, user := range users {
+			cred, err := m.Finish(ctx, user)
+			if err != nil {
+				return err
+			}
+			f.app.Logger.Info("finished the rotation, only the new password is valid", "user", user, "mechanism", cred.Mechanism)
+			if len(cred.Mechanisms) > 1 {
+				f.app.Logger.Warn("the user has credentials on other mechanisms, clients still have to use this one",
+					"user", user, "mechanism", cred.Mechanism, "mechanisms", cred.Mechanisms)
+			}
+		}
+		return nil
+	})
+}
+
+func deleteCmd(app *kafkaobs.App, args []string) error {
+	f := newFlags(app, "delete")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	users, err := f.users()
+	if err != nil {
+		return err
+	}
+
+	return withManager(f, func(ctx context.Context, m *scramadmin.Manager) error {
+		for _, user := range users {
+			if err := m.Delete(ctx, user); err != nil {
+				return err
+			}
+			f.app.Logger.Info("deleted user", "user", user)
+		}
+		return nil
+	})
+}
+
+func listCmd(app *kafkaobs.App, args []string) error {
+	f := newFlags(app, "list")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+
+	return withManager(f, func(ctx context.Context, m *scramadmin.Manager) error {
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			fmt.Println("no SCRAM users")
+			return nil
+		}
+		fmt.Printf("%-20s %-40s %s\n", "USER", "CLUSTER", "SECRETS FILE")
+		for _, s := range statuses {
+			var cluster []string
+			for _, info := range s.Cluster {
+				cluster = append(cluster, fmt.Sprintf("%s(%d)", info.Mechanism, info.Iterations))
+			}
+			if len(cluster) == 0 {
+				cluster = []string{"-"}
+			}
+			fmt.Printf("%-20s %-40s %s\n", s.User, strings.Join(cluster, " "), describeCredential(s.Credential))
+		}
+		return nil
+	})
+}
+
+func describeCredential(cred *scramadmin.Credential) string {
+	switch {
+	case cred == nil:
+		return "not managed"
+	case cred.Previous == nil:
+		return fmt.Sprintf("%s, rotated %s", cred.Mechanism, cred.RotatedAt.Local().Format(time.DateTime))
+	case time.Now().After(cred.Previous.ValidUntil):
+		return fmt.Sprintf("%s, window of %s ended %s", cred.Mechanism, cred.Previous.Mechanism, cred.Previous.ValidUntil.Local().Format(time.DateTime))
+	default:
+		return fmt.Sprintf("%s, %s valid until %s", cred.Mechanism, cred.Previous.Mechanism, cred.Previous.ValidUntil.Local().Format(time.DateTime))
+	}
+}
+
+func showCmd(app *kafkaobs.App, args []string) error {
+	fs := flag.NewFlagSet("scram-users show", flag.ExitOnError)
+	app.BindFlags(fs)
+	secretsPath := fs.String("secrets", defaultSecrets, "file with the passwords of the managed users")
+	format := fs.String("format", "properties", "properties, env or password")
+	fs.Parse(args)
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("name one user, e.g. scram-users show producer-app")
+	}
+	user := fs.Arg(0)
+
+	secrets, err := scramadmin.LoadSecrets(*secretsPath)
+	if err != nil {
+		return err
+	}
+	cred := secrets.Users[user]
+	if cred == nil {
+		return fmt.Errorf("%s is not in %s", user, *secretsPath)
+	}
+
+	switch *format {
+	case "properties":
+		fmt.Printf("security.protocol=%s\n", kafkaclient.SASLPlaintext)
+		fmt.Printf("sasl.mechanism=%s\n", cred.Mechanism)
+		fmt.Printf("sasl.jaas.config=org.apache.kafka.common.security.scram.ScramLoginModule required username=%q password=%q;\n", user, cred.Password)
+	case "env":
+		fmt.Printf("export KAFKA_SASL_MECHANISM=%s\n", cred.Mechanism)
+		fmt.Printf("export KAFKA_SASL_USERNAME=%s\n", user)
+		fmt.Printf("export KAFKA_SASL_PASSWORD=%s\n", cred.Password)
+	case "password":
+		// For KAFKA_SASL_PASSWORD_FILE, without a newline
+		fmt.Print(cred.Password)
+	default:
+		return fmt.Errorf("unknown format %q, expected properties, env or password", *format)
+	}
+	return nil
+}
+
+// withManager loads the secrets file, connects as admin and runs fn
+func withManager(f flags, fn func(context.Context, *scramadmin.Manager) error) error {
+	secrets, err := scramadmin.LoadSecrets(*f.secrets)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *f.timeout)
+	defer cancel()
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	cl, err := connect(ctx, f.app, cfg)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	return fn(ctx, scramadmin.NewManager(cl, secrets))
+}
+
+// verifyLogin connects like the admin connection, but as the user. New
+// credentials reach every broker through the metadata log, so the first
+// attempts may fail.
+func verifyLogin(ctx context.Context, app *kafkaobs.App, user, mechanism, password string) error {
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	cfg.SASL = kafkaclient.SASLConfig{Mechanism: mechanism, Username: user, Password: password}
+	if cfg.SecurityProtocol == kafkaclient.Plaintext || cfg.SecurityProtocol == kafkaclient.SSL {
+		return fmt.Errorf("cannot log in as %s over %s, the admin connection does not use SASL", user, cfg.SecurityProtocol)
+	}
+
+	for attempt := 1; ; attempt++ {
+		cl, err := connect(ctx, app, cfg)
+		if err == nil {
+			cl.Close()
+			app.Logger.Info("verified the login", "user", user, "mechanism", mechanism)
+			return nil
+		}
+		if attempt == 5 {
+			return fmt.Errorf("logging in as %s with %s: %w", user, mechanism, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("logging in as %s with %s: %w", user, mechanism, err)
+		case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+		}
+	}
+}
+
+// connect creates a client and checks that the cluster is reachable,
+// so wrong credentials fail fast instead of in the first admin request
+func connect(ctx context.Context, app *kafkaobs.App, cfg kafkaclient.Config) (*kgo.Client, error) {
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(append(opts, app.Opts()...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Kafka as %s: %w", cfg.SASL.Principal(), err)
+	}
+	return client, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package scramadmin
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// DefaultPasswordLength gives about 190 bits of entropy with passwordChars
+const DefaultPasswordLength = 32
+
+// MinPasswordLength is the shortest password GeneratePassword creates
+const MinPasswordLength = 16
+
+// passwordChars leaves out quotes, backslashes and other characters that
+// need escaping in sasl.jaas.config, shell variables and properties files
+const passwordChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+
+// GeneratePassword returns a random password of length characters, or
+// DefaultPasswordLength when length is zero
+func GeneratePassword(length int) (string, error) {
+	if length == 0 {
+		length = DefaultPasswordLength
+	}
+	if length < MinPasswordLength {
+		return "", fmt.Errorf("passwords need at least %d characters, got %d", MinPasswordLength, length)
+	}
+	max := big.NewInt(int64(len(passwordChars)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generating a password: %w", err)
+		}
+		b[i] = passwordChars[n.Int64()]
+	}
+	return string(b), nil
+}
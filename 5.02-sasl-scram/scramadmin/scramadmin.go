@@ -0,0 +1,342 @@
+// Package scramadmin manages the lifecycle of SCRAM users through the admin
+// API: it creates users with generated passwords, rotates and deletes them,
+// and keeps the current passwords in a local secrets file.
+//
+// Kafka stores one credential per user and mechanism, so a user cannot have
+// two valid passwords for the same mechanism. A rotation with a window sets
+// the new password on the other SCRAM mechanism and leaves the old one
+// untouched: clients that still have the old password keep logging in with
+// the old mechanism, while updated clients switch to the new mechanism and
+// password. Finishing the rotation replaces the old password as well.
+package scramadmin
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// SCRAM mechanisms, named like the Kafka client setting sasl.mechanism
+const (
+	SHA256 = "SCRAM-SHA-256"
+	SHA512 = "SCRAM-SHA-512"
+)
+
+// DefaultIterations is the PBKDF2 iteration count of new credentials, Kafka
+// accepts 4096 to 16384
+const DefaultIterations = 8192
+
+// Manager changes SCRAM credentials on the cluster and records the
+// passwords in the secrets file. The file is saved after every change that
+// succeeded on the cluster.
+type Manager struct {
+	adm     *kadm.Client
+	secrets *Secrets
+	// Iterations of new credentials. When zero, users are created with
+	// DefaultIterations and rotations keep the count the user has.
+	Iterations int32
+	// PasswordLength of generated passwords, DefaultPasswordLength when zero
+	PasswordLength int
+}
+
+// NewManager returns a manager that alters users with the client, which
+// must be authenticated as a principal allowed to alter the cluster
+func NewManager(cl *kgo.Client, secrets *Secrets) *Manager {
+	return &Manager{adm: kadm.NewClient(cl), secrets: secrets}
+}
+
+// UserStatus combines what the cluster and the secrets file know about a user
+type UserStatus struct {
+	User string
+	// Cluster are the mechanisms the cluster has credentials for
+	Cluster []kadm.CredInfo
+	// Credential is nil for users that are not in the secrets file
+	Credential *Credential
+}
+
+// Create adds a user with a generated password for the mechanisms, the first
+// mechanism is the one clients are told to use
+func (m *Manager) Create(ctx context.Context, user string, mechanisms ...string) (*Credential, error) {
+	if user == "" {
+		return nil, errors.New("a user needs a name")
+	}
+	if len(mechanisms) == 0 {
+		mechanisms = []string{SHA512, SHA256}
+	}
+	for _, mech := range mechanisms {
+		if _, err := parseMechanism(mech); err != nil {
+			return nil, err
+		}
+	}
+	if m.secrets.Users[user] != nil {
+		return nil, fmt.Errorf("%s is already in %s, rotate its password instead", user, m.secrets.path)
+	}
+	existing, err := m.describe(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("%s already has SCRAM credentials on the cluster that are not in %s, delete them first", user, m.secrets.path)
+	}
+
+	password, err := GeneratePassword(m.PasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	iterations := cmp.Or(m.Iterations, DefaultIterations)
+	if err := m.upsert(ctx, user, password, iterations, mechanisms...); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	cred := &Credential{
+		Mechanism:  mechanisms[0],
+		Password:   password,
+		Mechanisms: mechanisms,
+		CreatedAt:  now,
+		RotatedAt:  now,
+	}
+	m.secrets.Users[user] = cred
+	return cred, m.secrets.Save()
+}
+
+// Rotate gives the user a new password. Without a window the password of
+// every mechanism is replaced at once and clients with the old password
+// fail on their next login. With a window only the other mechanism gets the
+// new password, the old one stays valid until the rotation is finished.
+func (m *Manager) Rotate(ctx context.Context, user string, window time.Duration) (*Credential, error) {
+	cred, err := m.credential(user)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Previous != nil {
+		return nil, fmt.Errorf("the rotation of %s started at %s is not finished yet", user, cred.RotatedAt.Format(time.RFC3339))
+	}
+
+	password, err := GeneratePassword(m.PasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := m.iterations(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	if window <= 0 {
+		if err := m.upsert(ctx, user, password, iterations, cred.Mechanisms...); err != nil {
+			return nil, err
+		}
+		cred.Password = password
+		cred.RotatedAt = now
+		return cred, m.secrets.Save()
+	}
+
+	next := otherMechanism(cred.Mechanism)
+	if err := m.upsert(ctx, user, password, iterations, next); err != nil {
+		return nil, err
+	}
+	cred.Previous = &PreviousCredential{
+		Mechanism:  cred.Mechanism,
+		Password:   cred.Password,
+		ValidUntil: now.Add(window),
+	}
+	cred.Mechanism = next
+	cred.Password = password
+	cred.RotatedAt = now
+	if !slices.Contains(cred.Mechanisms, next) {
+		cred.Mechanisms = append(cred.Mechanisms, next)
+	}
+	return cred, m.secrets.Save()
+}
+
+// Finish ends the rotation window of the user: the old password is replaced
+// by the new one, so only the new password is valid on every mechanism
+func (m *Manager) Finish(ctx context.Context, user string) (*Credential, error) {
+	cred, err := m.credential(user)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Previous == nil {
+		return nil, fmt.Errorf("%s has no rotation in progress", user)
+	}
+	iterations, err := m.iterations(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.upsert(ctx, user, cred.Password, iterations, cred.Previous.Mechanism); err != nil {
+		return nil, err
+	}
+	cred.Previous = nil
+	return cred, m.secrets.Save()
+}
+
+// FinishExpired finishes every rotation whose window has passed and returns
+// the users it finished
+func (m *Manager) FinishExpired(ctx context.Context, now time.Time) ([]string, error) {
+	var finished []string
+	for _, user := range m.secrets.Sorted() {
+		prev := m.secrets.Users[user].Previous
+		if prev == nil || now.Before(prev.ValidUntil) {
+			continue
+		}
+		if _, err := m.Finish(ctx, user); err != nil {
+			return finished, err
+		}
+		finished = append(finished, user)
+	}
+	return finished, nil
+}
+
+// Delete removes every SCRAM credential of the user from the cluster and
+// the user from the secrets file
+func (m *Manager) Delete(ctx context.Context, user string) error {
+	infos, err := m.describe(ctx, user)
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 && m.secrets.Users[user] == nil {
+		return fmt.Errorf("%s has no SCRAM credentials", user)
+	}
+	// A user may only appear once per request
+	for _, info := range infos {
+		altered, err := m.adm.AlterUserSCRAMs(ctx, []kadm.DeleteSCRAM{{User: user, Mechanism: info.Mechanism}}, nil)
+		if err := alterError(altered, err); err != nil {
+			return fmt.Errorf("deleting the %s credential of %s: %w", info.Mechanism, user, err)
+		}
+	}
+	delete(m.secrets.Users, user)
+	return m.secrets.Save()
+}
+
+// Status lists the SCRAM users of the cluster and of the secrets file
+func (m *Manager) Status(ctx context.Context) ([]UserStatus, error) {
+	described, err := m.adm.DescribeUserSCRAMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("describing SCRAM users: %w", err)
+	}
+	byUser := map[string]*UserStatus{}
+	for _, d := range described {
+		if d.Err != nil {
+			return nil, fmt.Errorf("describing %s: %w", d.User, d.Err)
+		}
+		byUser[d.User] = &UserStatus{User: d.User, Cluster: d.CredInfos}
+	}
+	for user, cred := range m.secrets.Users {
+		if byUser[user] == nil {
+			byUser[user] = &UserStatus{User: user}
+		}
+		byUser[user].Credential = cred
+	}
+
+	var statuses []UserStatus
+	for _, s := range byUser {
+		statuses = append(statuses, *s)
+	}
+	slices.SortFunc(statuses, func(a, b UserStatus) int { return strings.Compare(a.User, b.User) })
+	return statuses, nil
+}
+
+func (m *Manager) credential(user string) (*Credential, error) {
+	cred := m.secrets.Users[user]
+	if cred == nil {
+		return nil, fmt.Errorf("%s is not in %s, only users created with this tool can be rotated", user, m.secrets.path)
+	}
+	return cred, nil
+}
+
+// describe returns the mechanisms the user has credentials for, none when
+// the user does not exist
+func (m *Manager) describe(ctx context.Context, user string) ([]kadm.CredInfo, error) {
+	described, err := m.adm.DescribeUserSCRAMs(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("describing %s: %w", user, err)
+	}
+	d := described[user]
+	if errors.Is(d.Err, kerr.ResourceNotFound) {
+		return nil, nil
+	}
+	if d.Err != nil {
+		return nil, fmt.Errorf("describing %s: %w", user, d.Err)
+	}
+	return d.CredInfos, nil
+}
+
+// iterations returns the count for a rotation: Iterations when it is set,
+// otherwise the highest count of the existing credentials
+func (m *Manager) iterations(ctx context.Context, user string) (int32, error) {
+	if m.Iterations != 0 {
+		return m.Iterations, nil
+	}
+	infos, err := m.describe(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	var iterations int32
+	for _, info := range infos {
+		iterations = max(iterations, info.Iterations)
+	}
+	return cmp.Or(iterations, DefaultIterations), nil
+}
+
+// upsert sets the password for each mechanism, one request per mechanism
+// because a user may only appear once per request
+func (m *Manager) upsert(ctx context.Context, user, password string, iterations int32, mechanisms ...string) error {
+	for _, name := range mechanisms {
+		mech, err := parseMechanism(name)
+		if err != nil {
+			return err
+		}
+		altered, err := m.adm.AlterUserSCRAMs(ctx, nil, []kadm.UpsertSCRAM{{
+			User:       user,
+			Mechanism:  mech,
+			Iterations: iterations,
+			Password:   password,
+		}})
+		if err := alterError(altered, err); err != nil {
+			return fmt.Errorf("setting the %s password of %s: %w", name, user, err)
+		}
+	}
+	return nil
+}
+
+func alterError(altered kadm.AlteredUserSCRAMs, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, a := range altered {
+		if a.Err != nil {
+			if a.ErrMessage != "" {
+				return fmt.Errorf("%w: %s", a.Err, a.ErrMessage)
+			}
+			return a.Err
+		}
+	}
+	return nil
+}
+
+func parseMechanism(name string) (kadm.ScramMechanism, error) {
+	switch strings.ToUpper(name) {
+	case SHA256:
+		return kadm.ScramSha256, nil
+	case SHA512:
+		return kadm.ScramSha512, nil
+	default:
+		return 0, fmt.Errorf("unknown SCRAM mechanism %q, expected %s or %s", name, SHA256, SHA512)
+	}
+}
+
+func otherMechanism(name string) string {
+	if strings.ToUpper(name) == SHA512 {
+		return SHA256
+	}
+	return SHA512
+}
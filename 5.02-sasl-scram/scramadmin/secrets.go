@@ -0,0 +1,109 @@
+package scramadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Credential is what a client needs to log in as a user
+type Credential struct {
+	// Mechanism clients should log in with, it holds the current password
+	Mechanism string `json:"mechanism"`
+	Password  string `json:"password"`
+	// Mechanisms the user has credentials for on the cluster
+	Mechanisms []string  `json:"mechanisms"`
+	CreatedAt  time.Time `json:"created_at"`
+	RotatedAt  time.Time `json:"rotated_at"`
+	// Previous is set during a rotation window
+	Previous *PreviousCredential `json:"previous,omitempty"`
+}
+
+// PreviousCredential is the password that stays valid on its mechanism until
+// the rotation is finished
+type PreviousCredential struct {
+	Mechanism  string    `json:"mechanism"`
+	Password   string    `json:"password"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// Secrets is the local file with the passwords of the managed users. It is
+// only readable by its owner and replaced atomically, so a crash never
+// leaves a half written file behind.
+type Secrets struct {
+	path  string
+	Users map[string]*Credential `json:"users"`
+}
+
+// LoadSecrets reads the secrets file, a missing file holds no users
+func LoadSecrets(path string) (*Secrets, error) {
+	s := &Secrets{path: path, Users: map[string]*Credential{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if s.Users == nil {
+		s.Users = map[string]*Credential{}
+	}
+	return s, nil
+}
+
+// Path is where the secrets are saved
+func (s *Secrets) Path() string {
+	return s.path
+}
+
+// Sorted returns the names of the users in order
+func (s *Secrets) Sorted() []string {
+	users := make([]string, 0, len(s.Users))
+	for user := range s.Users {
+		users = append(users, user)
+	}
+	slices.Sort(users)
+	return users
+}
+
+// Save writes the file with mode 0600 through a temporary file in the same
+// directory, which is renamed over the old one
+func (s *Secrets) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("saving %s: %w", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"cmp"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+const (
+	caCertFile = "ca-cert.pem"
+	caKeyFile  = "ca-key.pem"
+	caDBFile   = "ca-db.json"
+	crlFile    = "ca-crl.pem"
+)
+
+// Certificate types, they decide the extended key usage
+const (
+	TypeServer = "server"
+	TypeClient = "client"
+)
+
+// CA is a certificate authority kept in a directory: its certificate, its
+// encrypted key and a database of everything it issued
+type CA struct {
+	dir      string
+	password string
+	cert     *x509.Certificate
+	key      crypto.Signer
+	db       *Database
+}
+
+// Database records the issued certificates, revocations are published in the CRL
+type Database struct {
+	CRLNumber    int64     `json:"crlNumber"`
+	CRLURL       string    `json:"crlUrl,omitempty"`
+	Certificates []*Issued `json:"certificates"`
+}
+
+// Issued is a certificate issued by the CA
+type Issued struct {
+	Serial    string    `json:"serial"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Subject   string    `json:"subject"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	RevokedAt time.Time `json:"revokedAt,omitzero"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Revoked reports whether the certificate has been revoked
+func (i *Issued) Revoked() bool {
+	return !i.RevokedAt.IsZero()
+}
+
+// IssueRequest describes a certificate to issue
+type IssueRequest struct {
+	Name    string
+	Type    string
+	CN      string
+	SANs    []string
+	Days    int
+	KeyType string
+}
+
+// revocationReasons are the CRL reason codes of RFC 5280
+var revocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"caCompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"privilegeWithdrawn":   9,
+}
+
+// initCA creates a self-signed CA, it refuses to overwrite an existing one
+func initCA(dir, password, cn string, days int, keyType, crlURL string) (*CA, error) {
+	if _, err := os.Stat(filepath.Join(dir, caCertFile)); err == nil {
+		return nil, fmt.Errorf("a CA already exists in %s, remove it first to start over", dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Kafka Training"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(0, 0, days),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("creating CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ca := &CA{dir: dir, password: password, cert: cert, key: key, db: &Database{CRLURL: crlURL}}
+	if err := writePEM(filepath.Join(dir, caCertFile), "CERTIFICATE", der, 0o644); err != nil {
+		return nil, err
+	}
+	if err := writeEncryptedKey(filepath.Join(dir, caKeyFile), key, password); err != nil {
+		return nil, err
+	}
+	if err := ca.save(); err != nil {
+		return nil, err
+	}
+	return ca, ca.writeCRL(7)
+}
+
+// loadCA opens the CA in dir, the password decrypts its key
+func loadCA(dir, password string) (*CA, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA certificate, run init first: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no certificate found in %s", caCertFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA key: %w", err)
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no key found in %s", caKeyFile)
+	}
+	parsed, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting CA key (wrong password?): %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", parsed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, caDBFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA database: %w", err)
+	}
+	db := &Database{}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("parsing CA database: %w", err)
+	}
+
+	return &CA{dir: dir, password: password, cert: cert, key: key, db: db}, nil
+}
+
+// Issue creates a key and a certificate signed by the CA and records it
+func (ca *CA) Issue(req IssueRequest) (*x509.Certificate, crypto.Signer, error) {
+	if req.Name == "" {
+		return nil, nil, errors.New("a certificate needs a name")
+	}
+	if existing := ca.find(req.Name); existing != nil && !existing.Revoked() && time.Now().Before(existing.NotAfter) {
+		slog.Warn("the name already has a valid certificate, revoke it once the new one is deployed",
+			"name", req.Name, "serial", existing.Serial, "command", "certgen revoke "+existing.Serial)
+	}
+
+	template := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: cmp.Or(req.CN, req.Name), Organization: []string{"Kafka Training"}},
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().AddDate(0, 0, req.Days),
+		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	switch req.Type {
+	case TypeServer:
+		// Brokers also connect to each other as clients
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	case TypeClient:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		return nil, nil, fmt.Errorf("unknown certificate type %q, expected server or client", req.Type)
+	}
+	for _, san := range req.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	if req.Type == TypeServer && len(req.SANs) == 0 {
+		return nil, nil, errors.New("a server certificate needs at least one SAN, clients verify the hostname against them")
+	}
+	if ca.db.CRLURL != "" {
+		template.CRLDistributionPoints = []string{ca.db.CRLURL}
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+
+	key, err := generateKey(req.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Key encipherment only applies to RSA key exchange
+	if _, ok := key.(*rsa.PrivateKey); !ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ca.db.Certificates = append(ca.db.Certificates, &Issued{
+		Serial:    serialString(cert.SerialNumber),
+		Name:      req.Name,
+		Type:      req.Type,
+		Subject:   cert.Subject.String(),
+		SANs:      req.SANs,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	})
+	return cert, key, ca.save()
+}
+
+// Revoke marks certificates as revoked by serial or by name. A name with
+// more than one unrevoked certificate, e.g. after a rotation, is refused
+// unless all is set, the serial picks one of them. The CRL has to be
+// written afterwards to publish the revocation.
+func (ca *CA) Revoke(serialOrName, reason string, all bool) ([]*Issued, error) {
+	if _, ok := revocationReasons[reason]; !ok {
+		return nil, fmt.Errorf("unknown revocation reason %q", reason)
+	}
+
+	var matches []*Issued
+	for _, issued := range ca.db.Certificates {
+		if issued.Revoked() || (issued.Serial != strings.ToLower(serialOrName) && issued.Name != serialOrName) {
+			continue
+		}
+		matches = append(matches, issued)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no unrevoked certificate with serial or name %q", serialOrName)
+	}
+	if len(matches) > 1 && !all {
+		serials := make([]string, len(matches))
+		for i, issued := range matches {
+			serials[i] = issued.Serial
+		}
+		return nil, fmt.Errorf("%q has %d unrevoked certificates (serials %s), revoke one by serial or all of them with -all",
+			serialOrName, len(matches), strings.Join(serials, ", "))
+	}
+
+	now := time.Now().UTC()
+	for _, issued := range matches {
+		issued.RevokedAt = now
+		issued.Reason = reason
+	}
+	return matches, ca.save()
+}
+
+// writeCRL signs a CRL of all revoked certificates that has to be
+// republished within days
+func (ca *CA) writeCRL(days int) error {
+	ca.db.CRLNumber++
+	now := time.Now()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(ca.db.CRLNumber),
+		ThisUpdate: now,
+		NextUpdate: now.AddDate(0, 0, days),
+	}
+	for _, issued := range ca.db.Certificates {
+		if !issued.Revoked() {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(issued.Serial, 16)
+		if !ok {
+			return fmt.Errorf("invalid serial %q in CA database", issued.Serial)
+		}
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: issued.RevokedAt,
+			ReasonCode:     revocationReasons[issued.Reason],
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		return fmt.Errorf("signing CRL: %w", err)
+	}
+	if err := writePEM(filepath.Join(ca.dir, crlFile), "X509 CRL", der, 0o644); err != nil {
+		return err
+	}
+	return ca.save()
+}
+
+// Verify checks a certificate against the CA, the CRL and its validity period
+func (ca *CA) Verify(cert *x509.Certificate) error {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(ca.dir, crlFile))
+	if err != nil {
+		return fmt.Errorf("reading CRL: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no CRL found in %s", crlFile)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing CRL: %w", err)
+	}
+	if err := crl.CheckSignatureFrom(ca.cert); err != nil {
+		return fmt.Errorf("CRL is not signed by the CA: %w", err)
+	}
+	if time.Now().After(crl.NextUpdate) {
+		return fmt.Errorf("CRL expired at %s, run crl to publish a new one", crl.NextUpdate.Format(time.RFC3339))
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return fmt.Errorf("certificate %s was revoked at %s", serialString(cert.SerialNumber), entry.RevocationTime.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// find returns the newest certificate issued under name
+func (ca *CA) find(name string) *Issued {
+	for _, issued := range slices.Backward(ca.db.Certificates) {
+		if issued.Name == name {
+			return issued
+		}
+	}
+	return nil
+}
+
+func (ca *CA) save() error {
+	data, err := json.MarshalIndent(ca.db, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ca.dir, caDBFile), append(data, '\n'), 0o644)
+}
+
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa", "":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key type %q, expected rsa or ecdsa", keyType)
+	}
+}
+
+// randomSerial returns a positive 128 bit serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+func serialString(serial *big.Int) string {
+	return serial.Text(16)
+}
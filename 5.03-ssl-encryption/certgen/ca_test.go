@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const testPassword = "test-secret"
+
+func newTestCA(t *testing.T) *CA {
+	t.Helper()
+	ca, err := initCA(t.TempDir(), testPassword, "Test-CA", 30, "ecdsa", "")
+	if err != nil {
+		t.Fatalf("initCA: %v", err)
+	}
+	return ca
+}
+
+func issueTest(t *testing.T, ca *CA, req IssueRequest) *x509.Certificate {
+	t.Helper()
+	req.Days = 1
+	req.KeyType = "ecdsa"
+	cert, key, err := ca.Issue(req)
+	if err != nil {
+		t.Fatalf("issuing %s: %v", req.Name, err)
+	}
+	if _, err := ca.writeIssued(req.Name, cert, key); err != nil {
+		t.Fatalf("writing %s: %v", req.Name, err)
+	}
+	return cert
+}
+
+func TestIssue(t *testing.T) {
+	ca := newTestCA(t)
+
+	server := issueTest(t, ca, IssueRequest{Name: "kafka", Type: TypeServer, SANs: []string{"kafka", "127.0.0.1"}})
+	if got := describeSANs(server); got != "kafka, 127.0.0.1" {
+		t.Errorf("SANs = %q, want kafka, 127.0.0.1", got)
+	}
+	if len(server.ExtKeyUsage) != 2 {
+		t.Errorf("server certificate has ext key usages %v, want server and client auth", server.ExtKeyUsage)
+	}
+	client := issueTest(t, ca, IssueRequest{Name: "orders", Type: TypeClient, CN: "orders-service"})
+	if client.Subject.CommonName != "orders-service" {
+		t.Errorf("CN = %q, want orders-service", client.Subject.CommonName)
+	}
+
+	for _, cert := range []*x509.Certificate{server, client} {
+		if err := ca.Verify(cert); err != nil {
+			t.Errorf("verifying %s: %v", cert.Subject.CommonName, err)
+		}
+	}
+
+	if _, _, err := ca.Issue(IssueRequest{Name: "broker", Type: TypeServer, Days: 1}); err == nil {
+		t.Error("issued a server certificate without SANs")
+	}
+	if _, _, err := ca.Issue(IssueRequest{Name: "other", Type: "peer", Days: 1}); err == nil {
+		t.Error("issued a certificate of an unknown type")
+	}
+
+	// The database survives reopening the CA
+	reopened, err := loadCA(ca.dir, testPassword)
+	if err != nil {
+		t.Fatalf("loadCA: %v", err)
+	}
+	if n := len(reopened.db.Certificates); n != 2 {
+		t.Fatalf("reopened CA has %d certificates, want 2", n)
+	}
+	if issued := reopened.find("orders"); issued == nil || issued.Serial != serialString(client.SerialNumber) {
+		t.Errorf("find(orders) = %+v, want serial %s", issued, serialString(client.SerialNumber))
+	}
+	if _, err := loadCA(ca.dir, "wrong"); err == nil {
+		t.Error("loadCA accepted a wrong password")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca := newTestCA(t)
+	old := issueTest(t, ca, IssueRequest{Name: "orders", Type: TypeClient})
+	rotated := issueTest(t, ca, IssueRequest{Name: "orders", Type: TypeClient})
+	other := issueTest(t, ca, IssueRequest{Name: "payments", Type: TypeClient})
+
+	if _, err := ca.Revoke("orders", "unspecified", false); err == nil || !strings.Contains(err.Error(), "-all") {
+		t.Fatalf("revoking a name with two certificates: err = %v, want a request for a serial or -all", err)
+	}
+	if _, err := ca.Revoke(serialString(old.SerialNumber), "bogus", false); err == nil {
+		t.Error("revoked with an unknown reason")
+	}
+
+	revoked, err := ca.Revoke(strings.ToUpper(serialString(old.SerialNumber)), "superseded", false)
+	if err != nil {
+		t.Fatalf("revoking by serial: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0].Serial != serialString(old.SerialNumber) {
+		t.Fatalf("revoked %+v, want only serial %s", revoked, serialString(old.SerialNumber))
+	}
+	if _, err := ca.Revoke(serialString(old.SerialNumber), "superseded", false); err == nil {
+		t.Error("revoked the same certificate twice")
+	}
+
+	// Only the rotated certificate is left under the name
+	revoked, err = ca.Revoke("orders", "keyCompromise", false)
+	if err != nil {
+		t.Fatalf("revoking by name: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0].Serial != serialString(rotated.SerialNumber) {
+		t.Fatalf("revoked %+v, want only serial %s", revoked, serialString(rotated.SerialNumber))
+	}
+
+	issueTest(t, ca, IssueRequest{Name: "payments", Type: TypeClient})
+	revoked, err = ca.Revoke("payments", "cessationOfOperation", true)
+	if err != nil {
+		t.Fatalf("revoking all certificates of a name: %v", err)
+	}
+	if len(revoked) != 2 {
+		t.Errorf("revoked %d certificates of payments, want 2", len(revoked))
+	}
+
+	if err := ca.Verify(other); err != nil {
+		t.Errorf("revocation is not published until the CRL is written, got %v", err)
+	}
+	if err := ca.writeCRL(7); err != nil {
+		t.Fatalf("writeCRL: %v", err)
+	}
+	for _, cert := range []*x509.Certificate{old, rotated, other} {
+		if err := ca.Verify(cert); err == nil || !strings.Contains(err.Error(), "revoked") {
+			t.Errorf("verifying revoked %s: err = %v, want revoked", serialString(cert.SerialNumber), err)
+		}
+	}
+}
+
+func TestCRLRoundTrip(t *testing.T) {
+	ca := newTestCA(t)
+	cert := issueTest(t, ca, IssueRequest{Name: "orders", Type: TypeClient})
+	if _, err := ca.Revoke("orders", "keyCompromise", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.writeCRL(3); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(ca.dir, crlFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("%s holds no PEM CRL", crlFile)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("parsing CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(ca.cert); err != nil {
+		t.Errorf("CRL signature: %v", err)
+	}
+	// initCA publishes CRL 1, this is the second one
+	if crl.Number.Int64() != 2 || ca.db.CRLNumber != 2 {
+		t.Errorf("CRL number = %d, database has %d, want 2", crl.Number, ca.db.CRLNumber)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("CRL has %d entries, want 1", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Errorf("CRL revokes serial %s, want %s", serialString(entry.SerialNumber), serialString(cert.SerialNumber))
+	}
+	if entry.ReasonCode != revocationReasons["keyCompromise"] {
+		t.Errorf("reason code = %d, want %d", entry.ReasonCode, revocationReasons["keyCompromise"])
+	}
+}
+
+func TestStores(t *testing.T) {
+	ca := newTestCA(t)
+	cert := issueTest(t, ca, IssueRequest{Name: "client", Type: TypeClient})
+
+	data, err := os.ReadFile(filepath.Join(ca.dir, "client.keystore.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(data, testPassword)
+	if err != nil {
+		t.Fatalf("decoding keystore: %v", err)
+	}
+	if !leaf.Equal(cert) {
+		t.Error("keystore holds a different certificate")
+	}
+	if len(chain) != 1 || !chain[0].Equal(ca.cert) {
+		t.Error("keystore chain is not the CA certificate")
+	}
+	if !cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.(crypto.Signer).Public()) {
+		t.Error("keystore key does not match the certificate")
+	}
+
+	data, err = os.ReadFile(filepath.Join(ca.dir, "client.truststore.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := pkcs12.DecodeTrustStore(data, testPassword)
+	if err != nil {
+		t.Fatalf("decoding truststore: %v", err)
+	}
+	if len(trusted) != 1 || !trusted[0].Equal(ca.cert) {
+		t.Error("truststore does not hold the CA certificate")
+	}
+
+	data, err = os.ReadFile(filepath.Join(ca.dir, "client-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		t.Fatal("client-key.pem holds no encrypted key")
+	}
+	if _, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(testPassword)); err != nil {
+		t.Errorf("decrypting client-key.pem: %v", err)
+	}
+}
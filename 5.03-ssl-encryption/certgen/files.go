@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// writeIssued writes a certificate in every format the exercise needs:
+//
+//	<name>-cert.pem         certificate followed by the CA certificate
+//	<name>-key.pem          key as encrypted PKCS#8
+//	<name>.keystore.p12     key and chain for Kafka (Java) and other clients
+//	<name>.truststore.p12   CA certificate to verify the other side
+func (ca *CA) writeIssued(name string, cert *x509.Certificate, key crypto.Signer) ([]string, error) {
+	files := []string{name + "-cert.pem", name + "-key.pem", name + ".keystore.p12", name + ".truststore.p12"}
+	path := func(i int) string { return filepath.Join(ca.dir, files[i]) }
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	if err := os.WriteFile(path(0), chain, 0o644); err != nil {
+		return nil, err
+	}
+	if err := writeEncryptedKey(path(1), key, ca.password); err != nil {
+		return nil, err
+	}
+
+	keystore, err := pkcs12.Modern.Encode(key, cert, []*x509.Certificate{ca.cert}, ca.password)
+	if err != nil {
+		return nil, fmt.Errorf("encoding keystore: %w", err)
+	}
+	if err := os.WriteFile(path(2), keystore, 0o600); err != nil {
+		return nil, err
+	}
+	if err := ca.writeTruststore(path(3)); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// writeTruststore writes a PKCS#12 truststore with the CA certificate
+func (ca *CA) writeTruststore(path string) error {
+	truststore, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{ca.cert}, ca.password)
+	if err != nil {
+		return fmt.Errorf("encoding truststore: %w", err)
+	}
+	return os.WriteFile(path, truststore, 0o644)
+}
+
+// writeCredentials writes the password files the Apache Kafka image reads
+// the store passwords from
+func (ca *CA) writeCredentials() ([]string, error) {
+	files := []string{"keystore_creds", "key_creds", "truststore_creds"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(ca.dir, name), []byte(ca.password+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
+
+// writeEncryptedKey writes the key as PKCS#8 encrypted with AES-256-CBC
+func writeEncryptedKey(path string, key crypto.Signer, password string) error {
+	der, err := pkcs8.MarshalPrivateKey(key, []byte(password), nil)
+	if err != nil {
+		return fmt.Errorf("encrypting key: %w", err)
+	}
+	return writePEM(path, "ENCRYPTED PRIVATE KEY", der, 0o600)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kafkaobs"
+)
+
+const usage = `certgen manages the certificate authority of the SSL exercise.
+
+Usage:
+  certgen setup     create a CA, a broker and a client certificate, stores and a CRL
+  certgen init      create a CA
+  certgen issue     issue a server or client certificate
+  certgen revoke    revoke certificates by serial or name and publish a new CRL
+  certgen crl       publish a new CRL, e.g. before the current one expires
+  certgen list      list issued certificates
+  certgen verify    verify a certificate against the CA and the CRL
+
+Run certgen <command> -h for the flags of a command.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("certgen failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	app := kafkaobs.New("certgen")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	commands := map[string]func(*kafkaobs.App, []string) error{
+		"setup":  setupCmd,
+		"init":   initCmd,
+		"issue":  issueCmd,
+		"revoke": revokeCmd,
+		"crl":    crlCmd,
+		"list":   listCmd,
+		"verify": verifyCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(app, args[1:])
+}
+
+// caFlags are shared by every command
+type caFlags struct {
+	dir      *string
+	password *string
+}
+
+func newFlagSet(app *kafkaobs.App, name string) (*flag.FlagSet, caFlags) {
+	fs := flag.NewFlagSet("certgen "+name, flag.ExitOnError)
+	app.BindFlags(fs)
+	return fs, caFlags{
+		dir:      fs.String("dir", "../secrets", "directory of the CA and the generated files"),
+		password: fs.String("password", "kafka-secret", "password of the CA key, the issued keys and the stores"),
+	}
+}
+
+// parseFlags parses the flags of a command and installs the logger. Results
+// go to stdout, what the command did to stderr.
+func parseFlags(app *kafkaobs.App, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	return app.StartLogging()
+}
+
+func setupCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "setup")
+	brokerSANs := fs.String("broker-san", "kafka,localhost,127.0.0.1", "comma-separated DNS names and IPs of the broker certificate")
+	clientCN := fs.String("client-cn", "kafka-client", "common name of the client certificate, the principal with mTLS")
+	days := fs.Int("days", 365, "validity of the broker and client certificates in days")
+	crlURL := fs.String("crl-url", "", "CRL distribution point to embed in issued certificates")
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+
+	authority, err := initCA(*ca.dir, *ca.password, "Kafka-CA", 3650, "rsa", *crlURL)
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("created CA", "cn", authority.cert.Subject.CommonName, "dir", *ca.dir, "not_after", authority.cert.NotAfter.Format(time.DateOnly))
+
+	requests := []IssueRequest{
+		{Name: "kafka", Type: TypeServer, SANs: splitList(*brokerSANs), Days: *days},
+		{Name: "client", Type: TypeClient, CN: *clientCN, Days: *days},
+	}
+	for _, req := range requests {
+		if err := issue(app.Logger, authority, req); err != nil {
+			return err
+		}
+	}
+
+	creds, err := authority.writeCredentials()
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("wrote the store passwords for the Kafka image", "files", creds)
+
+	fmt.Printf("All stores and keys use the password %q\n", *ca.password)
+	return nil
+}
+
+func initCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "init")
+	cn := fs.String("cn", "Kafka-CA", "common name of the CA")
+	days := fs.Int("days", 3650, "validity of the CA certificate in days")
+	keyType := fs.String("key", "rsa", "key type: rsa or ecdsa")
+	crlURL := fs.String("crl-url", "", "CRL distribution point to embed in issued certificates")
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+
+	authority, err := initCA(*ca.dir, *ca.password, *cn, *days, *keyType, *crlURL)
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("created CA", "cn", *cn, "dir", *ca.dir, "not_after", authority.cert.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+func issueCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "issue")
+	name := fs.String("name", "", "name of the certificate, prefix of the generated files")
+	certType := fs.String("type", TypeClient, "certificate type: server or client")
+	cn := fs.String("cn", "", "common name, defaults to the name")
+	sans := fs.String("san", "", "comma-separated DNS names and IPs, required for servers")
+	days := fs.Int("days", 365, "validity in days")
+	keyType := fs.String("key", "rsa", "key type: rsa or ecdsa")
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+
+	authority, err := loadCA(*ca.dir, *ca.password)
+	if err != nil {
+		return err
+	}
+	return issue(app.Logger, authority, IssueRequest{Name: *name, Type: *certType, CN: *cn, SANs: splitList(*sans), Days: *days, KeyType: *keyType})
+}
+
+func issue(logger *slog.Logger, authority *CA, req IssueRequest) error {
+	cert, key, err := authority.Issue(req)
+	if err != nil {
+		return err
+	}
+	files, err := authority.writeIssued(req.Name, cert, key)
+	if err != nil {
+		return err
+	}
+	attrs := []any{"type", req.Type, "cn", cert.Subject.CommonName, "serial", serialString(cert.SerialNumber),
+		"not_after", cert.NotAfter.Format(time.DateOnly)}
+	if sans := describeSANs(cert); sans != "" {
+		attrs = append(attrs, "sans", sans)
+	}
+	logger.Info("issued certificate", append(attrs, "files", files)...)
+	return nil
+}
+
+func revokeCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "revoke")
+	reason := fs.String("reason", "unspecified", "revocation reason: unspecified, keyCompromise, caCompromise, affiliationChanged, superseded, cessationOfOperation or privilegeWithdrawn")
+	crlDays := fs.Int("crl-days", 7, "days until the new CRL has to be republished")
+	all := fs.Bool("all", false, "revoke every unrevoked certificate of the name, needed when a rotation left more than one")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: certgen revoke [flags] <serial or name>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected the serial or name of the certificate to revoke")
+	}
+
+	authority, err := loadCA(*ca.dir, *ca.password)
+	if err != nil {
+		return err
+	}
+	revoked, err := authority.Revoke(fs.Arg(0), *reason, *all)
+	if err != nil {
+		return err
+	}
+	for _, issued := range revoked {
+		app.Logger.Info("revoked certificate", "name", issued.Name, "serial", issued.Serial, "reason", issued.Reason)
+	}
+	return publishCRL(app.Logger, authority, *crlDays)
+}
+
+func crlCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "crl")
+	days := fs.Int("days", 7, "days until the CRL has to be republished")
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+
+	authority, err := loadCA(*ca.dir, *ca.password)
+	if err != nil {
+		return err
+	}
+	return publishCRL(app.Logger, authority, *days)
+}
+
+func publishCRL(logger *slog.Logger, authority *CA, days int) error {
+	if err := authority.writeCRL(days); err != nil {
+		return err
+	}
+	revoked := 0
+	for _, issued := range authority.db.Certificates {
+		if issued.Revoked() {
+			revoked++
+		}
+	}
+	logger.Info("published CRL", "number", authority.db.CRLNumber, "revoked", revoked,
+		"file", filepath.Join(authority.dir, crlFile), "next_update", time.Now().AddDate(0, 0, days).Format(time.DateOnly))
+	return nil
+}
+
+func listCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "list")
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+
+	authority, err := loadCA(*ca.dir, *ca.password)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSERIAL\tSUBJECT\tNOT AFTER\tSTATUS")
+	for _, issued := range authority.db.Certificates {
+		status := "valid"
+		switch {
+		case issued.Revoked():
+			status = "revoked (" + issued.Reason + ")"
+		case time.Now().After(issued.NotAfter):
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			issued.Name, issued.Type, issued.Serial, issued.Subject, issued.NotAfter.Format(time.DateOnly), status)
+	}
+	return w.Flush()
+}
+
+func verifyCmd(app *kafkaobs.App, args []string) error {
+	fs, ca := newFlagSet(app, "verify")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: certgen verify [flags] <certificate.pem>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(app, fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a PEM certificate to verify")
+	}
+
+	authority, err := loadCA(*ca.dir, *ca.password)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("no certificate found in %s", fs.Arg(0))
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	if err := authority.Verify(cert); err != nil {
+		return fmt.Errorf("%s is not valid: %w", fs.Arg(0), err)
+	}
+	fmt.Printf("%q (serial %s) is valid until %s and not revoked\n",
+		cert.Subject.CommonName, serialString(cert.SerialNumber), cert.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+func describeSANs(cert *x509.Certificate) string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
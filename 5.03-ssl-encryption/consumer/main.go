@@ -1,103 +1,163 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"fmt"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"fieldcrypt"
+	"kafkaclient"
+	"kafkaobs"
+	"recordsign"
+	"tlsconfig"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
-	// Configure SSL/TLS
-	tlsConfig, err := createTLSConfig("../secrets/ca-cert.pem")
+	if err := run(); err != nil {
+		slog.Error("consumer failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("ssl-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Setup signal handler for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := app.Start(ctx, ":9310"); err != nil {
+		return err
+	}
+
+	// Configure SSL/TLS. The broker certificate is issued for "kafka", so that
+	// name is verified while connecting to localhost. A client certificate is
+	// reloaded when its files change, new connections present the new one.
+	cfg, err := kafkaclient.LoadDefaults(kafkaclient.Config{
+		Brokers: []string{"localhost:9093"},
+		TLS: tlsconfig.Config{
+			CAFile:     "../secrets/ca-cert.pem",
+			ServerName: "kafka",
+		},
+	})
 	if err != nil {
-		log.Fatalf("Failed to create TLS config: %v", err)
+		return err
+	}
+	app.Logger.Info("connecting", "brokers", cfg.String())
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
 	}
 
+	metrics := app.Metrics
+	consumed := metrics.Counter("messages_consumed_total", "Messages that passed verification")
+	quarantined := metrics.Counter("messages_quarantined_total", "Messages moved to the quarantine topic")
+	decryptErrors := metrics.Counter("decrypt_errors_total", "Messages whose fields could not be decrypted")
+
 	// Create client with SSL configuration
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9093"),
-		kgo.DialTLSConfig(tlsConfig),
+	opts = append(append(opts, app.Opts()...), metrics.GroupOpts()...)
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumeTopics("secure-orders"),
 		kgo.ConsumerGroup("ssl-consumer-group"),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
-	)
+		// Only records that were processed or quarantined are committed
+		kgo.AutoCommitMarks(),
+	)...)
 	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+		return err
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
-	fmt.Println("Connected to Kafka over SSL!")
-	fmt.Println("Consuming messages from topic: secure-orders")
-	fmt.Println("Press Ctrl+C to exit")
-	fmt.Println("---")
+	// Without a keyring encrypted fields are shown as ciphertext
+	var decryptor *fieldcrypt.Decryptor
+	if path := os.Getenv("KAFKA_FIELD_KEYRING"); path != "" {
+		keyring, err := fieldcrypt.LoadKeyring(path)
+		if err != nil {
+			return err
+		}
+		decryptor = fieldcrypt.NewDecryptor(keyring, fieldcrypt.JSON)
+	}
 
-	// Setup signal handler for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// With trusted keys, records that are unsigned or fail verification are
+	// moved to a quarantine topic instead of being processed
+	var quarantine *recordsign.Quarantine
+	if path := os.Getenv("KAFKA_TRUSTED_KEYS"); path != "" {
+		keys, err := recordsign.LoadKeySet(path)
+		if err != nil {
+			return err
+		}
+		topic := cmp.Or(os.Getenv("KAFKA_QUARANTINE_TOPIC"), "secure-orders-quarantine")
+		quarantine = recordsign.NewQuarantine(client, recordsign.NewVerifier(keys), topic)
+	}
 
-	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	logger.Info("consuming messages over SSL", "topic", "secure-orders",
+		"decrypt", decryptor != nil, "verify", quarantine != nil)
 
 	// Message counter
 	msgCount := 0
 
-	// Consume messages in a goroutine
-	go func() {
-		for {
-			fetches := client.PollFetches(ctx)
-			if errs := fetches.Errors(); len(errs) > 0 {
-				for _, err := range errs {
-					log.Printf("Error fetching: %v\n", err)
+	for {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		if errs := fetches.Errors(); len(errs) > 0 {
+			for _, err := range errs {
+				logger.Error("fetch failed", "topic", err.Topic, "partition", err.Partition, "err", err.Err)
+			}
+		}
+
+		iter := fetches.RecordIter()
+		for !iter.Done() {
+			record := iter.Next()
+			recordLogger := kafkaobs.Record(logger, record)
+			if quarantine != nil {
+				if err := quarantine.Check(ctx, record); errors.Is(err, recordsign.ErrQuarantined) {
+					quarantined.Inc()
+					recordLogger.Warn("quarantined message", "err", err)
+					client.MarkCommitRecords(record)
+					continue
+				} else if err != nil {
+					// Neither processed nor quarantined, stop before anything
+					// after it is committed so it is read again on restart
+					return err
 				}
 			}
 
-			fetches.EachPartition(func(p kgo.FetchTopicPartition) {
-				for _, record := range p.Records {
-					msgCount++
-					fmt.Printf("✓ Message %d [Partition: %d, Offset: %d]\n", msgCount, record.Partition, record.Offset)
-					fmt.Printf("  Key: %s\n", string(record.Key))
-					fmt.Printf("  Value: %s\n", string(record.Value))
-					fmt.Println("---")
+			msgCount++
+			consumed.Inc()
+			attrs := []any{"number", msgCount}
+			if quarantine != nil {
+				attrs = append(attrs, "signature", "verified")
+			}
+			if fieldcrypt.Encrypted(record) {
+				if decryptor == nil {
+					// Set KAFKA_FIELD_KEYRING to decrypt them
+					attrs = append(attrs, "fields", "encrypted")
+				} else if err := decryptor.Decrypt(record); err != nil {
+					decryptErrors.Inc()
+					recordLogger.Warn("could not decrypt fields", "err", err)
+					attrs = append(attrs, "fields", "encrypted")
+				} else {
+					attrs = append(attrs, "fields", "decrypted")
 				}
-			})
+			}
+			attrs = append(attrs, "key", string(record.Key), "value", string(record.Value))
+			recordLogger.Info("consumed message", attrs...)
+			client.MarkCommitRecords(record)
 		}
-	}()
-
-	// Wait for interrupt signal
-	<-sigchan
-	fmt.Println("\nShutting down consumer...")
-	cancel()
-	fmt.Printf("Total messages consumed: %d\n", msgCount)
-}
-
-// createTLSConfig creates a TLS configuration with the CA certificate
-func createTLSConfig(caCertPath string) (*tls.Config, error) {
-	// Load CA certificate
-	caCert, err := os.ReadFile(caCertPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	// Create certificate pool and add CA cert
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to parse CA certificate")
-	}
-
-	// Create TLS configuration
-	// InsecureSkipVerify skips hostname verification - needed because our cert is for "kafka" but we connect to "localhost"
-	// This still validates the certificate chain, just not the hostname
-	tlsConfig := &tls.Config{
-		RootCAs:            caCertPool,
-		InsecureSkipVerify: true, // Skip hostname verification for localhost testing with self-signed certs
 	}
 
-	return tlsConfig, nil
+	logger.Info("consumer stopped", "consumed", msgCount)
+	return nil
 }
@@ -0,0 +1,138 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroFormat encrypts string and bytes fields of Avro records. An encrypted
+// string holds the base64 ciphertext, an encrypted bytes field the
+// ciphertext itself, so records still match the schema.
+type avroFormat struct {
+	schema avro.Schema
+}
+
+// Avro returns the format of records written with the schema, which must be
+// a record. Fields that are null in a union are left alone.
+func Avro(schema string) (Format, error) {
+	s, err := avro.Parse(schema)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the Avro schema: %w", err)
+	}
+	if s.Type() != avro.Record {
+		return nil, fmt.Errorf("the Avro schema is a %s, expected a record", s.Type())
+	}
+	return avroFormat{schema: s}, nil
+}
+
+func (f avroFormat) check(fields []string) error {
+	for _, field := range fields {
+		s := f.schema
+		for _, name := range strings.Split(field, ".") {
+			record, ok := nonNull(s).(*avro.RecordSchema)
+			if !ok {
+				return fmt.Errorf("field %s: %s is not a record", field, s.Type())
+			}
+			if s = fieldType(record, name); s == nil {
+				return fmt.Errorf("field %s is not in the Avro schema", field)
+			}
+		}
+		if t := nonNull(s).Type(); t != avro.String && t != avro.Bytes {
+			return fmt.Errorf("field %s is %s, only string and bytes fields can be encrypted", field, t)
+		}
+	}
+	return nil
+}
+
+func (f avroFormat) replace(value []byte, fields []string, encrypt bool, fn func(string, []byte) ([]byte, error)) ([]byte, []string, error) {
+	var record map[string]any
+	if err := avro.Unmarshal(f.schema, value, &record); err != nil {
+		return nil, nil, fmt.Errorf("decoding the Avro record: %w", err)
+	}
+
+	var found []string
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		parent := record
+		schema := f.schema.(*avro.RecordSchema)
+		for _, name := range path[:len(path)-1] {
+			s := fieldType(schema, name)
+			schema, _ = nonNull(s).(*avro.RecordSchema)
+			v := parent[name]
+			// A record in a union is decoded as a map from its name to the record
+			if named, ok := v.(map[string]any); ok && s.Type() == avro.Union && schema != nil {
+				v = named[schema.FullName()]
+			}
+			if parent, _ = v.(map[string]any); parent == nil || schema == nil {
+				break
+			}
+		}
+		name := path[len(path)-1]
+		if parent == nil || parent[name] == nil {
+			continue
+		}
+
+		var err error
+		switch v := parent[name].(type) {
+		case string:
+			parent[name], err = replaceAvroString(field, v, encrypt, fn)
+		case []byte:
+			parent[name], err = fn(field, v)
+		default:
+			err = fmt.Errorf("field %s is %T, only string and bytes fields can be encrypted", field, v)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		found = append(found, field)
+	}
+
+	out, err := avro.Marshal(f.schema, record)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding the Avro record: %w", err)
+	}
+	return out, found, nil
+}
+
+func replaceAvroString(field, s string, encrypt bool, fn func(string, []byte) ([]byte, error)) (string, error) {
+	if encrypt {
+		ciphertext, err := fn(field, []byte(s))
+		return base64.StdEncoding.EncodeToString(ciphertext), err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("field %s is not an encrypted string: %w", field, err)
+	}
+	plaintext, err := fn(field, ciphertext)
+	return string(plaintext), err
+}
+
+func fieldType(record *avro.RecordSchema, name string) avro.Schema {
+	for _, f := range record.Fields() {
+		if f.Name() == name {
+			return f.Type()
+		}
+	}
+	return nil
+}
+
+// nonNull returns the other type of a union with null, e.g. ["null", "string"],
+// and the named type a reference stands for
+func nonNull(s avro.Schema) avro.Schema {
+	if ref, ok := s.(*avro.RefSchema); ok {
+		return ref.Schema()
+	}
+	union, ok := s.(*avro.UnionSchema)
+	if !ok || !union.Nullable() {
+		return s
+	}
+	for _, t := range union.Types() {
+		if t.Type() != avro.Null {
+			return nonNull(t)
+		}
+	}
+	return s
+}
@@ -0,0 +1,271 @@
+// Package fieldcrypt encrypts selected fields of record values, so that
+// sensitive data such as email addresses is protected at rest on the
+// brokers and not only on the wire.
+//
+// It uses envelope encryption: every record, or every few records, gets a
+// random AES-256 data key that encrypts the fields with AES-GCM. The data
+// key is wrapped by the primary master key of a local keyring and travels
+// in the record headers together with the master key ID and the names of
+// the encrypted fields. Consumers that hold the master key unwrap the data
+// key and decrypt the fields; consumers without it see ciphertext.
+//
+// The ciphertext of a field is bound to the field name and the record key, so
+// it can't be copied into another field or another record, not even one that
+// shares its data key. It is not bound to the topic: records copied to another
+// topic, e.g. by mirroring, can still be decrypted.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers of an encrypted record
+const (
+	HeaderKeyID   = "encryption-key-id"
+	HeaderDataKey = "encryption-data-key"
+	HeaderFields  = "encryption-fields"
+)
+
+// maxCachedKeys bounds the unwrapped data keys a Decryptor remembers
+const maxCachedKeys = 1024
+
+// Format finds fields in a record value and replaces their values
+type Format interface {
+	// check reports fields that can't be encrypted in this format
+	check(fields []string) error
+	// replace calls fn with the value of each field that is present and sets
+	// the field to the result, it returns the new value and the fields found
+	replace(value []byte, fields []string, encrypt bool, fn func(field string, b []byte) ([]byte, error)) ([]byte, []string, error)
+}
+
+// Encryptor encrypts the configured fields of records before they are produced
+type Encryptor struct {
+	keyring *Keyring
+	format  Format
+	fields  []string
+	// RecordsPerKey shares a data key between that many records, like a
+	// batch, so the master key wraps fewer keys and consumers unwrap them
+	// once. Zero or one gives every record its own data key.
+	RecordsPerKey int
+
+	mu      sync.Mutex
+	dataKey []byte
+	keyID   string
+	wrapped []byte
+	uses    int
+}
+
+// NewEncryptor returns an encryptor for fields, which are names of top
+// level fields or dotted paths into nested objects, e.g. customer.email
+func NewEncryptor(keyring *Keyring, format Format, fields ...string) (*Encryptor, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields to encrypt")
+	}
+	if keyring.key(keyring.Primary) == nil {
+		return nil, fmt.Errorf("keyring %s has no primary key", keyring.path)
+	}
+	if err := format.check(fields); err != nil {
+		return nil, err
+	}
+	return &Encryptor{keyring: keyring, format: format, fields: fields}, nil
+}
+
+// Encrypt replaces the fields of the record value with their ciphertext and
+// adds the key headers. Records without any of the fields are left alone.
+func (e *Encryptor) Encrypt(r *kgo.Record) error {
+	dataKey, keyID, wrapped, err := e.nextKey()
+	if err != nil {
+		return err
+	}
+	value, found, err := e.format.replace(r.Value, e.fields, true, func(field string, plaintext []byte) ([]byte, error) {
+		return seal(dataKey, plaintext, fieldData(r.Key, field))
+	})
+	if err != nil {
+		return fmt.Errorf("encrypting fields: %w", err)
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	r.Value = value
+	r.Headers = append(r.Headers,
+		kgo.RecordHeader{Key: HeaderKeyID, Value: []byte(keyID)},
+		kgo.RecordHeader{Key: HeaderDataKey, Value: wrapped},
+		kgo.RecordHeader{Key: HeaderFields, Value: []byte(strings.Join(found, ","))},
+	)
+	return nil
+}
+
+// nextKey returns the data key for the next record, a new one when the
+// current one was used RecordsPerKey times or the primary key changed
+func (e *Encryptor) nextKey() ([]byte, string, []byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.dataKey == nil || e.uses >= max(e.RecordsPerKey, 1) || e.keyID != e.keyring.Primary {
+		dataKey := make([]byte, masterKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, "", nil, fmt.Errorf("generating a data key: %w", err)
+		}
+		keyID, wrapped, err := e.keyring.wrap(dataKey)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		e.dataKey, e.keyID, e.wrapped, e.uses = dataKey, keyID, wrapped, 0
+	}
+	e.uses++
+	return e.dataKey, e.keyID, e.wrapped, nil
+}
+
+// Decryptor restores the encrypted fields of consumed records
+type Decryptor struct {
+	keyring *Keyring
+	format  Format
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// NewDecryptor returns a decryptor for records encrypted in format with keys
+// of the keyring
+func NewDecryptor(keyring *Keyring, format Format) *Decryptor {
+	return &Decryptor{keyring: keyring, format: format, cache: map[string][]byte{}}
+}
+
+// Decrypt replaces the encrypted fields of the record value with their
+// plaintext and removes the key headers. Records without them are left
+// alone. When the master key is not in the keyring the error wraps
+// ErrUnknownKey and the record is unchanged.
+func (d *Decryptor) Decrypt(r *kgo.Record) error {
+	keyID, wrapped, fields, ok := encryptionHeaders(r)
+	if !ok {
+		return nil
+	}
+	if err := d.format.check(fields); err != nil {
+		return err
+	}
+	dataKey, err := d.dataKey(keyID, wrapped)
+	if err != nil {
+		return err
+	}
+	value, found, err := d.format.replace(r.Value, fields, false, func(field string, ciphertext []byte) ([]byte, error) {
+		plaintext, err := open(dataKey, ciphertext, fieldData(r.Key, field))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		return plaintext, nil
+	})
+	if err != nil {
+		return fmt.Errorf("decrypting fields: %w", err)
+	}
+	if len(found) != len(fields) {
+		return fmt.Errorf("decrypting fields: only %s of %s are in the record", strings.Join(found, ","), strings.Join(fields, ","))
+	}
+	r.Value = value
+	r.Headers = removeHeaders(r.Headers)
+	return nil
+}
+
+// Encrypted reports whether the record carries encrypted fields
+func Encrypted(r *kgo.Record) bool {
+	_, _, _, ok := encryptionHeaders(r)
+	return ok
+}
+
+func (d *Decryptor) dataKey(keyID string, wrapped []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cacheKey := keyID + "/" + string(wrapped)
+	if dataKey, ok := d.cache[cacheKey]; ok {
+		return dataKey, nil
+	}
+	dataKey, err := d.keyring.unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.cache) >= maxCachedKeys {
+		clear(d.cache)
+	}
+	d.cache[cacheKey] = dataKey
+	return dataKey, nil
+}
+
+func encryptionHeaders(r *kgo.Record) (keyID string, wrapped []byte, fields []string, ok bool) {
+	for _, h := range r.Headers {
+		switch h.Key {
+		case HeaderKeyID:
+			keyID = string(h.Value)
+		case HeaderDataKey:
+			wrapped = h.Value
+		case HeaderFields:
+			fields = strings.Split(string(h.Value), ",")
+		}
+	}
+	return keyID, wrapped, fields, keyID != "" && wrapped != nil && len(fields) > 0
+}
+
+func removeHeaders(headers []kgo.RecordHeader) []kgo.RecordHeader {
+	kept := headers[:0]
+	for _, h := range headers {
+		if h.Key != HeaderKeyID && h.Key != HeaderDataKey && h.Key != HeaderFields {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// fieldData is the additional data of a field: the length of the record key,
+// the key and the field name
+func fieldData(key []byte, field string) []byte {
+	data := binary.AppendUvarint(nil, uint64(len(key)))
+	data = append(data, key...)
+	return append(data, field...)
+}
+
+// seal encrypts with AES-GCM and returns the nonce followed by the
+// ciphertext. The additional data binds the ciphertext to its record and
+// field or to its master key, so it can't be moved elsewhere.
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, errors.New("ciphertext was not encrypted with this key or was modified")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
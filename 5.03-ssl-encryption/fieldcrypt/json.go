@@ -0,0 +1,105 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// JSON encrypts fields of JSON objects. An encrypted field is a string with
+// the base64 ciphertext of the field's JSON value, whatever its type was.
+// Fields that are null are left alone.
+var JSON Format = jsonFormat{}
+
+var errNotObject = errors.New("value is not a JSON object")
+
+type jsonFormat struct{}
+
+func (jsonFormat) check(fields []string) error {
+	for _, field := range fields {
+		if slices.Contains(strings.Split(field, "."), "") {
+			return fmt.Errorf("invalid field %q", field)
+		}
+	}
+	return nil
+}
+
+func (jsonFormat) replace(value []byte, fields []string, encrypt bool, fn func(string, []byte) ([]byte, error)) ([]byte, []string, error) {
+	var found []string
+	for _, field := range fields {
+		replaced, ok, err := replaceJSON(value, strings.Split(field, "."), func(raw json.RawMessage) (json.RawMessage, error) {
+			if encrypt {
+				ciphertext, err := fn(field, raw)
+				if err != nil {
+					return nil, err
+				}
+				return json.Marshal(base64.StdEncoding.EncodeToString(ciphertext))
+			}
+			var encoded string
+			if err := json.Unmarshal(raw, &encoded); err != nil {
+				return nil, fmt.Errorf("field %s is not an encrypted string", field)
+			}
+			ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field, err)
+			}
+			plaintext, err := fn(field, ciphertext)
+			if err != nil {
+				return nil, err
+			}
+			if !json.Valid(plaintext) {
+				return nil, fmt.Errorf("field %s did not decrypt to JSON", field)
+			}
+			return plaintext, nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			value = replaced
+			found = append(found, field)
+		}
+	}
+	return value, found, nil
+}
+
+// replaceJSON sets the value at path in the object doc to fn of its current
+// value. Only the objects along the path are decoded, other values keep
+// their encoding. It reports false when the path doesn't exist.
+func replaceJSON(doc []byte, path []string, fn func(json.RawMessage) (json.RawMessage, error)) ([]byte, bool, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return nil, false, errNotObject
+	}
+	raw, ok := obj[path[0]]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return doc, false, nil
+	}
+
+	var err error
+	if len(path) == 1 {
+		raw, err = fn(raw)
+	} else {
+		var found bool
+		raw, found, err = replaceJSON(raw, path[1:], fn)
+		if errors.Is(err, errNotObject) || (err == nil && !found) {
+			return doc, false, nil
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	obj[path[0]] = raw
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, false, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), true, nil
+}
@@ -0,0 +1,164 @@
+package fieldcrypt
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// masterKeySize is the size of the AES-256 master and data keys
+const masterKeySize = 32
+
+// ErrUnknownKey is returned when a record was encrypted with a master key
+// that is not in the keyring
+var ErrUnknownKey = errors.New("master key not in the keyring")
+
+// MasterKey wraps the data keys of records, it never leaves the keyring
+type MasterKey struct {
+	ID        string    `json:"id"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Keyring is a local file of master keys. New records are encrypted with
+// the primary key, older keys stay in the file so records encrypted with
+// them can still be read.
+type Keyring struct {
+	path    string
+	Primary string      `json:"primary"`
+	Keys    []MasterKey `json:"keys"`
+}
+
+// NewKeyring returns an empty keyring that is saved to path
+func NewKeyring(path string) *Keyring {
+	return &Keyring{path: path}
+}
+
+// LoadKeyring reads the keyring file
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("keyring %s does not exist, create it with keyring init", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{path: path}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+	}
+	for _, key := range k.Keys {
+		if len(key.Key) != masterKeySize {
+			return nil, fmt.Errorf("keyring %s: key %s has %d bytes, expected %d", path, key.ID, len(key.Key), masterKeySize)
+		}
+	}
+	if k.Primary != "" && k.key(k.Primary) == nil {
+		return nil, fmt.Errorf("keyring %s: primary key %s is missing", path, k.Primary)
+	}
+	return k, nil
+}
+
+// Path is where the keyring is saved
+func (k *Keyring) Path() string {
+	return k.path
+}
+
+// Rotate adds a new random key and makes it the primary one
+func (k *Keyring) Rotate() (MasterKey, error) {
+	key := MasterKey{
+		ID:        time.Now().UTC().Format("20060102-150405"),
+		Key:       make([]byte, masterKeySize),
+		CreatedAt: time.Now().UTC(),
+	}
+	if k.key(key.ID) != nil {
+		return MasterKey{}, fmt.Errorf("key %s already exists, try again in a second", key.ID)
+	}
+	if _, err := rand.Read(key.Key); err != nil {
+		return MasterKey{}, fmt.Errorf("generating a key: %w", err)
+	}
+	k.Keys = append(k.Keys, key)
+	k.Primary = key.ID
+	return key, nil
+}
+
+// Remove deletes a key that is no longer primary. Records encrypted with it
+// can't be decrypted anymore.
+func (k *Keyring) Remove(id string) error {
+	if id == k.Primary {
+		return fmt.Errorf("%s is the primary key, rotate first", id)
+	}
+	for i, key := range k.Keys {
+		if key.ID == id {
+			k.Keys = append(k.Keys[:i], k.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownKey, id)
+}
+
+// Save writes the keyring with mode 0600 through a temporary file in the
+// same directory, which is renamed over the old one
+func (k *Keyring) Save() error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), "."+filepath.Base(k.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("saving keyring %s: %w", k.path, err)
+	}
+	return nil
+}
+
+func (k *Keyring) key(id string) *MasterKey {
+	for i := range k.Keys {
+		if k.Keys[i].ID == id {
+			return &k.Keys[i]
+		}
+	}
+	return nil
+}
+
+// wrap encrypts a data key with the primary master key
+func (k *Keyring) wrap(dataKey []byte) (string, []byte, error) {
+	primary := k.key(k.Primary)
+	if primary == nil {
+		return "", nil, fmt.Errorf("keyring %s has no primary key", k.path)
+	}
+	wrapped, err := seal(primary.Key, dataKey, []byte(primary.ID))
+	return primary.ID, wrapped, err
+}
+
+// unwrap decrypts a data key with the master key it was wrapped with
+func (k *Keyring) unwrap(id string, wrapped []byte) ([]byte, error) {
+	master := k.key(id)
+	if master == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	dataKey, err := open(master.Key, wrapped, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping the data key with %s: %w", id, err)
+	}
+	return dataKey, nil
+}
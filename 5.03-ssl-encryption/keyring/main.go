@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"fieldcrypt"
+	"kafkaobs"
+)
+
+const usage = `keyring manages the master keys that wrap the data keys of encrypted fields.
+
+Usage:
+  keyring init     create a keyring with a primary key
+  keyring rotate   add a new primary key, older keys keep decrypting old records
+  keyring list     list the keys
+  keyring remove   remove a key, records encrypted with it can't be read anymore
+
+Run keyring <command> -h for the flags of a command.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("keyring failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	app := kafkaobs.New("keyring")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	commands := map[string]func(*kafkaobs.App, []string) error{
+		"init":   initCmd,
+		"rotate": rotateCmd,
+		"list":   listCmd,
+		"remove": removeCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(app, args[1:])
+}
+
+func newFlagSet(app *kafkaobs.App, name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("keyring "+name, flag.ExitOnError)
+	app.BindFlags(fs)
+	return fs, fs.String("file", "../secrets/keyring.json", "keyring file, only readable by its owner")
+}
+
+// parseFlags parses the flags of a command and installs the logger. Results
+// go to stdout, what the command did to stderr.
+func parseFlags(app *kafkaobs.App, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	return app.StartLogging()
+}
+
+func initCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "init")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*path); !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s already exists, use keyring rotate for a new key", *path)
+	}
+	keyring := fieldcrypt.NewKeyring(*path)
+	key, err := keyring.Rotate()
+	if err != nil {
+		return err
+	}
+	if err := keyring.Save(); err != nil {
+		return err
+	}
+	app.Logger.Info("created keyring", "file", *path, "primary", key.ID)
+	return nil
+}
+
+func rotateCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "rotate")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(*path)
+	if err != nil {
+		return err
+	}
+	key, err := keyring.Rotate()
+	if err != nil {
+		return err
+	}
+	if err := keyring.Save(); err != nil {
+		return err
+	}
+	app.Logger.Info("rotated the primary key, restart producers to use it", "file", *path, "primary", key.ID)
+	return nil
+}
+
+func listCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "list")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(*path)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tSTATUS")
+	for _, key := range keyring.Keys {
+		status := "decrypt only"
+		if key.ID == keyring.Primary {
+			status = "primary"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key.ID, key.CreatedAt.Local().Format(time.DateTime), status)
+	}
+	return w.Flush()
+}
+
+func removeCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "remove")
+	id := flags.String("id", "", "ID of the key to remove")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+	if *id == "" {
+		return errors.New("name the key with -id")
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(*path)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Remove(*id); err != nil {
+		return err
+	}
+	if err := keyring.Save(); err != nil {
+		return err
+	}
+	app.Logger.Warn("removed key, records encrypted with it can't be decrypted anymore", "file", *path, "id", *id)
+	return nil
+}
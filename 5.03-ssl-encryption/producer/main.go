@@ -2,39 +2,84 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
+	"fieldcrypt"
+	"kafkaclient"
+	"kafkaobs"
+	"recordsign"
+	"tlsconfig"
+
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
-	// Configure SSL/TLS
-	tlsConfig, err := createTLSConfig("../secrets/ca-cert.pem")
+	if err := run(); err != nil {
+		slog.Error("producer failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("ssl-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctx := context.Background()
+	if err := app.Start(ctx, ":9309"); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	// Configure SSL/TLS. The broker certificate is issued for "kafka", so that
+	// name is verified while connecting to localhost. A client certificate is
+	// reloaded when its files change, new connections present the new one.
+	cfg, err := kafkaclient.LoadDefaults(kafkaclient.Config{
+		Brokers: []string{"localhost:9093"},
+		TLS: tlsconfig.Config{
+			CAFile:     "../secrets/ca-cert.pem",
+			ServerName: "kafka",
+		},
+	})
 	if err != nil {
-		log.Fatalf("Failed to create TLS config: %v", err)
+		return err
+	}
+	logger.Info("connecting", "brokers", cfg.String())
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
 	}
 
 	// Create client with SSL configuration
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9093"),
-		kgo.DialTLSConfig(tlsConfig),
-	)
+	client, err := kgo.NewClient(append(opts, app.Opts()...)...)
 	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+		return err
 	}
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
 
-	fmt.Println("Connected to Kafka over SSL!")
-	fmt.Println("Producing messages to topic: secure-orders")
-	fmt.Println("---")
+	// TLS only protects messages in transit. With a keyring the customer
+	// field is also encrypted, so it is unreadable at rest on the broker.
+	encryptor, fields, err := newEncryptor()
+	if err != nil {
+		return fmt.Errorf("setting up field encryption: %w", err)
+	}
+
+	// A signature lets consumers detect records that were modified or
+	// written by someone without the key
+	signer, keyID, err := newSigner()
+	if err != nil {
+		return fmt.Errorf("setting up signing: %w", err)
+	}
 
-	ctx := context.Background()
 	topic := "secure-orders"
+	logger.Info("producing messages over SSL", "topic", topic,
+		"encrypted_fields", strings.Join(fields, ","), "signing_key", keyID)
 
 	// Produce messages
 	for i := 1; i <= 10; i++ {
@@ -46,47 +91,71 @@ func main() {
 			Key:   []byte(fmt.Sprintf("order-%d", 2000+i)),
 			Value: []byte(message),
 		}
+		if encryptor != nil {
+			if err := encryptor.Encrypt(record); err != nil {
+				return fmt.Errorf("encrypting message: %w", err)
+			}
+		}
+		// Sign last, the signature covers the encrypted value
+		if signer != nil {
+			if err := signer.Sign(record); err != nil {
+				return fmt.Errorf("signing message: %w", err)
+			}
+		}
 
 		// Produce synchronously
-		results := client.ProduceSync(ctx, record)
-		if err := results.FirstErr(); err != nil {
-			log.Printf("Failed to send message: %v", err)
+		if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
+			kafkaobs.Record(logger, record).Error("failed to send message", "number", i, "err", err)
 			continue
 		}
-
-		// Get the result for the record
-		for _, res := range results {
-			fmt.Printf("✓ Message %d sent to partition %d at offset %d\n", i, res.Record.Partition, res.Record.Offset)
-		}
+		kafkaobs.Record(logger, record).Info("sent message", "number", i, "key", string(record.Key))
 
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	fmt.Println("---")
-	fmt.Println("All messages sent successfully!")
+	logger.Info("all messages sent")
+	return nil
 }
 
-// createTLSConfig creates a TLS configuration with the CA certificate
-func createTLSConfig(caCertPath string) (*tls.Config, error) {
-	// Load CA certificate
-	caCert, err := os.ReadFile(caCertPath)
+// newEncryptor encrypts the fields in KAFKA_ENCRYPT_FIELDS (customer by
+// default) with the keyring named by KAFKA_FIELD_KEYRING, it returns nil
+// when no keyring is set
+func newEncryptor() (*fieldcrypt.Encryptor, []string, error) {
+	path := os.Getenv("KAFKA_FIELD_KEYRING")
+	if path == "" {
+		return nil, nil, nil
+	}
+	keyring, err := fieldcrypt.LoadKeyring(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		return nil, nil, err
 	}
-
-	// Create certificate pool and add CA cert
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to parse CA certificate")
+	fields := []string{"customer"}
+	if v, ok := os.LookupEnv("KAFKA_ENCRYPT_FIELDS"); ok {
+		fields = strings.Split(v, ",")
 	}
+	encryptor, err := fieldcrypt.NewEncryptor(keyring, fieldcrypt.JSON, fields...)
+	return encryptor, fields, err
+}
 
-	// Create TLS configuration
-	// InsecureSkipVerify skips hostname verification - needed because our cert is for "kafka" but we connect to "localhost"
-	// This still validates the certificate chain, just not the hostname
-	tlsConfig := &tls.Config{
-		RootCAs:            caCertPool,
-		InsecureSkipVerify: true, // Skip hostname verification for localhost testing with self-signed certs
+// newSigner signs with the key KAFKA_SIGNING_KEY_ID of the key set named by
+// KAFKA_SIGNING_KEYS, it returns nil when no key set is set. The encryption
+// headers are signed too, so they can't be swapped between records.
+func newSigner() (*recordsign.Signer, string, error) {
+	path := os.Getenv("KAFKA_SIGNING_KEYS")
+	if path == "" {
+		return nil, "", nil
 	}
-
-	return tlsConfig, nil
+	keys, err := recordsign.LoadKeySet(path)
+	if err != nil {
+		return nil, "", err
+	}
+	keyID := os.Getenv("KAFKA_SIGNING_KEY_ID")
+	if keyID == "" {
+		if len(keys.Keys) != 1 {
+			return nil, "", fmt.Errorf("%s has %d keys, choose one with KAFKA_SIGNING_KEY_ID", path, len(keys.Keys))
+		}
+		keyID = keys.Keys[0].ID
+	}
+	signer, err := recordsign.NewSigner(keys, keyID, fieldcrypt.HeaderKeyID, fieldcrypt.HeaderDataKey, fieldcrypt.HeaderFields)
+	return signer, keyID, err
 }
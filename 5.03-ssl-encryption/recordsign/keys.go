@@ -0,0 +1,183 @@
+package recordsign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Signature algorithms
+const (
+	// Ed25519 signs with a private key, consumers only need the public key
+	Ed25519 = "ed25519"
+	// HMACSHA256 signs with a shared secret, everyone who verifies can also sign
+	HMACSHA256 = "hmac-sha256"
+)
+
+// hmacSecretSize is the size of generated HMAC secrets, the output size of SHA-256
+const hmacSecretSize = 32
+
+// Key is a signing key. Producers need the private key or secret, consumers
+// of Ed25519 signatures only the public key.
+type Key struct {
+	ID         string    `json:"id"`
+	Algorithm  string    `json:"algorithm"`
+	PublicKey  []byte    `json:"public_key,omitempty"`
+	PrivateKey []byte    `json:"private_key,omitempty"`
+	Secret     []byte    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CanSign reports whether the key holds what is needed to sign
+func (k Key) CanSign() bool {
+	switch k.Algorithm {
+	case Ed25519:
+		return len(k.PrivateKey) == ed25519.PrivateKeySize
+	case HMACSHA256:
+		return len(k.Secret) > 0
+	default:
+		return false
+	}
+}
+
+func (k Key) validate() error {
+	switch k.Algorithm {
+	case Ed25519:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("key %s: public key has %d bytes, expected %d", k.ID, len(k.PublicKey), ed25519.PublicKeySize)
+		}
+		if k.PrivateKey != nil && len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return fmt.Errorf("key %s: private key has %d bytes, expected %d", k.ID, len(k.PrivateKey), ed25519.PrivateKeySize)
+		}
+	case HMACSHA256:
+		if len(k.Secret) < hmacSecretSize {
+			return fmt.Errorf("key %s: the secret needs at least %d bytes", k.ID, hmacSecretSize)
+		}
+	default:
+		return fmt.Errorf("key %s: unknown algorithm %q, expected %s or %s", k.ID, k.Algorithm, Ed25519, HMACSHA256)
+	}
+	return nil
+}
+
+// KeySet is a local file of signing keys. Producers keep the keys they sign
+// with, consumers the keys of the producers they trust.
+type KeySet struct {
+	path string
+	Keys []Key `json:"keys"`
+}
+
+// NewKeySet returns an empty key set that is saved to path
+func NewKeySet(path string) *KeySet {
+	return &KeySet{path: path}
+}
+
+// LoadKeySet reads the key set file
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("key set %s does not exist, create it with signkeys generate", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ks := &KeySet{path: path}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("reading key set %s: %w", path, err)
+	}
+	for _, k := range ks.Keys {
+		if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("key set %s: %w", path, err)
+		}
+	}
+	return ks, nil
+}
+
+// Path is where the key set is saved
+func (ks *KeySet) Path() string {
+	return ks.path
+}
+
+// Generate adds a new random key
+func (ks *KeySet) Generate(id, algorithm string) (Key, error) {
+	if id == "" {
+		return Key{}, errors.New("a key needs an ID")
+	}
+	if ks.Key(id) != nil {
+		return Key{}, fmt.Errorf("key %s already exists", id)
+	}
+	key := Key{ID: id, Algorithm: algorithm, CreatedAt: time.Now().UTC()}
+	switch algorithm {
+	case Ed25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		key.PublicKey, key.PrivateKey = public, private
+	case HMACSHA256:
+		key.Secret = make([]byte, hmacSecretSize)
+		if _, err := rand.Read(key.Secret); err != nil {
+			return Key{}, err
+		}
+	default:
+		return Key{}, fmt.Errorf("unknown algorithm %q, expected %s or %s", algorithm, Ed25519, HMACSHA256)
+	}
+	ks.Keys = append(ks.Keys, key)
+	return key, nil
+}
+
+// Trusted returns the keys consumers need to verify signatures, saved to
+// path: Ed25519 keys without their private key, HMAC keys as they are
+func (ks *KeySet) Trusted(path string) *KeySet {
+	trusted := &KeySet{path: path}
+	for _, k := range ks.Keys {
+		k.PrivateKey = nil
+		trusted.Keys = append(trusted.Keys, k)
+	}
+	return trusted
+}
+
+// Key returns the key with the ID, or nil
+func (ks *KeySet) Key(id string) *Key {
+	for i := range ks.Keys {
+		if ks.Keys[i].ID == id {
+			return &ks.Keys[i]
+		}
+	}
+	return nil
+}
+
+// Save writes the key set with mode 0600 through a temporary file in the
+// same directory, which is renamed over the old one
+func (ks *KeySet) Save() error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), "."+filepath.Base(ks.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return fmt.Errorf("saving key set %s: %w", ks.path, err)
+	}
+	return nil
+}
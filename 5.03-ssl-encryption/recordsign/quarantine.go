@@ -0,0 +1,64 @@
+package recordsign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers added to quarantined records, next to the original headers
+const (
+	HeaderQuarantineReason  = "quarantine-reason"
+	HeaderOriginalTopic     = "original-topic"
+	HeaderOriginalPartition = "original-partition"
+	HeaderOriginalOffset    = "original-offset"
+)
+
+// ErrQuarantined is wrapped by Check, together with the reason, for records
+// that were moved to the quarantine topic
+var ErrQuarantined = errors.New("record quarantined")
+
+// Quarantine verifies consumed records and moves those that fail to a
+// separate topic, where they can be inspected without being processed
+type Quarantine struct {
+	verifier *Verifier
+	client   *kgo.Client
+	topic    string
+}
+
+// NewQuarantine returns a quarantine that produces to topic with the client
+func NewQuarantine(client *kgo.Client, verifier *Verifier, topic string) *Quarantine {
+	return &Quarantine{verifier: verifier, client: client, topic: topic}
+}
+
+// Check returns nil when the record may be processed. A record that is
+// unsigned or fails verification is produced to the quarantine topic and
+// Check returns an error wrapping ErrQuarantined and the reason. Any other
+// error means the record could not be quarantined and must not be committed.
+func (q *Quarantine) Check(ctx context.Context, r *kgo.Record) error {
+	reason := q.verifier.Verify(r)
+	if reason == nil {
+		return nil
+	}
+
+	quarantined := &kgo.Record{
+		Topic:     q.topic,
+		Key:       r.Key,
+		Value:     r.Value,
+		Timestamp: r.Timestamp,
+		Headers: append(slices.Clone(r.Headers),
+			kgo.RecordHeader{Key: HeaderQuarantineReason, Value: []byte(reason.Error())},
+			kgo.RecordHeader{Key: HeaderOriginalTopic, Value: []byte(r.Topic)},
+			kgo.RecordHeader{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(int(r.Partition)))},
+			kgo.RecordHeader{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(r.Offset, 10))},
+		),
+	}
+	if err := q.client.ProduceSync(ctx, quarantined).FirstErr(); err != nil {
+		return fmt.Errorf("quarantining %s/%d@%d (%v): %w", r.Topic, r.Partition, r.Offset, reason, err)
+	}
+	return fmt.Errorf("%w: %w", ErrQuarantined, reason)
+}
@@ -0,0 +1,222 @@
+// Package recordsign signs records when they are produced and verifies them
+// when they are consumed, to detect records that were modified after they
+// left the producer or that were written by a producer without the key.
+//
+// The signature covers the topic, key, value and a chosen set of headers.
+// It travels in the record headers together with the ID of the key and the
+// names of the signed headers. Consumers look the key up in their own key
+// set, so a record can't pick a weaker algorithm or a key they don't trust.
+package recordsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers of a signed record
+const (
+	HeaderSignature     = "signature"
+	HeaderKeyID         = "signature-key-id"
+	HeaderSignedHeaders = "signature-headers"
+)
+
+// signatureContext separates these signatures from anything else the key
+// might sign, and versions the signed layout
+const signatureContext = "kafka-record-signature-v1"
+
+var (
+	// ErrUnsigned is returned for records without a signature
+	ErrUnsigned = errors.New("record is not signed")
+	// ErrUnknownKey is returned for signatures of keys that are not trusted
+	ErrUnknownKey = errors.New("signing key is not trusted")
+	// ErrInvalidSignature is returned when the record was modified or signed
+	// with another key
+	ErrInvalidSignature = errors.New("signature does not match the record")
+)
+
+// Signer adds signatures to records before they are produced
+type Signer struct {
+	key     Key
+	headers []string
+}
+
+// NewSigner returns a signer with the key of the key set, which signs the
+// named headers next to the topic, key and value. Headers a record doesn't
+// have are signed as absent, so they can't be added later.
+func NewSigner(keys *KeySet, keyID string, headers ...string) (*Signer, error) {
+	key := keys.Key(keyID)
+	if key == nil {
+		return nil, fmt.Errorf("key %s is not in %s", keyID, keys.path)
+	}
+	if !key.CanSign() {
+		return nil, fmt.Errorf("key %s in %s can only verify, the private key is missing", keyID, keys.path)
+	}
+	for _, h := range headers {
+		if h == "" || strings.Contains(h, ",") || isSignatureHeader(h) {
+			return nil, fmt.Errorf("header %q can't be signed", h)
+		}
+	}
+	return &Signer{key: *key, headers: headers}, nil
+}
+
+// Sign adds the signature headers, replacing those of an earlier signature.
+// The record must not be changed afterwards, or verification fails.
+func (s *Signer) Sign(r *kgo.Record) error {
+	r.Headers = removeSignature(r.Headers)
+	signature, err := s.key.sign(signedBytes(r, s.headers))
+	if err != nil {
+		return err
+	}
+	r.Headers = append(r.Headers,
+		kgo.RecordHeader{Key: HeaderSignature, Value: signature},
+		kgo.RecordHeader{Key: HeaderKeyID, Value: []byte(s.key.ID)},
+		kgo.RecordHeader{Key: HeaderSignedHeaders, Value: []byte(strings.Join(s.headers, ","))},
+	)
+	return nil
+}
+
+// Verifier checks the signatures of consumed records
+type Verifier struct {
+	keys *KeySet
+	// Required are headers that must be signed, so a producer can't leave
+	// them out of the signature
+	Required []string
+}
+
+// NewVerifier returns a verifier that trusts the keys of the key set
+func NewVerifier(keys *KeySet) *Verifier {
+	return &Verifier{keys: keys}
+}
+
+// Verify returns nil when the record carries a valid signature of a trusted
+// key, and otherwise an error wrapping ErrUnsigned, ErrUnknownKey or
+// ErrInvalidSignature
+func (v *Verifier) Verify(r *kgo.Record) error {
+	signature, keyID, headers, err := signatureHeaders(r)
+	if err != nil {
+		return err
+	}
+	key := v.keys.Key(keyID)
+	if key == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	for _, h := range v.Required {
+		if !slices.Contains(headers, h) {
+			return fmt.Errorf("%w: header %s is not signed", ErrInvalidSignature, h)
+		}
+	}
+	if !key.verify(signedBytes(r, headers), signature) {
+		return fmt.Errorf("%w, key %s", ErrInvalidSignature, keyID)
+	}
+	return nil
+}
+
+func signatureHeaders(r *kgo.Record) (signature []byte, keyID string, headers []string, err error) {
+	found := map[string]int{}
+	for _, h := range r.Headers {
+		switch h.Key {
+		case HeaderSignature:
+			signature = h.Value
+		case HeaderKeyID:
+			keyID = string(h.Value)
+		case HeaderSignedHeaders:
+			if len(h.Value) > 0 {
+				headers = strings.Split(string(h.Value), ",")
+			}
+		default:
+			continue
+		}
+		found[h.Key]++
+	}
+	if len(found) == 0 {
+		return nil, "", nil, ErrUnsigned
+	}
+	for _, name := range []string{HeaderSignature, HeaderKeyID, HeaderSignedHeaders} {
+		if found[name] != 1 {
+			return nil, "", nil, fmt.Errorf("%w: the record has %d %s headers", ErrInvalidSignature, found[name], name)
+		}
+	}
+	return signature, keyID, headers, nil
+}
+
+// signedBytes encodes what the signature covers: every part is prefixed
+// with its length, so parts can't be shifted into each other. A null key or
+// value is encoded differently from an empty one.
+func signedBytes(r *kgo.Record, headers []string) []byte {
+	var b bytes.Buffer
+	write := func(p []byte) {
+		if p == nil {
+			b.Write([]byte{0xff, 0xff, 0xff, 0xff})
+			return
+		}
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(p))))
+		b.Write(p)
+	}
+
+	write([]byte(signatureContext))
+	write([]byte(r.Topic))
+	write(r.Key)
+	write(r.Value)
+	for _, name := range headers {
+		write([]byte(name))
+		var values [][]byte
+		for _, h := range r.Headers {
+			if h.Key == name {
+				values = append(values, h.Value)
+			}
+		}
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(values))))
+		for _, v := range values {
+			// Null and empty header values are signed alike, not every
+			// client keeps them apart
+			if v == nil {
+				v = []byte{}
+			}
+			write(v)
+		}
+	}
+	return b.Bytes()
+}
+
+func (k Key) sign(message []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case Ed25519:
+		return ed25519.Sign(ed25519.PrivateKey(k.PrivateKey), message), nil
+	case HMACSHA256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(message)
+		return mac.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("key %s: unknown algorithm %q", k.ID, k.Algorithm)
+	}
+}
+
+func (k Key) verify(message, signature []byte) bool {
+	switch k.Algorithm {
+	case Ed25519:
+		return ed25519.Verify(ed25519.PublicKey(k.PublicKey), message, signature)
+	case HMACSHA256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(message)
+		return hmac.Equal(mac.Sum(nil), signature)
+	default:
+		return false
+	}
+}
+
+func isSignatureHeader(name string) bool {
+	return name == HeaderSignature || name == HeaderKeyID || name == HeaderSignedHeaders
+}
+
+func removeSignature(headers []kgo.RecordHeader) []kgo.RecordHeader {
+	return slices.DeleteFunc(headers, func(h kgo.RecordHeader) bool { return isSignatureHeader(h.Key) })
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"kafkaobs"
+	"recordsign"
+)
+
+const usage = `signkeys manages the keys that sign produced records.
+
+Usage:
+  signkeys generate   add an Ed25519 or HMAC key to the producer's key set
+  signkeys trust      write the keys consumers need to verify signatures
+  signkeys list       list the keys of a key set
+
+Run signkeys <command> -h for the flags of a command.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("signkeys failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	app := kafkaobs.New("signkeys")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	commands := map[string]func(*kafkaobs.App, []string) error{
+		"generate": generateCmd,
+		"trust":    trustCmd,
+		"list":     listCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(app, args[1:])
+}
+
+func newFlagSet(app *kafkaobs.App, name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("signkeys "+name, flag.ExitOnError)
+	app.BindFlags(fs)
+	return fs, fs.String("file", "../secrets/signing-keys.json", "key set of the producer, with private keys")
+}
+
+// parseFlags parses the flags of a command and installs the logger. Results
+// go to stdout, what the command did to stderr.
+func parseFlags(app *kafkaobs.App, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	return app.StartLogging()
+}
+
+func generateCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "generate")
+	id := flags.String("id", "", "key ID, sent with every signature, e.g. orders-producer-2026")
+	algorithm := flags.String("algorithm", recordsign.Ed25519, "ed25519 or hmac-sha256")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	keys := recordsign.NewKeySet(*path)
+	if _, err := os.Stat(*path); !errors.Is(err, fs.ErrNotExist) {
+		if keys, err = recordsign.LoadKeySet(*path); err != nil {
+			return err
+		}
+	}
+	key, err := keys.Generate(*id, *algorithm)
+	if err != nil {
+		return err
+	}
+	if err := keys.Save(); err != nil {
+		return err
+	}
+	app.Logger.Info("added key", "file", *path, "id", key.ID, "algorithm", key.Algorithm)
+	return nil
+}
+
+func trustCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "trust")
+	out := flags.String("out", "../secrets/trusted-keys.json", "key set for consumers, without private keys")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	keys, err := recordsign.LoadKeySet(*path)
+	if err != nil {
+		return err
+	}
+	trusted := keys.Trusted(*out)
+	if err := trusted.Save(); err != nil {
+		return err
+	}
+	app.Logger.Info("wrote the trusted keys", "file", *out, "keys", len(trusted.Keys))
+	for _, k := range trusted.Keys {
+		if k.Algorithm == recordsign.HMACSHA256 {
+			app.Logger.Warn("HMAC key: consumers that verify with it can also sign", "id", k.ID)
+		}
+	}
+	return nil
+}
+
+func listCmd(app *kafkaobs.App, args []string) error {
+	flags, path := newFlagSet(app, "list")
+	if err := parseFlags(app, flags, args); err != nil {
+		return err
+	}
+
+	keys, err := recordsign.LoadKeySet(*path)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tALGORITHM\tCREATED\tUSE")
+	for _, k := range keys.Keys {
+		use := "verify"
+		if k.CanSign() {
+			use = "sign and verify"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, k.CreatedAt.Local().Format(time.DateTime), use)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Snapshot is the lag of every group at the time of a poll
+type Snapshot struct {
+	At       time.Time
+	Duration time.Duration
+	Groups   []GroupLag
+	// EndOffsets of the partitions the groups consume, by topic and partition
+	EndOffsets map[string]map[int32]int64
+}
+
+// GroupLag is the lag of a consumer group
+type GroupLag struct {
+	Group      string
+	State      string
+	Members    int
+	Partitions []PartitionLag
+}
+
+// PartitionLag is how far a group is behind on a partition
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed is the committed offset, or -1 when the group has not
+	// committed to the partition yet
+	Committed int64
+	End       int64
+	Lag       int64
+	// Oldest is the timestamp of the first record the group has not
+	// consumed. It is zero when the group is caught up or when the record
+	// could not be read in time.
+	Oldest time.Time
+}
+
+// LagSeconds is the time lag at now: the age of the oldest record the group
+// has not consumed, 0 when it is caught up. ok is false when the timestamp
+// of that record is unknown.
+func (p PartitionLag) LagSeconds(now time.Time) (seconds float64, ok bool) {
+	if p.Lag == 0 {
+		return 0, true
+	}
+	if p.Oldest.IsZero() {
+		return 0, false
+	}
+	return max(now.Sub(p.Oldest).Seconds(), 0), true
+}
+
+// Total is the lag of the group over all partitions
+func (g GroupLag) Total() int64 {
+	var total int64
+	for _, p := range g.Partitions {
+		total += p.Lag
+	}
+	return total
+}
+
+// Poller computes the lag of the consumer groups of a cluster
+type Poller struct {
+	adm    *kadm.Client
+	opts   []kgo.Opt
+	groups *regexp.Regexp
+	// lookupTimeout bounds the fetches of the records at the committed
+	// offsets, 0 disables the time lag
+	lookupTimeout time.Duration
+	timestamps    *timestampCache
+}
+
+// NewPoller polls the groups matching the groups expression. The lookups of
+// the record timestamps use their own short-lived clients built from opts.
+func NewPoller(cl *kgo.Client, opts []kgo.Opt, groups *regexp.Regexp, lookupTimeout time.Duration) *Poller {
+	return &Poller{
+		adm:           kadm.NewClient(cl),
+		opts:          opts,
+		groups:        groups,
+		lookupTimeout: lookupTimeout,
+		timestamps:    newTimestampCache(),
+	}
+}
+
+// Poll lists the groups, fetches their committed offsets and the end
+// offsets of the partitions, and looks up the timestamps of the records at
+// the committed offsets. Partitions whose lag cannot be computed are left
+// out and reported in the returned warnings.
+func (p *Poller) Poll(ctx context.Context) (*Snapshot, []string, error) {
+	start := time.Now()
+
+	listed, err := p.adm.ListGroups(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing groups: %w", err)
+	}
+	var names []string
+	for _, g := range listed.Sorted() {
+		// Empty groups that only have commits have no protocol type, Connect
+		// workers use "connect" and have no offsets
+		if g.ProtocolType != "consumer" && g.ProtocolType != "" {
+			continue
+		}
+		if p.groups.MatchString(g.Group) {
+			names = append(names, g.Group)
+		}
+	}
+
+	snap := &Snapshot{EndOffsets: map[string]map[int32]int64{}}
+	if len(names) == 0 {
+		snap.At, snap.Duration = time.Now(), time.Since(start)
+		return snap, nil, nil
+	}
+
+	lags, err := p.adm.Lag(ctx, names...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching group lag: %w", err)
+	}
+
+	var warnings []string
+	for _, described := range lags.Sorted() {
+		if err := described.Error(); err != nil {
+			warnings = append(warnings, fmt.Sprintf("group %s: %v", described.Group, err))
+			continue
+		}
+		g := GroupLag{Group: described.Group, State: described.State, Members: len(described.Members)}
+		for _, l := range described.Lag.Sorted() {
+			if l.Err != nil {
+				warnings = append(warnings, fmt.Sprintf("group %s, %s/%d: %v", g.Group, l.Topic, l.Partition, l.Err))
+				continue
+			}
+			g.Partitions = append(g.Partitions, PartitionLag{
+				Topic:     l.Topic,
+				Partition: l.Partition,
+				Committed: l.Commit.At,
+				End:       l.End.Offset,
+				Lag:       l.Lag,
+			})
+			if snap.EndOffsets[l.Topic] == nil {
+				snap.EndOffsets[l.Topic] = map[int32]int64{}
+			}
+			snap.EndOffsets[l.Topic][l.Partition] = l.End.Offset
+		}
+		snap.Groups = append(snap.Groups, g)
+	}
+
+	if p.lookupTimeout > 0 {
+		if err := p.lookupOldest(ctx, snap, lags); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	snap.At, snap.Duration = time.Now(), time.Since(start)
+	return snap, warnings, nil
+}
+
+// lookupOldest sets the timestamps of the first unconsumed records. That
+// record is at the committed offset, or at the start of the partition when
+// the group has not committed or retention deleted the committed offset.
+func (p *Poller) lookupOldest(ctx context.Context, snap *Snapshot, lags kadm.DescribedGroupLags) error {
+	var wanted []recordAt
+	for _, g := range snap.Groups {
+		for _, pl := range g.Partitions {
+			if pl.Lag == 0 {
+				continue
+			}
+			wanted = append(wanted, p.oldestOffset(lags[g.Group].Lag, pl))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.lookupTimeout)
+	defer cancel()
+	found, err := p.timestamps.lookup(ctx, p.opts, wanted)
+
+	for gi := range snap.Groups {
+		g := &snap.Groups[gi]
+		for pi := range g.Partitions {
+			pl := &g.Partitions[pi]
+			if pl.Lag == 0 {
+				continue
+			}
+			pl.Oldest = found[p.oldestOffset(lags[g.Group].Lag, *pl)]
+		}
+	}
+	return err
+}
+
+func (p *Poller) oldestOffset(lag kadm.GroupLag, pl PartitionLag) recordAt {
+	at := recordAt{Topic: pl.Topic, Partition: pl.Partition, Offset: pl.Committed}
+	if l, ok := lag.Lookup(pl.Topic, pl.Partition); ok && l.Start.Err == nil && l.Start.Offset > at.Offset {
+		at.Offset = l.Start.Offset
+	}
+	return at
+}
+
+// Print writes the lag like kafka-consumer-groups.sh --describe, with the
+// time lag added
+func (s *Snapshot) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tSTATE\tTOPIC\tPARTITION\tCOMMITTED\tEND\tLAG\tTIME-LAG")
+	for _, g := range s.Groups {
+		if len(g.Partitions) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\t-\t-\n", g.Group, g.State)
+		}
+		for _, p := range g.Partitions {
+			committed := "-"
+			if p.Committed >= 0 {
+				committed = fmt.Sprint(p.Committed)
+			}
+			timeLag := "?"
+			if seconds, ok := p.LagSeconds(s.At); ok {
+				timeLag = time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%d\t%d\t%s\n", g.Group, g.State, p.Topic, p.Partition, committed, p.End, p.Lag, timeLag)
+		}
+	}
+	tw.Flush()
+}
+
+// groupsFilter compiles the -groups flag, an empty expression matches all
+// groups
+func groupsFilter(expr string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(expr) == "" {
+		expr = ".*"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -groups expression: %w", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// The fake cluster has a topic with fakeRecords records per partition, one
+// per minute up to now. orders-live consumes all of them and stays caught
+// up, orders-batch is an idle group that committed fakeCommitted.
+const (
+	fakeTopic      = "orders"
+	fakePartitions = 3
+	fakeRecords    = 100
+	fakeCommitted  = 40
+	fakeSpacing    = time.Minute
+)
+
+// startFake starts an in-process cluster with the groups above and returns
+// the options to connect to it
+func startFake(t *testing.T) []kgo.Opt {
+	t.Helper()
+	ctx := t.Context()
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(fakePartitions, fakeTopic))
+	if err != nil {
+		t.Fatalf("starting fake cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	opts := []kgo.Opt{kgo.SeedBrokers(cluster.ListenAddrs()...)}
+
+	cl := newClient(t, append(opts, kgo.RecordPartitioner(kgo.ManualPartitioner()))...)
+	start := time.Now().Add(-fakeRecords * fakeSpacing)
+	var records []*kgo.Record
+	for p := range int32(fakePartitions) {
+		for i := range fakeRecords {
+			records = append(records, &kgo.Record{
+				Topic:     fakeTopic,
+				Partition: p,
+				Key:       fmt.Appendf(nil, "order-%d-%d", p, i),
+				Value:     fmt.Appendf(nil, `{"id":%d}`, i),
+				Timestamp: start.Add(time.Duration(i+1) * fakeSpacing),
+			})
+		}
+	}
+	if err := cl.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		t.Fatalf("seeding fake cluster: %v", err)
+	}
+
+	adm := kadm.NewClient(cl)
+	offsets := kadm.Offsets{}
+	for p := range int32(fakePartitions) {
+		offsets.Add(kadm.Offset{Topic: fakeTopic, Partition: p, At: fakeCommitted, LeaderEpoch: -1})
+	}
+	if err := adm.CommitAllOffsets(ctx, "orders-batch", offsets); err != nil {
+		t.Fatalf("committing orders-batch: %v", err)
+	}
+
+	live := newClient(t, append(opts,
+		kgo.ConsumerGroup("orders-live"),
+		kgo.ConsumeTopics(fakeTopic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.AutoCommitInterval(100*time.Millisecond),
+	)...)
+	go func() {
+		for ctx.Err() == nil {
+			live.PollFetches(ctx)
+		}
+	}()
+	waitCaughtUp(t, adm, "orders-live")
+	return opts
+}
+
+func newClient(t *testing.T, opts ...kgo.Opt) *kgo.Client {
+	t.Helper()
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cl.Close)
+	return cl
+}
+
+// waitCaughtUp waits until the group consumed and committed every record
+func waitCaughtUp(t *testing.T, adm *kadm.Client, group string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 30*time.Second)
+	defer cancel()
+	for {
+		lags, err := adm.Lag(ctx, group)
+		if err == nil {
+			l := lags[group]
+			if l.Error() == nil && l.State == "Stable" && !l.Lag.IsEmpty() && l.Lag.Total() == 0 {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s did not catch up: %v", group, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func newTestPoller(t *testing.T, opts []kgo.Opt, groups string) *Poller {
+	t.Helper()
+	filter, err := groupsFilter(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPoller(newClient(t, opts...), opts, filter, 10*time.Second)
+}
+
+func pollGroups(t *testing.T, poller *Poller) (*Snapshot, map[string]GroupLag) {
+	t.Helper()
+	snap, warnings, err := poller.Poll(t.Context())
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Fatalf("Poll warnings: %v", warnings)
+	}
+	groups := map[string]GroupLag{}
+	for _, g := range snap.Groups {
+		groups[g.Group] = g
+	}
+	return snap, groups
+}
+
+func TestPoll(t *testing.T) {
+	opts := startFake(t)
+	snap, groups := pollGroups(t, newTestPoller(t, opts, ""))
+
+	batch, ok := groups["orders-batch"]
+	if !ok {
+		t.Fatal("orders-batch is missing")
+	}
+	if len(batch.Partitions) != fakePartitions {
+		t.Fatalf("orders-batch has lag for %d partitions, want %d", len(batch.Partitions), fakePartitions)
+	}
+	// The first unconsumed record is the one at the committed offset, the
+	// last record was written at now
+	wantSeconds := float64((fakeRecords - fakeCommitted - 1) * fakeSpacing / time.Second)
+	for i, p := range batch.Partitions {
+		if p.Topic != fakeTopic || p.Partition != int32(i) {
+			t.Errorf("partition %d is %s/%d, want partitions sorted", i, p.Topic, p.Partition)
+		}
+		if p.Committed != fakeCommitted || p.End != fakeRecords || p.Lag != fakeRecords-fakeCommitted {
+			t.Errorf("orders-batch %s/%d: committed %d, end %d, lag %d, want %d, %d, %d",
+				p.Topic, p.Partition, p.Committed, p.End, p.Lag, fakeCommitted, fakeRecords, fakeRecords-fakeCommitted)
+		}
+		seconds, ok := p.LagSeconds(snap.At)
+		if !ok || math.Abs(seconds-wantSeconds) > 30 {
+			t.Errorf("orders-batch %s/%d: time lag %.0fs (%v), want about %.0fs", p.Topic, p.Partition, seconds, ok, wantSeconds)
+		}
+		if end := snap.EndOffsets[fakeTopic][p.Partition]; end != fakeRecords {
+			t.Errorf("end offset of %s/%d is %d, want %d", p.Topic, p.Partition, end, fakeRecords)
+		}
+	}
+	if got, want := batch.Total(), int64(fakePartitions*(fakeRecords-fakeCommitted)); got != want {
+		t.Errorf("orders-batch total lag %d, want %d", got, want)
+	}
+
+	live, ok := groups["orders-live"]
+	if !ok {
+		t.Fatal("orders-live is missing")
+	}
+	if live.Members != 1 || live.State != "Stable" {
+		t.Errorf("orders-live is %s with %d members, want Stable with 1", live.State, live.Members)
+	}
+	for _, p := range live.Partitions {
+		seconds, ok := p.LagSeconds(snap.At)
+		if p.Lag != 0 || p.Committed != fakeRecords || seconds != 0 || !ok {
+			t.Errorf("orders-live %s/%d: committed %d, lag %d, time lag %.0fs (%v), want caught up",
+				p.Topic, p.Partition, p.Committed, p.Lag, seconds, ok)
+		}
+	}
+}
+
+func TestPollFilter(t *testing.T) {
+	opts := startFake(t)
+	_, groups := pollGroups(t, newTestPoller(t, opts, "-batch$"))
+	if _, ok := groups["orders-batch"]; !ok || len(groups) != 1 {
+		t.Errorf("polled groups %v, want only orders-batch", groups)
+	}
+}
+
+func TestLagSeconds(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		lag     PartitionLag
+		seconds float64
+		ok      bool
+	}{
+		{"caught up", PartitionLag{Lag: 0}, 0, true},
+		{"behind", PartitionLag{Lag: 5, Oldest: now.Add(-90 * time.Second)}, 90, true},
+		{"timestamp unknown", PartitionLag{Lag: 5}, 0, false},
+		{"timestamp in the future", PartitionLag{Lag: 5, Oldest: now.Add(time.Minute)}, 0, true},
+	}
+	for _, tt := range tests {
+		seconds, ok := tt.lag.LagSeconds(now)
+		if seconds != tt.seconds || ok != tt.ok {
+			t.Errorf("%s: LagSeconds = %v, %v, want %v, %v", tt.name, seconds, ok, tt.seconds, tt.ok)
+		}
+	}
+}
+
+// gather returns the values of the collected series by name and labels,
+// e.g. kafka_consumergroup_lag{group=orders-batch,partition=0,topic=orders}
+func gather(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gathering: %v", err)
+	}
+	series := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			name := f.GetName()
+			if len(labels) > 0 {
+				name += "{" + strings.Join(labels, ",") + "}"
+			}
+			if m.GetCounter() != nil {
+				series[name] = m.GetCounter().GetValue()
+			} else {
+				series[name] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+func TestCollect(t *testing.T) {
+	opts := startFake(t)
+	poller := newTestPoller(t, opts, "")
+	snap, _ := pollGroups(t, poller)
+
+	c := NewCollector()
+	if series := gather(t, c); len(series) != 1 || series["kafka_lag_exporter_poll_errors_total"] != 0 {
+		t.Errorf("collector without a snapshot exports %v, want only the poll errors", series)
+	}
+
+	c.Set(snap)
+	series := gather(t, c)
+	want := map[string]float64{
+		"kafka_consumergroup_lag{group=orders-batch,partition=1,topic=orders}":              fakeRecords - fakeCommitted,
+		"kafka_consumergroup_committed_offset{group=orders-batch,partition=1,topic=orders}": fakeCommitted,
+		"kafka_consumergroup_lag{group=orders-live,partition=1,topic=orders}":               0,
+		"kafka_consumergroup_lag_seconds{group=orders-live,partition=1,topic=orders}":       0,
+		"kafka_consumergroup_members{group=orders-live}":                                    1,
+		"kafka_consumergroup_state{group=orders-live,state=Stable}":                         1,
+		"kafka_topic_partition_end_offset{partition=2,topic=orders}":                        fakeRecords,
+	}
+	for name, value := range want {
+		if got, ok := series[name]; !ok || got != value {
+			t.Errorf("%s = %v (exported %v), want %v", name, got, ok, value)
+		}
+	}
+	if seconds := series["kafka_consumergroup_lag_seconds{group=orders-batch,partition=0,topic=orders}"]; seconds < float64((fakeRecords-fakeCommitted-1)*60-30) {
+		t.Errorf("time lag of orders-batch is %.0fs, want about an hour", seconds)
+	}
+
+	// A failed poll keeps the last snapshot
+	c.PollFailed()
+	series = gather(t, c)
+	if series["kafka_lag_exporter_poll_errors_total"] != 1 || series["kafka_consumergroup_members{group=orders-live}"] != 1 {
+		t.Errorf("after a failed poll the collector exports %v", series)
+	}
+
+	// Deleted groups are dropped with the next snapshot
+	adm := kadm.NewClient(newClient(t, opts...))
+	deleted, err := adm.DeleteGroup(t.Context(), "orders-batch")
+	if err == nil {
+		err = deleted.Err
+	}
+	if err != nil {
+		t.Fatalf("deleting orders-batch: %v", err)
+	}
+	snap, groups := pollGroups(t, poller)
+	if _, ok := groups["orders-batch"]; ok {
+		t.Fatal("poll still returns the deleted orders-batch")
+	}
+	c.Set(snap)
+	series = gather(t, c)
+	for name := range series {
+		if strings.Contains(name, "group=orders-batch") {
+			t.Errorf("%s is still exported after orders-batch was deleted", name)
+		}
+	}
+	if _, ok := series["kafka_consumergroup_lag{group=orders-live,partition=0,topic=orders}"]; !ok {
+		t.Error("orders-live is no longer exported")
+	}
+}
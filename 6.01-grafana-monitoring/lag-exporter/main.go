@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"kafkaclient"
+	"kafkaobs"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("lag exporter failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	interval := flag.Duration("interval", 30*time.Second, "time between polls of the group offsets")
+	groupsExpr := flag.String("groups", "", "regular expression of the groups to export, defaults to all consumer groups")
+	lookupTimeout := flag.Duration("lookup-timeout", 10*time.Second, "time to read the records at the committed offsets for the time lag, 0 disables it")
+	once := flag.Bool("once", false, "print the lag once and exit")
+	app := kafkaobs.New("lag-exporter")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// The endpoint is served after the first poll, -once prints the lag
+	// without it
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	groups, err := groupsFilter(*groupsExpr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	logger.Info("connecting", "brokers", cfg.String())
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	cl, err := kgo.NewClient(append(app.Opts(), opts...)...)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(cl))
+	poller := NewPoller(cl, opts, groups, *lookupTimeout)
+
+	snap, err := poll(ctx, poller, logger)
+	if err != nil {
+		return err
+	}
+	if *once {
+		snap.Print(os.Stdout)
+		return nil
+	}
+
+	collector := NewCollector()
+	collector.Set(snap)
+	app.Metrics.MustRegister(collector)
+	addr, err := app.Serve(ctx, ":9315")
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		return fmt.Errorf("KAFKA_METRICS_ADDR=off disables the only output of the exporter, use -once to print the lag")
+	}
+	logger.Info("exporting lag", "groups", len(snap.Groups), "interval", *interval)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping")
+			return nil
+		case <-ticker.C:
+		}
+		snap, err := poll(ctx, poller, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			collector.PollFailed()
+			logger.Warn("poll failed", "err", err)
+			continue
+		}
+		collector.Set(snap)
+	}
+}
+
+// poll polls once and logs the warnings
+func poll(ctx context.Context, poller *Poller, logger *slog.Logger) (*Snapshot, error) {
+	snap, warnings, err := poller.Poll(ctx)
+	for _, w := range warnings {
+		logger.Warn("incomplete lag", "warning", w)
+	}
+	return snap, err
+}
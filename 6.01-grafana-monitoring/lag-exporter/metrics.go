@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lagDesc = prometheus.NewDesc("kafka_consumergroup_lag",
+		"Records the group has not consumed yet: end offset minus committed offset",
+		[]string{"group", "topic", "partition"}, nil)
+	lagSecondsDesc = prometheus.NewDesc("kafka_consumergroup_lag_seconds",
+		"Age of the oldest record the group has not consumed, 0 when it is caught up",
+		[]string{"group", "topic", "partition"}, nil)
+	committedDesc = prometheus.NewDesc("kafka_consumergroup_committed_offset",
+		"Offset committed by the group",
+		[]string{"group", "topic", "partition"}, nil)
+	membersDesc = prometheus.NewDesc("kafka_consumergroup_members",
+		"Members of the group",
+		[]string{"group"}, nil)
+	stateDesc = prometheus.NewDesc("kafka_consumergroup_state",
+		"State of the group, always 1",
+		[]string{"group", "state"}, nil)
+	endOffsetDesc = prometheus.NewDesc("kafka_topic_partition_end_offset",
+		"End offset of a partition consumed by a group",
+		[]string{"topic", "partition"}, nil)
+	pollDurationDesc = prometheus.NewDesc("kafka_lag_exporter_poll_duration_seconds",
+		"Duration of the last poll", nil, nil)
+	pollTimeDesc = prometheus.NewDesc("kafka_lag_exporter_last_poll_timestamp_seconds",
+		"Time of the last successful poll", nil, nil)
+)
+
+// Collector exports the latest snapshot. Gauges of groups and partitions
+// that disappear are dropped with the next snapshot instead of lingering.
+type Collector struct {
+	mu   sync.Mutex
+	snap *Snapshot
+
+	pollErrors prometheus.Counter
+}
+
+// NewCollector returns a collector that exports nothing until the first
+// snapshot is set
+func NewCollector() *Collector {
+	return &Collector{
+		pollErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_lag_exporter_poll_errors_total",
+			Help: "Polls that failed",
+		}),
+	}
+}
+
+// Set replaces the exported snapshot
+func (c *Collector) Set(snap *Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snap = snap
+}
+
+// PollFailed counts a failed poll, the previous snapshot stays exported
+func (c *Collector) PollFailed() {
+	c.pollErrors.Inc()
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{lagDesc, lagSecondsDesc, committedDesc, membersDesc, stateDesc, endOffsetDesc, pollDurationDesc, pollTimeDesc} {
+		ch <- d
+	}
+	c.pollErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. The time lag is computed at
+// scrape time, so it keeps growing between polls while a group is stuck.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.pollErrors.Collect(ch)
+
+	c.mu.Lock()
+	snap := c.snap
+	c.mu.Unlock()
+	if snap == nil {
+		return
+	}
+
+	now := time.Now()
+	ch <- prometheus.MustNewConstMetric(pollDurationDesc, prometheus.GaugeValue, snap.Duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(pollTimeDesc, prometheus.GaugeValue, float64(snap.At.UnixMilli())/1000)
+
+	for _, g := range snap.Groups {
+		ch <- prometheus.MustNewConstMetric(membersDesc, prometheus.GaugeValue, float64(g.Members), g.Group)
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 1, g.Group, g.State)
+		for _, p := range g.Partitions {
+			partition := strconv.Itoa(int(p.Partition))
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(p.Lag), g.Group, p.Topic, partition)
+			if p.Committed >= 0 {
+				ch <- prometheus.MustNewConstMetric(committedDesc, prometheus.GaugeValue, float64(p.Committed), g.Group, p.Topic, partition)
+			}
+			if seconds, ok := p.LagSeconds(now); ok {
+				ch <- prometheus.MustNewConstMetric(lagSecondsDesc, prometheus.GaugeValue, seconds, g.Group, p.Topic, partition)
+			}
+		}
+	}
+	for t, ps := range snap.EndOffsets {
+		for p, end := range ps {
+			ch <- prometheus.MustNewConstMetric(endOffsetDesc, prometheus.GaugeValue, float64(end), t, strconv.Itoa(int(p)))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// recordAt is the position of a record
+type recordAt struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// timestampCache remembers the timestamps of the records it looked up.
+// Records never change, but a group usually stays at the same offset for
+// several polls when it is stuck, which is when the time lag matters most.
+type timestampCache struct {
+	found map[recordAt]time.Time
+}
+
+func newTimestampCache() *timestampCache {
+	return &timestampCache{found: map[recordAt]time.Time{}}
+}
+
+// lookup returns the timestamps of the records at the wanted positions.
+// When a record no longer exists, because retention or compaction removed
+// it, the timestamp of the next record is used. Positions that could not
+// be read before ctx is done are missing from the result.
+//
+// A client consumes a partition from one offset only, so groups at
+// different offsets of the same partition are looked up in rounds.
+func (c *timestampCache) lookup(ctx context.Context, opts []kgo.Opt, wanted []recordAt) (map[recordAt]time.Time, error) {
+	found := make(map[recordAt]time.Time, len(wanted))
+	pending := map[string]map[int32][]int64{}
+	for _, at := range wanted {
+		if _, ok := found[at]; ok {
+			continue
+		}
+		if ts, ok := c.found[at]; ok {
+			found[at] = ts
+			continue
+		}
+		if pending[at.Topic] == nil {
+			pending[at.Topic] = map[int32][]int64{}
+		}
+		if offsets := pending[at.Topic][at.Partition]; !slices.Contains(offsets, at.Offset) {
+			pending[at.Topic][at.Partition] = append(offsets, at.Offset)
+		}
+	}
+
+	var err error
+	for len(pending) > 0 && err == nil {
+		round := map[string]map[int32]kgo.Offset{}
+		for t, ps := range pending {
+			round[t] = map[int32]kgo.Offset{}
+			for p, offsets := range ps {
+				round[t][p] = kgo.NewOffset().At(offsets[0])
+				if len(offsets) == 1 {
+					delete(ps, p)
+				} else {
+					ps[p] = offsets[1:]
+				}
+			}
+			if len(ps) == 0 {
+				delete(pending, t)
+			}
+		}
+		err = c.lookupRound(ctx, opts, round, found)
+	}
+
+	c.found = found
+	return found, err
+}
+
+// lookupRound reads the first record from every partition of round
+func (c *timestampCache) lookupRound(ctx context.Context, opts []kgo.Opt, round map[string]map[int32]kgo.Offset, found map[recordAt]time.Time) error {
+	remaining := map[string]map[int32]int64{}
+	n := 0
+	for t, ps := range round {
+		remaining[t] = map[int32]int64{}
+		for p, o := range ps {
+			remaining[t][p] = o.EpochOffset().Offset
+			n++
+		}
+	}
+
+	cl, err := kgo.NewClient(append(slices.Clone(opts),
+		kgo.ConsumePartitions(round),
+		// Offsets deleted by retention reset to the oldest record left
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)...)
+	if err != nil {
+		return fmt.Errorf("creating lookup client: %w", err)
+	}
+	defer cl.Close()
+
+	for n > 0 {
+		fetches := cl.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return fmt.Errorf("reading record timestamps: %d partitions did not answer in time", n)
+		}
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			if len(p.Records) == 0 {
+				return
+			}
+			want, ok := remaining[p.Topic][p.Partition]
+			if !ok {
+				return
+			}
+			found[recordAt{Topic: p.Topic, Partition: p.Partition, Offset: want}] = p.Records[0].Timestamp
+			delete(remaining[p.Topic], p.Partition)
+			cl.PauseFetchPartitions(map[string][]int32{p.Topic: {p.Partition}})
+			n--
+		})
+	}
+	return nil
+}
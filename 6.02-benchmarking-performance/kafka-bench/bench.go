@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Result is what a run measured
+type Result struct {
+	Config Config
+	// Elapsed is the time from the first send to the last acknowledgement
+	Elapsed  time.Duration
+	Produced int
+	Failed   int
+	Consumed int
+	// Ack is the latency from send to acknowledgement, like the latencies
+	// of kafka-producer-perf-test.sh
+	Ack Histogram
+	// EndToEnd is the latency from send to poll by the consumer
+	EndToEnd Histogram
+	// Errors are the first produce and fetch errors
+	Errors []string
+}
+
+// RecordsPerSecond is the producer throughput
+func (r *Result) RecordsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Produced) / r.Elapsed.Seconds()
+}
+
+// MBPerSecond is the producer throughput in MB of values, without keys,
+// headers and compression, like kafka-producer-perf-test.sh
+func (r *Result) MBPerSecond() float64 {
+	return r.RecordsPerSecond() * float64(r.Config.RecordSize) / (1 << 20)
+}
+
+// maxRecordSize is the largest -record-size, the default limit of the
+// brokers is about 1 MB
+const maxRecordSize = 1 << 20
+
+// maxErrors caps Result.Errors, a broker going away fails every record
+const maxErrors = 5
+
+// payloadPool holds random uppercase letters, like the values of
+// kafka-producer-perf-test.sh. Values are copied from varying offsets, so a
+// batch is not one value repeated, which would compress unrealistically
+// well.
+var payloadPool = func() []byte {
+	pool := make([]byte, 2*maxRecordSize)
+	for i := range pool {
+		pool[i] = 'A' + byte(rand.IntN(26))
+	}
+	return pool
+}()
+
+// bench produces to cfg.Topic and consumes what it produces at the same
+// time. Every value starts with the run ID and the send time, which the
+// consumer subtracts from the poll time for the end-to-end latency.
+func bench(ctx context.Context, opts []kgo.Opt, cfg Config) (*Result, error) {
+	popts, err := cfg.producerOpts()
+	if err != nil {
+		return nil, err
+	}
+	producer, err := kgo.NewClient(append(slices.Clone(opts), append(popts, kgo.DefaultProduceTopic(cfg.Topic))...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer producer.Close()
+
+	ends, err := kadm.NewClient(producer).ListEndOffsets(ctx, cfg.Topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing end offsets of %s: %w", cfg.Topic, err)
+	}
+	start := map[int32]kgo.Offset{}
+	ends.Each(func(o kadm.ListedOffset) {
+		start[o.Partition] = kgo.NewOffset().At(o.Offset)
+	})
+	if len(start) == 0 {
+		return nil, fmt.Errorf("topic %s does not exist, create it first", cfg.Topic)
+	}
+
+	// The consumer reads the partitions directly from the current end, a
+	// group would add a rebalance to the first latencies
+	consumer, err := kgo.NewClient(append(slices.Clone(opts),
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{cfg.Topic: start}),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	res := &Result{Config: cfg}
+	c := &benchConsumer{cl: consumer, runID: rand.Uint64(), ready: make(chan struct{})}
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		c.run(consumeCtx)
+	}()
+	defer func() {
+		stopConsuming()
+		<-consumed
+	}()
+
+	if err := c.warmUp(ctx, producer, cfg.Drain); err != nil {
+		return nil, err
+	}
+	produce(ctx, producer, c.runID, res)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Wait for the consumer to read every record the broker acknowledged
+	deadline := time.Now().Add(cfg.Drain)
+	for c.consumed.Load() < int64(res.Produced) && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stopConsuming()
+	<-consumed
+	res.Consumed = int(c.consumed.Load())
+	res.EndToEnd = c.latency
+	res.Errors = append(res.Errors, c.errors...)
+	return res, ctx.Err()
+}
+
+// produce sends the records of res.Config, paced to its rate, and waits for
+// their acknowledgements
+func produce(ctx context.Context, producer *kgo.Client, runID uint64, res *Result) {
+	cfg := res.Config
+	var (
+		mu     sync.Mutex
+		offset int
+	)
+	start := time.Now()
+	for i := 0; ctx.Err() == nil; i++ {
+		if cfg.Duration > 0 && time.Since(start) >= cfg.Duration || cfg.Duration <= 0 && i >= cfg.Records {
+			break
+		}
+		if cfg.Rate > 0 {
+			// Sleep until the record is due; a producer that fell behind
+			// catches up without sleeping
+			due := start.Add(time.Duration(i) * time.Second / time.Duration(cfg.Rate))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		value := make([]byte, cfg.RecordSize)
+		offset = (offset + 7919) % (len(payloadPool) - cfg.RecordSize)
+		copy(value[headerSize:], payloadPool[offset:])
+		binary.BigEndian.PutUint64(value, runID)
+		r := &kgo.Record{Value: value}
+		if cfg.Keys > 0 {
+			r.Key = strconv.AppendInt([]byte("key-"), int64(i%cfg.Keys), 10)
+		}
+
+		sent := time.Now()
+		binary.BigEndian.PutUint64(value[8:], uint64(sent.UnixNano()))
+		producer.Produce(ctx, r, func(_ *kgo.Record, err error) {
+			latency := time.Since(sent)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Failed++
+				if len(res.Errors) < maxErrors {
+					res.Errors = append(res.Errors, "produce: "+err.Error())
+				}
+				return
+			}
+			res.Produced++
+			res.Ack.Record(latency)
+		})
+	}
+	producer.Flush(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	res.Elapsed = time.Since(start)
+}
+
+// benchConsumer reads the records of one run
+type benchConsumer struct {
+	cl       *kgo.Client
+	runID    uint64
+	ready    chan struct{}
+	readyOne sync.Once
+	consumed atomic.Int64
+	// latency and errors belong to run until it returns
+	latency Histogram
+	errors  []string
+}
+
+// run records the end-to-end latency of the records of the run until ctx is
+// done. Records of other runs and programs are skipped.
+func (c *benchConsumer) run(ctx context.Context) {
+	for {
+		fetches := c.cl.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		polled := time.Now()
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if len(c.errors) < maxErrors && !errors.Is(err, context.Canceled) {
+				c.errors = append(c.errors, fmt.Sprintf("fetch %s/%d: %v", topic, partition, err))
+			}
+		})
+		fetches.EachRecord(func(r *kgo.Record) {
+			if len(r.Value) < headerSize || binary.BigEndian.Uint64(r.Value) != c.runID {
+				return
+			}
+			sent := int64(binary.BigEndian.Uint64(r.Value[8:]))
+			if sent == 0 {
+				c.readyOne.Do(func() { close(c.ready) })
+				return
+			}
+			c.latency.Record(polled.Sub(time.Unix(0, sent)))
+			c.consumed.Add(1)
+		})
+	}
+}
+
+// warmUp produces a record without a send time and waits for the consumer to
+// read it. The connections and metadata of both clients are then loaded, so
+// setting them up does not count in the first latencies.
+func (c *benchConsumer) warmUp(ctx context.Context, producer *kgo.Client, timeout time.Duration) error {
+	value := make([]byte, headerSize)
+	binary.BigEndian.PutUint64(value, c.runID)
+	if err := producer.ProduceSync(ctx, &kgo.Record{Value: value}).FirstErr(); err != nil {
+		return fmt.Errorf("producing the warm-up record: %w", err)
+	}
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(timeout):
+		return fmt.Errorf("the consumer did not read the warm-up record within %s", timeout)
+	}
+}
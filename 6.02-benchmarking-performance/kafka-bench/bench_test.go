@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	fakeTopic      = "perf-test"
+	fakePartitions = 3
+)
+
+// startFake starts an in-process cluster with the topic and returns the
+// options to connect to it
+func startFake(t *testing.T) []kgo.Opt {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(fakePartitions, fakeTopic))
+	if err != nil {
+		t.Fatalf("starting fake cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return []kgo.Opt{kgo.SeedBrokers(cluster.ListenAddrs()...)}
+}
+
+// testConfig is a short run with the defaults of the flags
+func testConfig() Config {
+	return Config{
+		Topic:       fakeTopic,
+		Records:     500,
+		RecordSize:  100,
+		Acks:        "all",
+		Compression: "none",
+		BatchSize:   16384,
+		Drain:       10 * time.Second,
+	}
+}
+
+func TestBench(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+	}{
+		{"defaults", func(*Config) {}},
+		{"keys and compression", func(c *Config) { c.Keys = 10; c.Compression = "zstd"; c.Linger = 5 * time.Millisecond }},
+		{"leader ack", func(c *Config) { c.Acks = "1" }},
+		{"rate", func(c *Config) { c.Records = 100; c.Rate = 1000 }},
+		{"record larger than a batch", func(c *Config) { c.Records = 50; c.RecordSize = 20000 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.change(&cfg)
+			if err := cfg.validate(); err != nil {
+				t.Fatal(err)
+			}
+			res, err := bench(t.Context(), startFake(t), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Errors) > 0 {
+				t.Errorf("errors: %s", strings.Join(res.Errors, "; "))
+			}
+			if res.Produced != cfg.Records || res.Failed != 0 || res.Consumed != cfg.Records {
+				t.Errorf("produced %d, failed %d, consumed %d, want %d records", res.Produced, res.Failed, res.Consumed, cfg.Records)
+			}
+			if n := res.Ack.Count(); n != uint64(cfg.Records) {
+				t.Errorf("%d ack latencies, want %d", n, cfg.Records)
+			}
+			if n := res.EndToEnd.Count(); n != uint64(cfg.Records) {
+				t.Errorf("%d end-to-end latencies, want %d", n, cfg.Records)
+			}
+			if cfg.Rate > 0 {
+				if want := time.Duration(cfg.Records-1) * time.Second / time.Duration(cfg.Rate); res.Elapsed < want {
+					t.Errorf("elapsed %s at %d/s, want at least %s", res.Elapsed, cfg.Rate, want)
+				}
+			}
+		})
+	}
+}
+
+// TestBenchRuns checks that a run only counts its own records, not those of
+// an earlier run on the same topic
+func TestBenchRuns(t *testing.T) {
+	opts := startFake(t)
+	cfg := testConfig()
+	for run := range 2 {
+		res, err := bench(t.Context(), opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Consumed != cfg.Records {
+			t.Errorf("run %d consumed %d records, want %d", run, res.Consumed, cfg.Records)
+		}
+	}
+}
+
+func TestBenchMissingTopic(t *testing.T) {
+	cfg := testConfig()
+	cfg.Topic = "missing"
+	if _, err := bench(t.Context(), startFake(t), cfg); err == nil {
+		t.Error("bench of a missing topic succeeded")
+	}
+}
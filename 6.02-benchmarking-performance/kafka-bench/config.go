@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// headerSize is the start of every value: the run ID, so a run ignores the
+// records of other runs and programs, and the send time in nanoseconds
+const headerSize = 16
+
+// batchOverhead bounds the bytes a batch of one record adds to its value: the
+// batch header, the length, delta and header fields of the record and its key
+const batchOverhead = 256
+
+// minBatchSize is the smallest batch limit the Go client accepts
+const minBatchSize = 512
+
+// Config is one benchmark run. The producer settings are named after the
+// Java producer properties of kafka-producer-perf-test.sh.
+type Config struct {
+	Topic       string
+	Records     int
+	Duration    time.Duration
+	Rate        int
+	RecordSize  int
+	Keys        int
+	Acks        string
+	Compression string
+	Linger      time.Duration
+	BatchSize   int
+	// Drain is how long the consumer may take to read the last records once
+	// the producer is done
+	Drain time.Duration
+}
+
+// sweepable are the flags -sweep can vary
+var sweepable = []string{"rate", "record-size", "keys", "acks", "compression", "linger", "batch-size"}
+
+// bindFlags registers the flags of cfg, with the defaults of the Java
+// producer where the Go client differs
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Topic, "topic", "perf-test", "topic to produce to and consume from")
+	fs.IntVar(&cfg.Records, "records", 100000, "records to produce, ignored with -duration")
+	fs.DurationVar(&cfg.Duration, "duration", 0, "produce for this long instead of a number of records")
+	fs.IntVar(&cfg.Rate, "rate", 0, "records per second, 0 produces as fast as possible")
+	fs.IntVar(&cfg.RecordSize, "record-size", 1000, fmt.Sprintf("bytes per record value, at least %d", headerSize))
+	fs.IntVar(&cfg.Keys, "keys", 0, "distinct keys, 0 produces records without a key")
+	fs.StringVar(&cfg.Acks, "acks", "all", "acks: all, 1 or 0")
+	fs.StringVar(&cfg.Compression, "compression", "none", "compression: none, gzip, snappy, lz4 or zstd")
+	fs.DurationVar(&cfg.Linger, "linger", 0, "time a batch waits for more records, like linger.ms")
+	fs.IntVar(&cfg.BatchSize, "batch-size", 16384, "maximum bytes of a batch, like batch.size")
+	fs.DurationVar(&cfg.Drain, "drain", 10*time.Second, "time the consumer may take to read the last records")
+}
+
+func (cfg Config) validate() error {
+	switch {
+	case cfg.Records <= 0 && cfg.Duration <= 0:
+		return fmt.Errorf("-records or -duration must be positive")
+	case cfg.Rate < 0:
+		return fmt.Errorf("-rate must not be negative")
+	case cfg.RecordSize < headerSize:
+		return fmt.Errorf("-record-size must be at least %d bytes to hold the send time", headerSize)
+	case cfg.RecordSize > maxRecordSize:
+		return fmt.Errorf("-record-size must be at most %d bytes", maxRecordSize)
+	case cfg.Keys < 0:
+		return fmt.Errorf("-keys must not be negative")
+	case cfg.BatchSize < minBatchSize:
+		return fmt.Errorf("-batch-size must be at least %d bytes", minBatchSize)
+	}
+	if _, err := cfg.producerOpts(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// producerOpts translates the producer settings to client options. The Go
+// client fails records that don't fit in a batch, the Java producer sends them
+// in a batch of their own, so batches grow to hold one record.
+func (cfg Config) producerOpts() ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.ProducerLinger(cfg.Linger),
+		kgo.ProducerBatchMaxBytes(int32(max(cfg.BatchSize, cfg.RecordSize+batchOverhead))),
+	}
+
+	switch cfg.Acks {
+	case "all", "-1":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "1":
+		// Idempotent writes require acks=all
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "0":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("unknown -acks %q, expected all, 1 or 0", cfg.Acks)
+	}
+
+	codecs := map[string]kgo.CompressionCodec{
+		"none":   kgo.NoCompression(),
+		"gzip":   kgo.GzipCompression(),
+		"snappy": kgo.SnappyCompression(),
+		"lz4":    kgo.Lz4Compression(),
+		"zstd":   kgo.ZstdCompression(),
+	}
+	codec, ok := codecs[strings.ToLower(cfg.Compression)]
+	if !ok {
+		return nil, fmt.Errorf("unknown -compression %q, expected none, gzip, snappy, lz4 or zstd", cfg.Compression)
+	}
+	return append(opts, kgo.ProducerBatchCompression(codec)), nil
+}
+
+// String describes the run in one line
+func (cfg Config) String() string {
+	amount := fmt.Sprintf("%d records", cfg.Records)
+	if cfg.Duration > 0 {
+		amount = "for " + cfg.Duration.String()
+	}
+	rate := "unthrottled"
+	if cfg.Rate > 0 {
+		rate = fmt.Sprintf("%d/s", cfg.Rate)
+	}
+	keys := "no keys"
+	if cfg.Keys > 0 {
+		keys = fmt.Sprintf("%d keys", cfg.Keys)
+	}
+	return fmt.Sprintf("%s of %d B to %s, %s, %s, acks=%s compression=%s linger=%s batch-size=%d",
+		amount, cfg.RecordSize, cfg.Topic, rate, keys, cfg.Acks, cfg.Compression, cfg.Linger, cfg.BatchSize)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// subBits sets the precision of the histogram: each power of two of
+// microseconds is split into 1<<subBits buckets, so a percentile is off by
+// less than 1/64, about 1.6%
+const subBits = 6
+
+// Histogram counts latencies in log-linear buckets of microseconds. It keeps
+// percentiles of millions of records in a few KB, where sorting samples
+// would hold every one of them.
+type Histogram struct {
+	counts [64 << subBits]uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// Record adds a latency, negative ones from clock skew count as zero
+func (h *Histogram) Record(d time.Duration) {
+	d = max(d, 0)
+	h.counts[bucket(uint64(d/time.Microsecond))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	h.max = max(h.max, d)
+	h.count++
+	h.sum += d
+}
+
+// Merge adds the latencies of o
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	h.max = max(h.max, o.max)
+	h.count += o.count
+	h.sum += o.sum
+}
+
+// Count is the number of latencies recorded
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Mean is the exact average latency
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Max is the exact highest latency
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the latency under which q of the latencies fall, for q
+// between 0 and 1. It is the middle of the bucket, clamped to the exact
+// minimum and maximum.
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	rank = min(max(rank, 1), h.count)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			low, high := bucketRange(i)
+			d := time.Duration(low+high) * time.Microsecond / 2
+			return min(max(d, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// bucket returns the bucket of v: values under 2<<subBits have their own
+// bucket, larger ones keep their top subBits+1 bits
+func bucket(v uint64) int {
+	if v < 2<<subBits {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBits - 1
+	return (shift+1)<<subBits + int(v>>shift) - 1<<subBits
+}
+
+// bucketRange returns the lowest value of bucket i and the lowest value of
+// the next one
+func bucketRange(i int) (low, high uint64) {
+	if i < 2<<subBits {
+		return uint64(i), uint64(i) + 1
+	}
+	shift := i>>subBits - 1
+	mantissa := uint64(i&(1<<subBits-1) + 1<<subBits)
+	return mantissa << shift, (mantissa + 1) << shift
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		v         uint64
+		bucket    int
+		low, high uint64
+	}{
+		{0, 0, 0, 1},
+		{1, 1, 1, 2},
+		{127, 127, 127, 128},
+		// From 2<<subBits on, a bucket spans more than one value
+		{128, 128, 128, 130},
+		{129, 128, 128, 130},
+		{130, 129, 130, 132},
+		{255, 191, 254, 256},
+		{256, 192, 256, 260},
+		{1000, 317, 1000, 1008},
+		{1 << 40, 35 << subBits, 1 << 40, 1<<40 + 1<<34},
+	}
+	for _, tt := range tests {
+		b := bucket(tt.v)
+		if b != tt.bucket {
+			t.Errorf("bucket(%d) = %d, want %d", tt.v, b, tt.bucket)
+		}
+		if low, high := bucketRange(tt.bucket); low != tt.low || high != tt.high {
+			t.Errorf("bucketRange(%d) = [%d, %d), want [%d, %d)", tt.bucket, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+// TestBucketRanges checks that the buckets cover the values without gaps and
+// are at most 1/64 of their values wide
+func TestBucketRanges(t *testing.T) {
+	// The bucket of the largest uint64 ends beyond it, the ones after it
+	// are never used
+	for i := range bucket(math.MaxUint64) {
+		low, high := bucketRange(i)
+		if next, _ := bucketRange(i + 1); next != high {
+			t.Fatalf("bucket %d ends at %d, bucket %d starts at %d", i, high, i+1, next)
+		}
+		if bucket(low) != i || bucket(high-1) != i {
+			t.Fatalf("bucket %d is [%d, %d), but bucket(%d) = %d and bucket(%d) = %d", i, low, high, low, bucket(low), high-1, bucket(high-1))
+		}
+		if high-low > max(1, low>>subBits) {
+			t.Fatalf("bucket %d is [%d, %d), wider than 1/64 of its values", i, low, high)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	// oneToHundred is 1 ms to 100 ms in steps of 1 ms
+	var oneToHundred []time.Duration
+	for i := 1; i <= 100; i++ {
+		oneToHundred = append(oneToHundred, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		q         float64
+		want      time.Duration
+	}{
+		{"empty", nil, 0.5, 0},
+		{"one latency", []time.Duration{5 * time.Millisecond}, 0.5, 5 * time.Millisecond},
+		{"negative counts as zero", []time.Duration{-time.Millisecond}, 0.99, 0},
+		{"minimum", oneToHundred, 0, time.Millisecond},
+		{"p50", oneToHundred, 0.5, 50 * time.Millisecond},
+		{"p95", oneToHundred, 0.95, 95 * time.Millisecond},
+		{"p99", oneToHundred, 0.99, 99 * time.Millisecond},
+		{"maximum", oneToHundred, 1, 100 * time.Millisecond},
+		{"microseconds", []time.Duration{10 * time.Microsecond, 20 * time.Microsecond, 30 * time.Microsecond}, 0.5, 20 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		var h Histogram
+		for _, d := range tt.latencies {
+			h.Record(d)
+		}
+		got := h.Percentile(tt.q)
+		// A percentile is the middle of its bucket, at most half a bucket
+		// and at least half a microsecond off
+		if diff := (got - tt.want).Abs(); diff > max(tt.want>>(subBits+1), time.Microsecond/2) {
+			t.Errorf("%s: Percentile(%g) = %s, want %s", tt.name, tt.q, got, tt.want)
+		}
+	}
+}
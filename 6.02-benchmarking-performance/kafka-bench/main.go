@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"kafkaclient"
+	"kafkaobs"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("kafka-bench failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	app := kafkaobs.New("kafka-bench")
+	app.BindFlags(flag.CommandLine)
+	var cfg Config
+	cfg.bindFlags(flag.CommandLine)
+	format := flag.String("format", "table", "output format: table or json")
+	sweepExpr := flag.String("sweep", "", "run once per value of a flag and compare, like compression=none,lz4,zstd")
+	flag.Parse()
+	if err := app.StartLogging(); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	// Results go to stdout, progress is logged to stderr
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown -format %q, expected table or json", *format)
+	}
+
+	param, values, err := parseSweep(*sweepExpr)
+	if err != nil {
+		return err
+	}
+	// Each run is the flags with the swept one set to its value; all runs
+	// are checked before the first starts
+	configs := []Config{cfg}
+	if param != "" {
+		configs = configs[:0]
+		for _, v := range values {
+			if err := flag.Set(param, v); err != nil {
+				return fmt.Errorf("-sweep %s=%s: %w", param, v, err)
+			}
+			configs = append(configs, cfg)
+		}
+	}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	kcfg, err := kafkaclient.Load("localhost:9092")
+	if err != nil {
+		return err
+	}
+	logger.Info("connecting to Kafka", "kafka", kcfg.String())
+	opts, err := kcfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+	// Only the client logs, the metric hooks of app.Opts would add work to
+	// the clients being measured
+	opts = append(opts, kgo.WithLogger(kafkaobs.NewClientLogger(logger)))
+
+	var results []*Result
+	for i, c := range configs {
+		logger.Info("starting run", "run", c.String())
+		res, err := bench(ctx, opts, c)
+		if err != nil {
+			return err
+		}
+		results = append(results, res)
+		res.LogProblems(logger)
+		if *format == "table" {
+			res.Print(os.Stdout)
+			if i < len(configs)-1 {
+				fmt.Println()
+			}
+		}
+	}
+
+	if *format == "json" {
+		return writeJSON(os.Stdout, param, values, results)
+	}
+	if param != "" {
+		fmt.Printf("\n%s sweep\n", param)
+		printComparison(os.Stdout, param, values, results)
+	}
+	return nil
+}
+
+// parseSweep splits -sweep into the flag and its values
+func parseSweep(expr string) (param string, values []string, err error) {
+	if expr == "" {
+		return "", nil, nil
+	}
+	param, list, ok := strings.Cut(expr, "=")
+	if !ok || list == "" {
+		return "", nil, fmt.Errorf("-sweep must look like flag=value1,value2, got %q", expr)
+	}
+	if !slices.Contains(sweepable, param) {
+		return "", nil, fmt.Errorf("-sweep cannot vary %q, expected one of %s", param, strings.Join(sweepable, ", "))
+	}
+	for v := range strings.SplitSeq(list, ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return param, values, nil
+}
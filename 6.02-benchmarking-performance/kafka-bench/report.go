@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+)
+
+// percentiles are the latency percentiles of every report
+var percentiles = []struct {
+	name string
+	q    float64
+}{
+	{"p50", 0.50},
+	{"p95", 0.95},
+	{"p99", 0.99},
+	{"p99.9", 0.999},
+}
+
+// ms formats a latency in milliseconds, the unit of the Java perf tools
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2f", msFloat(d))
+}
+
+// LogProblems logs failed and unconsumed records and the first errors of a
+// run, which make its numbers questionable
+func (r *Result) LogProblems(l *slog.Logger) {
+	if r.Failed > 0 {
+		l.Warn("records failed", "run", r.Config.String(), "failed", r.Failed)
+	}
+	if r.Consumed < r.Produced {
+		l.Warn("records were not consumed in time", "run", r.Config.String(),
+			"unconsumed", r.Produced-r.Consumed, "drain", r.Config.Drain)
+	}
+	for _, e := range r.Errors {
+		l.Warn("run error", "run", r.Config.String(), "err", e)
+	}
+}
+
+// Print writes the throughput and the latency table of a run
+func (r *Result) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d records produced in %s: %.0f records/s, %.2f MB/s\n",
+		r.Produced, r.Elapsed.Round(time.Millisecond), r.RecordsPerSecond(), r.MBPerSecond())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "LATENCY (ms)\tRECORDS\tMEAN\t")
+	for _, p := range percentiles {
+		fmt.Fprintf(tw, "%s\t", p.name)
+	}
+	fmt.Fprintln(tw, "MAX\t")
+	for _, row := range []struct {
+		name string
+		h    *Histogram
+	}{
+		{"ack", &r.Ack},
+		{"end-to-end", &r.EndToEnd},
+	} {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t", row.name, row.h.Count(), ms(row.h.Mean()))
+		for _, p := range percentiles {
+			fmt.Fprintf(tw, "%s\t", ms(row.h.Percentile(p.q)))
+		}
+		fmt.Fprintf(tw, "%s\t\n", ms(row.h.Max()))
+	}
+	tw.Flush()
+}
+
+// printComparison writes one line per run of a sweep of param
+func printComparison(w io.Writer, param string, values []string, results []*Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s\tRECORDS/S\tMB/S\tACK p99\t", param)
+	for _, p := range percentiles {
+		fmt.Fprintf(tw, "E2E %s\t", p.name)
+	}
+	fmt.Fprintln(tw, "CONSUMED\t")
+	for i, r := range results {
+		fmt.Fprintf(tw, "%s\t%.0f\t%.2f\t%s\t", values[i], r.RecordsPerSecond(), r.MBPerSecond(), ms(r.Ack.Percentile(0.99)))
+		for _, p := range percentiles {
+			fmt.Fprintf(tw, "%s\t", ms(r.EndToEnd.Percentile(p.q)))
+		}
+		fmt.Fprintf(tw, "%d/%d\t\n", r.Consumed, r.Produced)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "latencies in ms")
+}
+
+// jsonResult is the JSON form of a run, latencies are in milliseconds
+type jsonResult struct {
+	Config           jsonConfig  `json:"config"`
+	Value            string      `json:"value,omitempty"`
+	ElapsedSeconds   float64     `json:"elapsed_seconds"`
+	Produced         int         `json:"produced"`
+	Failed           int         `json:"failed"`
+	Consumed         int         `json:"consumed"`
+	RecordsPerSecond float64     `json:"records_per_second"`
+	MBPerSecond      float64     `json:"mb_per_second"`
+	AckLatency       jsonLatency `json:"ack_latency_ms"`
+	EndToEndLatency  jsonLatency `json:"end_to_end_latency_ms"`
+	Errors           []string    `json:"errors,omitempty"`
+}
+
+type jsonConfig struct {
+	Topic       string  `json:"topic"`
+	Records     int     `json:"records,omitempty"`
+	Duration    string  `json:"duration,omitempty"`
+	Rate        int     `json:"rate"`
+	RecordSize  int     `json:"record_size"`
+	Keys        int     `json:"keys"`
+	Acks        string  `json:"acks"`
+	Compression string  `json:"compression"`
+	LingerMs    float64 `json:"linger_ms"`
+	BatchSize   int     `json:"batch_size"`
+}
+
+type jsonLatency struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p99_9"`
+	Max   float64 `json:"max"`
+}
+
+func toJSON(r *Result, value string) jsonResult {
+	cfg := jsonConfig{
+		Topic:       r.Config.Topic,
+		Rate:        r.Config.Rate,
+		RecordSize:  r.Config.RecordSize,
+		Keys:        r.Config.Keys,
+		Acks:        r.Config.Acks,
+		Compression: r.Config.Compression,
+		LingerMs:    msFloat(r.Config.Linger),
+		BatchSize:   r.Config.BatchSize,
+	}
+	if r.Config.Duration > 0 {
+		cfg.Duration = r.Config.Duration.String()
+	} else {
+		cfg.Records = r.Config.Records
+	}
+	return jsonResult{
+		Config:           cfg,
+		Value:            value,
+		ElapsedSeconds:   r.Elapsed.Seconds(),
+		Produced:         r.Produced,
+		Failed:           r.Failed,
+		Consumed:         r.Consumed,
+		RecordsPerSecond: r.RecordsPerSecond(),
+		MBPerSecond:      r.MBPerSecond(),
+		AckLatency:       latencyJSON(&r.Ack),
+		EndToEndLatency:  latencyJSON(&r.EndToEnd),
+		Errors:           r.Errors,
+	}
+}
+
+func latencyJSON(h *Histogram) jsonLatency {
+	return jsonLatency{
+		Count: h.Count(),
+		Mean:  msFloat(h.Mean()),
+		P50:   msFloat(h.Percentile(0.50)),
+		P95:   msFloat(h.Percentile(0.95)),
+		P99:   msFloat(h.Percentile(0.99)),
+		P999:  msFloat(h.Percentile(0.999)),
+		Max:   msFloat(h.Max()),
+	}
+}
+
+func msFloat(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writeJSON writes a run, or the runs of a sweep with the swept parameter
+func writeJSON(w io.Writer, param string, values []string, results []*Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if param == "" {
+		return enc.Encode(toJSON(results[0], ""))
+	}
+	sweep := struct {
+		Parameter string       `json:"parameter"`
+		Runs      []jsonResult `json:"runs"`
+	}{Parameter: param}
+	for i, r := range results {
+		sweep.Runs = append(sweep.Runs, toJSON(r, values[i]))
+	}
+	return enc.Encode(sweep)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"kafkaclient"
+	"kafkaobs"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("canary failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var cfg Config
+	flag.StringVar(&cfg.Topic, "topic", "canary", "topic of the probes, created when it does not exist")
+	flag.IntVar(&cfg.Partitions, "partitions", 0, "partitions of a created topic, defaults to one per broker")
+	flag.DurationVar(&cfg.Interval, "interval", time.Second, "time between probes of a partition")
+	flag.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "time a probe may take to be consumed before it fails")
+	flag.DurationVar(&cfg.LatencyThreshold, "latency-threshold", 250*time.Millisecond, "end-to-end latency of a good probe for the latency SLO")
+	flag.Float64Var(&cfg.AvailabilityObjective, "availability-objective", 0.999, "fraction of probes that must be consumed within -timeout")
+	flag.Float64Var(&cfg.LatencyObjective, "latency-objective", 0.99, "fraction of probes that must be consumed within -latency-threshold")
+	report := flag.Duration("report", 10*time.Second, "time between summaries")
+	app := kafkaobs.New("canary")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	for _, objective := range []float64{cfg.AvailabilityObjective, cfg.LatencyObjective} {
+		if objective <= 0 || objective >= 1 {
+			return fmt.Errorf("objectives must be between 0 and 1, got %v", objective)
+		}
+	}
+	if cfg.Interval <= 0 || cfg.Timeout <= 0 || *report <= 0 {
+		return fmt.Errorf("-interval, -timeout and -report must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := app.Start(ctx, ":9316"); err != nil {
+		return err
+	}
+	logger := app.Logger
+
+	kcfg, err := kafkaclient.Load("localhost:9092", "localhost:9094", "localhost:9095")
+	if err != nil {
+		return err
+	}
+	logger.Info("connecting", "brokers", kcfg.String())
+	opts, err := kcfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	prober, err := NewProber(ctx, append(opts, app.Opts()...), cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer prober.Close()
+	app.Metrics.MustRegister(prober.metrics.collectors()...)
+	app.Metrics.MustRegister(prober.slos)
+	app.AddCheck("kafka", kafkaobs.Ping(prober.producer))
+	logger.Info("probing", "topic", cfg.Topic, "partitions", prober.Partitions(), "interval", cfg.Interval)
+
+	prober.Run(ctx, *report)
+	logger.Info("stopping")
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets go up to the probe timeout, a leader election takes
+// seconds
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// canaryMetrics are the metrics of the probes. The broker label is the
+// leader of the partition when the probe was sent, "none" when the
+// partition had no leader.
+type canaryMetrics struct {
+	probes          *prometheus.CounterVec
+	failures        *prometheus.CounterVec
+	produceLatency  *prometheus.HistogramVec
+	endToEndLatency *prometheus.HistogramVec
+	up              *prometheus.GaugeVec
+	leader          *prometheus.GaugeVec
+	lost            *prometheus.CounterVec
+	duplicated      *prometheus.CounterVec
+}
+
+func newCanaryMetrics() *canaryMetrics {
+	probe := []string{"partition", "broker"}
+	return &canaryMetrics{
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_canary_probes_total",
+			Help: "Probes resolved, counted when they are consumed or fail",
+		}, probe),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_canary_probe_failures_total",
+			Help: "Probes that failed by reason: produce, timeout or lost",
+		}, append(probe, "reason")),
+		produceLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kafka_canary_produce_latency_seconds",
+			Help:    "Time from sending a probe until the brokers acknowledge it",
+			Buckets: latencyBuckets,
+		}, probe),
+		endToEndLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kafka_canary_end_to_end_latency_seconds",
+			Help:    "Time from sending a probe until it is consumed",
+			Buckets: latencyBuckets,
+		}, probe),
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_canary_partition_up",
+			Help: "Whether the last resolved probe of the partition succeeded",
+		}, []string{"partition"}),
+		leader: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_canary_partition_leader",
+			Help: "Broker leading the partition, -1 when it has no leader",
+		}, []string{"partition"}),
+		lost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_canary_records_lost_total",
+			Help: "Acknowledged probes that were skipped by the consumer",
+		}, []string{"partition"}),
+		duplicated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_canary_records_duplicated_total",
+			Help: "Probes consumed more than once",
+		}, []string{"partition"}),
+	}
+}
+
+// collectors returns the metrics to register
+func (m *canaryMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.probes, m.failures, m.produceLatency, m.endToEndLatency, m.up, m.leader, m.lost, m.duplicated}
+}
+
+var (
+	objectiveDesc = prometheus.NewDesc("kafka_canary_slo_objective",
+		"Fraction of the probes that must be good",
+		[]string{"slo"}, nil)
+	burnRateDesc = prometheus.NewDesc("kafka_canary_slo_burn_rate",
+		"Ratio of bad probes over the window divided by the ratio the objective allows",
+		[]string{"slo", "window"}, nil)
+)
+
+// sloCollector computes the burn rates at scrape time, a window without
+// probes has no burn rate
+type sloCollector []*SLO
+
+// Describe implements prometheus.Collector
+func (c sloCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- objectiveDesc
+	ch <- burnRateDesc
+}
+
+// Collect implements prometheus.Collector
+func (c sloCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for _, s := range c {
+		ch <- prometheus.MustNewConstMetric(objectiveDesc, prometheus.GaugeValue, s.Objective, s.Name)
+		for _, w := range burnWindows {
+			if rate, ok := s.BurnRate(now, w.d); ok {
+				ch <- prometheus.MustNewConstMetric(burnRateDesc, prometheus.GaugeValue, rate, s.Name, w.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// probeSize is the value of a probe: the run ID, so a canary ignores the
+// probes of earlier runs and other canaries, the sequence number in the
+// partition and the send time in nanoseconds
+const probeSize = 24
+
+// Reasons a probe fails
+const (
+	reasonProduce = "produce"
+	reasonTimeout = "timeout"
+	reasonLost    = "lost"
+)
+
+// Config of the prober
+type Config struct {
+	Topic string
+	// Partitions of a topic the canary creates, 0 for one per broker
+	Partitions int
+	Interval   time.Duration
+	// Timeout is how long a probe may take to be consumed before it fails
+	Timeout time.Duration
+	// LatencyThreshold is the end-to-end latency a probe must beat to be
+	// good for the latency SLO
+	LatencyThreshold      time.Duration
+	AvailabilityObjective float64
+	LatencyObjective      float64
+}
+
+// probe is a heartbeat that is neither consumed nor failed yet
+type probe struct {
+	sent   time.Time
+	broker string
+	acked  bool
+}
+
+// partitionState tracks the probes of a partition
+type partitionState struct {
+	id      int32
+	nextSeq uint64
+	pending map[uint64]*probe
+	// lastSeq is the highest sequence number consumed
+	lastSeq uint64
+	// up is the outcome of the last resolved probe, resolved is false until
+	// the first one
+	up, resolved bool
+	downSince    time.Time
+	leader       int32
+}
+
+// Prober sends a sequenced probe to every partition of the canary topic each
+// interval and consumes them back
+type Prober struct {
+	cfg      Config
+	runID    uint64
+	producer *kgo.Client
+	consumer *kgo.Client
+	metrics  *canaryMetrics
+	slos     sloCollector
+	logger   *slog.Logger
+
+	mu         sync.Mutex
+	partitions []*partitionState
+	window     windowStats
+}
+
+// windowStats summarizes the probes resolved since the last report
+type windowStats struct {
+	resolved, failed int
+	slowest          time.Duration
+}
+
+// NewProber connects the producer and the consumer of the canary topic,
+// creating the topic when it does not exist. The consumer starts at the end
+// of every partition.
+func NewProber(ctx context.Context, opts []kgo.Opt, cfg Config, logger *slog.Logger) (*Prober, error) {
+	producer, err := kgo.NewClient(append(slices.Clone(opts),
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		// Fail probes instead of retrying them forever, and linger as
+		// little as possible, a probe is never batched with another of the
+		// same partition
+		kgo.RecordDeliveryTimeout(cfg.Timeout),
+		kgo.ProducerLinger(0),
+		// Notice preferred leader elections without waiting for an error
+		kgo.MetadataMaxAge(10*time.Second),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	adm := kadm.NewClient(producer)
+	topic, err := ensureTopic(ctx, adm, cfg.Topic, cfg.Partitions, logger)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	ends, err := adm.ListEndOffsets(ctx, cfg.Topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		producer.Close()
+		return nil, fmt.Errorf("listing end offsets of %s: %w", cfg.Topic, err)
+	}
+	start := map[int32]kgo.Offset{}
+	ends.Each(func(o kadm.ListedOffset) {
+		start[o.Partition] = kgo.NewOffset().At(o.Offset)
+	})
+	consumer, err := kgo.NewClient(append(slices.Clone(opts),
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{cfg.Topic: start}),
+		kgo.FetchMaxWait(time.Second),
+		// Never read old probes again after losing the position
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
+		kgo.MetadataMaxAge(10*time.Second),
+	)...)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+
+	p := &Prober{
+		cfg:      cfg,
+		runID:    rand.Uint64(),
+		producer: producer,
+		consumer: consumer,
+		metrics:  newCanaryMetrics(),
+		slos: sloCollector{
+			NewSLO("availability", cfg.AvailabilityObjective),
+			NewSLO("latency", cfg.LatencyObjective),
+		},
+		logger: logger.With("topic", cfg.Topic),
+	}
+	for id := range int32(len(topic.Partitions)) {
+		// Until the producer loads the leaders with the first probes
+		leader := topic.Partitions[id].Leader
+		p.partitions = append(p.partitions, &partitionState{id: id, nextSeq: 1, pending: map[uint64]*probe{}, leader: leader})
+		p.metrics.leader.WithLabelValues(partitionLabel(id)).Set(float64(leader))
+	}
+	return p, nil
+}
+
+// Close closes the clients
+func (p *Prober) Close() {
+	p.producer.Close()
+	p.consumer.Close()
+}
+
+// Partitions is the number of partitions probed
+func (p *Prober) Partitions() int {
+	return len(p.partitions)
+}
+
+// Run probes until ctx is done, printing partitions that go down and come
+// back, and a summary every report interval
+func (p *Prober) Run(ctx context.Context, report time.Duration) {
+	go p.consume(ctx)
+
+	probes := time.NewTicker(p.cfg.Interval)
+	defer probes.Stop()
+	reports := time.NewTicker(report)
+	defer reports.Stop()
+	p.send(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reports.C:
+			p.report()
+		case <-probes.C:
+			p.expire(time.Now())
+			p.send(ctx)
+		}
+	}
+}
+
+// send produces a probe to every partition
+func (p *Prober) send(ctx context.Context) {
+	for _, st := range p.partitions {
+		leader := p.leader(st)
+		broker := "none"
+		if leader >= 0 {
+			broker = strconv.Itoa(int(leader))
+		}
+
+		p.mu.Lock()
+		seq := st.nextSeq
+		st.nextSeq++
+		sent := time.Now()
+		st.pending[seq] = &probe{sent: sent, broker: broker}
+		p.mu.Unlock()
+
+		value := make([]byte, probeSize)
+		binary.BigEndian.PutUint64(value, p.runID)
+		binary.BigEndian.PutUint64(value[8:], seq)
+		binary.BigEndian.PutUint64(value[16:], uint64(sent.UnixNano()))
+		r := &kgo.Record{Partition: st.id, Value: value}
+		p.producer.Produce(ctx, r, func(r *kgo.Record, err error) {
+			if err != nil {
+				if ctx.Err() == nil {
+					p.resolve(st, seq, time.Now(), reasonProduce, err)
+				}
+				return
+			}
+			p.metrics.produceLatency.WithLabelValues(partitionLabel(st.id), broker).Observe(time.Since(sent).Seconds())
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if pr := st.pending[seq]; pr != nil {
+				pr.acked = true
+			}
+		})
+	}
+}
+
+// leader returns the broker leading the partition according to the
+// producer, which loads it with the first probe and refreshes it when
+// leadership moves
+func (p *Prober) leader(st *partitionState) int32 {
+	leader, _, err := p.producer.PartitionLeader(p.cfg.Topic, st.id)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err != nil:
+		leader = -1
+	case leader < 0:
+		// Not loaded yet
+		return st.leader
+	}
+	if leader != st.leader {
+		p.metrics.leader.WithLabelValues(partitionLabel(st.id)).Set(float64(leader))
+		st.leader = leader
+	}
+	return leader
+}
+
+// consume resolves the probes of the run until ctx is done
+func (p *Prober) consume(ctx context.Context) {
+	for {
+		fetches := p.consumer.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		polled := time.Now()
+		fetches.EachRecord(func(r *kgo.Record) {
+			if len(r.Value) != probeSize || binary.BigEndian.Uint64(r.Value) != p.runID || int(r.Partition) >= len(p.partitions) {
+				return
+			}
+			p.consumed(p.partitions[r.Partition], binary.BigEndian.Uint64(r.Value[8:]), polled)
+		})
+	}
+}
+
+// consumed resolves a probe read back from its partition. Probes are
+// consumed in the order they were sent, so an acknowledged probe older than
+// it that is still pending was lost.
+func (p *Prober) consumed(st *partitionState, seq uint64, polled time.Time) {
+	p.mu.Lock()
+	if seq <= st.lastSeq {
+		p.mu.Unlock()
+		p.metrics.duplicated.WithLabelValues(partitionLabel(st.id)).Inc()
+		return
+	}
+	st.lastSeq = seq
+	var lost []uint64
+	for s, pr := range st.pending {
+		if s < seq && pr.acked {
+			lost = append(lost, s)
+		}
+	}
+	p.mu.Unlock()
+
+	slices.Sort(lost)
+	for _, s := range lost {
+		p.metrics.lost.WithLabelValues(partitionLabel(st.id)).Inc()
+		p.resolve(st, s, polled, reasonLost, nil)
+	}
+	p.resolve(st, seq, polled, "", nil)
+}
+
+// expire fails the probes that were not consumed within the timeout
+func (p *Prober) expire(now time.Time) {
+	for _, st := range p.partitions {
+		p.mu.Lock()
+		var expired []uint64
+		for seq, pr := range st.pending {
+			if now.Sub(pr.sent) > p.cfg.Timeout {
+				expired = append(expired, seq)
+			}
+		}
+		p.mu.Unlock()
+		slices.Sort(expired)
+		for _, seq := range expired {
+			p.resolve(st, seq, now, reasonTimeout, nil)
+		}
+	}
+}
+
+// resolve records the outcome of a pending probe: reason is empty when it
+// was consumed at the given time, otherwise it is why it failed, with the
+// produce error. A probe that already failed is not counted again when it
+// shows up late.
+func (p *Prober) resolve(st *partitionState, seq uint64, at time.Time, reason string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr := st.pending[seq]
+	if pr == nil {
+		return
+	}
+	delete(st.pending, seq)
+
+	partition := partitionLabel(st.id)
+	latency := at.Sub(pr.sent)
+	p.metrics.probes.WithLabelValues(partition, pr.broker).Inc()
+	p.window.resolved++
+	up := reason == ""
+	if up {
+		p.metrics.endToEndLatency.WithLabelValues(partition, pr.broker).Observe(latency.Seconds())
+		p.window.slowest = max(p.window.slowest, latency)
+	} else {
+		p.metrics.failures.WithLabelValues(partition, pr.broker, reason).Inc()
+		p.window.failed++
+	}
+	p.slos[0].Record(pr.sent, up)
+	p.slos[1].Record(pr.sent, up && latency <= p.cfg.LatencyThreshold)
+
+	if st.resolved && st.up == up {
+		return
+	}
+	logger := p.logger.With("partition", st.id)
+	if !up {
+		attrs := []any{"leader", pr.broker, "reason", reason}
+		if err != nil {
+			attrs = append(attrs, "err", err)
+		}
+		logger.Warn("partition is down", attrs...)
+		// The partition went dark when the probe was sent
+		st.downSince = pr.sent
+	} else if st.resolved {
+		logger.Info("partition is back", "leader", st.leader, "down_for", at.Sub(st.downSince).Round(time.Second))
+	}
+	st.up, st.resolved = up, true
+	p.metrics.up.WithLabelValues(partition).Set(boolValue(up))
+}
+
+// report prints the probes resolved since the last report and the burn
+// rates of the shortest windows
+func (p *Prober) report() {
+	p.mu.Lock()
+	w := p.window
+	p.window = windowStats{}
+	var down []string
+	for _, st := range p.partitions {
+		if st.resolved && !st.up {
+			down = append(down, partitionLabel(st.id))
+		}
+	}
+	p.mu.Unlock()
+
+	now := time.Now()
+	attrs := []any{"probes", w.resolved, "failed", w.failed, "slowest", w.slowest.Round(time.Millisecond)}
+	for _, s := range p.slos {
+		fast, _ := s.BurnRate(now, burnWindows[0].d)
+		slow, _ := s.BurnRate(now, burnWindows[2].d)
+		attrs = append(attrs, slog.Group(s.Name+"_burn",
+			burnWindows[0].name, roundRate(fast),
+			burnWindows[2].name, roundRate(slow)))
+	}
+	if len(down) > 0 {
+		attrs = append(attrs, "down", down)
+	}
+	p.logger.Info("probes resolved", attrs...)
+}
+
+// roundRate keeps one decimal of a burn rate for the logs
+func roundRate(rate float64) float64 {
+	return math.Round(rate*10) / 10
+}
+
+func partitionLabel(id int32) string {
+	return strconv.Itoa(int(id))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// The fake cluster has three brokers, each leading a partition of the canary
+// topic
+const (
+	fakeTopic   = "canary"
+	fakeBrokers = 3
+)
+
+// fakeCluster can kill its brokers. A dead broker closes the connections of
+// produce and fetch requests, like a killed container, while its partitions
+// keep it as their leader until they elect another one.
+type fakeCluster struct {
+	*kfake.Cluster
+	dead atomic.Int32
+}
+
+func startFake(t *testing.T) *fakeCluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(fakeBrokers), kfake.SeedTopics(fakeBrokers, fakeTopic))
+	if err != nil {
+		t.Fatalf("starting fake cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	for p := range int32(fakeBrokers) {
+		if err := cluster.MoveTopicPartition(fakeTopic, p, p); err != nil {
+			t.Fatalf("spreading the leaders of %s: %v", fakeTopic, err)
+		}
+	}
+
+	c := &fakeCluster{Cluster: cluster}
+	c.dead.Store(-1)
+	for _, key := range []kmsg.Key{kmsg.Produce, kmsg.Fetch} {
+		cluster.ControlKey(int16(key), func(kmsg.Request) (kmsg.Response, error, bool) {
+			cluster.KeepControl()
+			if cluster.CurrentNode() != c.dead.Load() {
+				return nil, nil, false
+			}
+			return nil, errors.New("broker is down"), true
+		})
+	}
+	return c
+}
+
+func (c *fakeCluster) opts() []kgo.Opt {
+	return []kgo.Opt{kgo.SeedBrokers(c.ListenAddrs()...)}
+}
+
+// newTestProber starts a prober on the cluster that consumes until the test
+// ends. The test sends the probes and expires them itself.
+func newTestProber(t *testing.T, opts []kgo.Opt) *Prober {
+	t.Helper()
+	cfg := Config{
+		Topic:                 fakeTopic,
+		Interval:              100 * time.Millisecond,
+		Timeout:               2 * time.Second,
+		LatencyThreshold:      time.Second,
+		AvailabilityObjective: 0.999,
+		LatencyObjective:      0.99,
+	}
+	p, err := NewProber(t.Context(), opts, cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewProber: %v", err)
+	}
+	t.Cleanup(p.Close)
+	if p.Partitions() != fakeBrokers {
+		t.Fatalf("probing %d partitions, want %d", p.Partitions(), fakeBrokers)
+	}
+	go p.consume(t.Context())
+	return p
+}
+
+// probeUntil sends probes and expires the old ones every interval until the
+// partitions are in the given state, all of them when partition is -1
+func probeUntil(t *testing.T, p *Prober, partition int32, up bool) {
+	t.Helper()
+	// Probes are sent with the context of the test, the prober drops the
+	// outcome of probes whose context is done
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		p.expire(time.Now())
+		p.send(t.Context())
+		p.mu.Lock()
+		reached := true
+		for _, st := range p.partitions {
+			if (partition < 0 || st.id == partition) && (!st.resolved || st.up != up) {
+				reached = false
+			}
+		}
+		p.mu.Unlock()
+		if reached {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("partition %d did not become up=%v", partition, up)
+		}
+		time.Sleep(p.cfg.Interval)
+	}
+}
+
+// waitSettled waits until every probe that was sent is resolved
+func waitSettled(t *testing.T, p *Prober) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		pending := 0
+		for _, st := range p.partitions {
+			pending += len(st.pending)
+		}
+		p.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("probes are still pending")
+}
+
+// gather returns the values of the series of the prober by name and labels,
+// e.g. kafka_canary_partition_up{partition=0}
+func gather(t *testing.T, p *Prober) map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(p.metrics.collectors()...)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gathering: %v", err)
+	}
+	series := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			name := f.GetName() + "{" + strings.Join(labels, ",") + "}"
+			switch {
+			case m.GetCounter() != nil:
+				series[name] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				series[name] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+// TestProberBrokerFailure kills the leader of partition 0: the partition goes
+// down while the others stay up, and comes back once it elects another
+// leader
+func TestProberBrokerFailure(t *testing.T) {
+	cluster := startFake(t)
+	p := newTestProber(t, cluster.opts())
+	probeUntil(t, p, -1, true)
+
+	cluster.dead.Store(0)
+	probeUntil(t, p, 0, false)
+	series := gather(t, p)
+	if v := series["kafka_canary_partition_up{partition=0}"]; v != 0 {
+		t.Errorf("partition 0 up = %v while its leader is dead", v)
+	}
+	for _, partition := range []string{"1", "2"} {
+		if v := series["kafka_canary_partition_up{partition="+partition+"}"]; v != 1 {
+			t.Errorf("partition %s up = %v, its leader is alive", partition, v)
+		}
+	}
+	failed := 0.0
+	for name, v := range series {
+		if strings.HasPrefix(name, "kafka_canary_probe_failures_total{broker=0,partition=0,") {
+			failed += v
+		}
+	}
+	if failed == 0 {
+		t.Error("no failed probes of partition 0 on broker 0")
+	}
+	if rate, ok := p.slos[0].BurnRate(time.Now(), time.Hour); !ok || rate == 0 {
+		t.Errorf("availability burn rate = %v, %v with failed probes", rate, ok)
+	}
+
+	if err := cluster.MoveTopicPartition(fakeTopic, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	probeUntil(t, p, 0, true)
+	if v := gather(t, p)["kafka_canary_partition_leader{partition=0}"]; v != 1 {
+		t.Errorf("partition 0 leader = %v after the election, want 1", v)
+	}
+
+	// The broker recovers and leads its partition again
+	cluster.dead.Store(-1)
+	if err := cluster.MoveTopicPartition(fakeTopic, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	probeUntil(t, p, -1, true)
+}
+
+// TestProberLostAndDuplicated checks that an acknowledged probe the consumer
+// skips counts as lost, and a probe consumed twice as duplicated
+func TestProberLostAndDuplicated(t *testing.T) {
+	cluster := startFake(t)
+	p := newTestProber(t, cluster.opts())
+	probeUntil(t, p, -1, true)
+	waitSettled(t, p)
+
+	// An acknowledged probe that is not in the log, as after an unclean
+	// leader election truncated it
+	st := p.partitions[0]
+	p.mu.Lock()
+	seq := st.nextSeq
+	st.nextSeq++
+	st.pending[seq] = &probe{sent: time.Now(), broker: "0", acked: true}
+	p.mu.Unlock()
+	p.send(t.Context())
+	waitSettled(t, p)
+
+	// A probe of the run that was already consumed, as after a producer
+	// retry without idempotence
+	value := make([]byte, probeSize)
+	binary.BigEndian.PutUint64(value, p.runID)
+	binary.BigEndian.PutUint64(value[8:], 1)
+	binary.BigEndian.PutUint64(value[16:], uint64(time.Now().UnixNano()))
+	cl, err := kgo.NewClient(append(cluster.opts(), kgo.RecordPartitioner(kgo.ManualPartitioner()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if err := cl.ProduceSync(t.Context(), &kgo.Record{Topic: fakeTopic, Partition: 1, Value: value}).FirstErr(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for gather(t, p)["kafka_canary_records_duplicated_total{partition=1}"] == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	series := gather(t, p)
+	want := map[string]float64{
+		"kafka_canary_records_lost_total{partition=0}":                           1,
+		"kafka_canary_probe_failures_total{broker=0,partition=0,reason=lost}":    1,
+		"kafka_canary_records_duplicated_total{partition=1}":                     1,
+		"kafka_canary_records_lost_total{partition=1}":                           0,
+		"kafka_canary_records_duplicated_total{partition=0}":                     0,
+		"kafka_canary_probe_failures_total{broker=1,partition=1,reason=lost}":    0,
+		"kafka_canary_probe_failures_total{broker=0,partition=0,reason=timeout}": 0,
+	}
+	for name, v := range want {
+		if series[name] != v {
+			t.Errorf("%s = %v, want %v", name, series[name], v)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// burnWindows are the windows of the exported burn rates, the pairs of the
+// multiwindow alerts of the Google SRE workbook: page when both 1h and 5m
+// burn faster than 14.4, open a ticket when both 6h and 30m burn faster
+// than 6
+var burnWindows = []struct {
+	name string
+	d    time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// SLO counts good and bad probes per second over the longest burn window
+type SLO struct {
+	Name      string
+	Objective float64
+
+	mu      sync.Mutex
+	buckets []sloBucket
+}
+
+// sloBucket counts the probes sent during one second
+type sloBucket struct {
+	sec       int64
+	good, bad uint64
+}
+
+// NewSLO returns an objective of the fraction of good probes, like 0.999
+func NewSLO(name string, objective float64) *SLO {
+	longest := burnWindows[len(burnWindows)-1].d
+	return &SLO{
+		Name:      name,
+		Objective: objective,
+		buckets:   make([]sloBucket, longest/time.Second),
+	}
+}
+
+// Record counts a probe in the second it was sent
+func (s *SLO) Record(sent time.Time, good bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sec := sent.Unix()
+	b := &s.buckets[sec%int64(len(s.buckets))]
+	switch {
+	case b.sec > sec:
+		// Older than the longest window
+		return
+	case b.sec < sec:
+		*b = sloBucket{sec: sec}
+	}
+	if good {
+		b.good++
+	} else {
+		b.bad++
+	}
+}
+
+// BurnRate is how fast the error budget burns over the window before now:
+// the ratio of bad probes divided by the ratio the objective allows. At 1
+// the budget lasts exactly the SLO period, at 14.4 a 30 day budget is gone
+// in about 2 days. ok is false when no probe was sent in the window.
+func (s *SLO) BurnRate(now time.Time, window time.Duration) (rate float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from := now.Add(-window).Unix()
+	var good, bad uint64
+	for _, b := range s.buckets {
+		if b.sec > from && b.sec <= now.Unix() {
+			good += b.good
+			bad += b.bad
+		}
+	}
+	if good+bad == 0 {
+		return 0, false
+	}
+	return float64(bad) / float64(good+bad) / (1 - s.Objective), true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBurnRate(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// bad and good probes sent at the given times before now
+		bad, good []time.Duration
+		window    time.Duration
+		rate      float64
+		ok        bool
+	}{
+		{"no probes", nil, nil, time.Hour, 0, false},
+		{"all good", nil, []time.Duration{time.Second, time.Minute}, time.Hour, 0, true},
+		{"budget rate", []time.Duration{time.Second}, repeat(time.Second, 999), time.Hour, 1, true},
+		{"all bad", []time.Duration{time.Second, time.Minute}, nil, time.Hour, 1000, true},
+		{"outside the window", []time.Duration{10 * time.Minute}, []time.Duration{time.Second}, 5 * time.Minute, 0, true},
+		{"inside a longer window", []time.Duration{10 * time.Minute}, []time.Duration{time.Second}, 30 * time.Minute, 500, true},
+		{"at the window start", []time.Duration{time.Hour}, []time.Duration{time.Second}, time.Hour, 0, true},
+		{"after now", []time.Duration{-time.Second}, []time.Duration{time.Second}, time.Hour, 0, true},
+	}
+	for _, tt := range tests {
+		s := NewSLO("availability", 0.999)
+		for _, ago := range tt.bad {
+			s.Record(now.Add(-ago), false)
+		}
+		for _, ago := range tt.good {
+			s.Record(now.Add(-ago), true)
+		}
+		rate, ok := s.BurnRate(now, tt.window)
+		if math.Abs(rate-tt.rate) > 1e-6 || ok != tt.ok {
+			t.Errorf("%s: BurnRate = %v, %v, want %v, %v", tt.name, rate, ok, tt.rate, tt.ok)
+		}
+	}
+}
+
+// TestBurnRateRing checks that a bucket is reused once its second is more
+// than the longest window ago
+func TestBurnRateRing(t *testing.T) {
+	longest := burnWindows[len(burnWindows)-1].d
+	start := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	s := NewSLO("availability", 0.999)
+	s.Record(start, false)
+
+	// The bad probe leaves the window, its bucket still holds it
+	later := start.Add(longest)
+	if rate, ok := s.BurnRate(later, longest); ok {
+		t.Errorf("BurnRate after the window = %v, want no probes", rate)
+	}
+
+	// A probe of the same bucket a window later replaces it
+	s.Record(later, true)
+	if rate, ok := s.BurnRate(later, longest); rate != 0 || !ok {
+		t.Errorf("BurnRate with the reused bucket = %v, %v, want 0, true", rate, ok)
+	}
+	if rate, ok := s.BurnRate(later, time.Second); rate != 0 || !ok {
+		t.Errorf("BurnRate of the last second = %v, %v, want 0, true", rate, ok)
+	}
+
+	// A probe older than the bucket it maps to is dropped
+	s.Record(start, false)
+	if rate, _ := s.BurnRate(later, 2*longest); rate != 0 {
+		t.Errorf("BurnRate after a late old probe = %v, want 0", rate)
+	}
+
+	// Hours later every bucket is reused by a bad probe, the good probe of
+	// the reused bucket is not counted with them
+	reused := later.Add(7 * time.Hour)
+	for sec := range longest / time.Second {
+		s.Record(reused.Add(sec*time.Second), false)
+	}
+	rate, ok := s.BurnRate(reused.Add(longest), 2*longest)
+	if want := 1000.0; !ok || math.Abs(rate-want) > 1e-6 {
+		t.Errorf("BurnRate after reusing every bucket = %v, %v, want %v, true", rate, ok, want)
+	}
+}
+
+func repeat(d time.Duration, n int) []time.Duration {
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		ds[i] = d
+	}
+	return ds
+}
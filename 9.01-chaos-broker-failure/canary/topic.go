@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+// canaryRetention keeps the canary topic small, probes are only read once
+// right after they are written
+const canaryRetention = time.Hour
+
+// ensureTopic describes the canary topic, after creating it when it does
+// not exist. A new topic has a partition per broker and up to three
+// replicas, so every broker leads a partition and a dead broker shows up as
+// a dark partition.
+func ensureTopic(ctx context.Context, adm *kadm.Client, topic string, partitions int, logger *slog.Logger) (kadm.TopicDetail, error) {
+	detail, err := describeTopic(ctx, adm, topic)
+	if !errors.Is(err, kerr.UnknownTopicOrPartition) {
+		return detail, err
+	}
+
+	brokers, err := adm.ListBrokers(ctx)
+	if err != nil {
+		return detail, fmt.Errorf("listing brokers: %w", err)
+	}
+	if partitions <= 0 {
+		partitions = len(brokers)
+	}
+	replicas := min(len(brokers), 3)
+	retention := strconv.FormatInt(canaryRetention.Milliseconds(), 10)
+	resp, err := adm.CreateTopic(ctx, int32(partitions), int16(replicas), map[string]*string{"retention.ms": &retention}, topic)
+	if err == nil {
+		err = resp.Err
+	}
+	if err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+		return detail, fmt.Errorf("creating %s: %w", topic, err)
+	}
+	logger.Info("created topic", "topic", topic, "partitions", partitions, "replicas", replicas)
+
+	// The metadata of a new topic reaches every broker shortly after it is
+	// created
+	for range 10 {
+		if detail, err = describeTopic(ctx, adm, topic); err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return detail, err
+}
+
+func describeTopic(ctx context.Context, adm *kadm.Client, topic string) (kadm.TopicDetail, error) {
+	topics, err := adm.ListTopics(ctx, topic)
+	if err != nil {
+		return kadm.TopicDetail{}, fmt.Errorf("describing %s: %w", topic, err)
+	}
+	detail, ok := topics[topic]
+	switch {
+	case !ok:
+		return detail, fmt.Errorf("describing %s: %w", topic, kerr.UnknownTopicOrPartition)
+	case detail.Err != nil:
+		return detail, fmt.Errorf("describing %s: %w", topic, detail.Err)
+	}
+	return detail, nil
+}
@@ -2,55 +2,78 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/cloudproud/graceful"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("chaos-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
 	ctx := graceful.NewContext(context.Background())
-	fmt.Println("starting Resilient Consumer...")
-	fmt.Println("connected to: localhost:9092,localhost:9094,localhost:9095")
+	if err := app.Start(ctx, ":9312"); err != nil {
+		return err
+	}
+	cfg, err := kafkaclient.Load("localhost:9092", "localhost:9094", "localhost:9095")
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Info("starting resilient consumer", "brokers", cfg.String())
+
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics := app.Metrics
+	consumedTotal := metrics.Counter("messages_consumed_total", "Messages processed by the consumer")
+	errorsTotal := metrics.Counter("errors_total", "Poll and commit errors")
+	opts = append(opts, app.Opts()...)
+	opts = append(opts, metrics.GroupOpts()...)
 
 	// Configure resilient consumer
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092", "localhost:9094", "localhost:9095"),
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumeTopics("chaos-test"),
 		kgo.ConsumerGroup("chaos-test-group"),
 		kgo.SessionTimeout(30*time.Second),   // Longer session timeout
 		kgo.HeartbeatInterval(3*time.Second), // Regular heartbeats
 		kgo.RebalanceTimeout(60*time.Second), // Time for rebalance
 		kgo.DisableAutoCommit(),              // Manual commits for safety
-	)
+	)...)
 	if err != nil {
 		return err
 	}
 
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
 	consumed := 0
 	errors := 0
 	uptime := time.Now()
 
 	ctx.Closer(func() {
-		elapsed := time.Since(uptime)
-		fmt.Printf("messages consumed: %d\n", consumed)
-		fmt.Printf("errors: %d\n", errors)
-		fmt.Printf("duration: %v\n", elapsed.Round(time.Second))
+		logger.Info("consumer stopped", "consumed", consumed, "errors", errors, "duration", time.Since(uptime).Round(time.Second))
 	})
 
-	fmt.Println("consuming messages...")
-	fmt.Println("watch for pauses during broker failures!")
+	logger.Info("consuming messages, watch for pauses during broker failures")
 
 	go func() {
 	poll:
@@ -59,7 +82,8 @@ func run() error {
 			if errs := fetches.Errors(); len(errs) > 0 {
 				for _, err := range errs {
 					errors++
-					fmt.Printf("poll error: %v\n", err)
+					errorsTotal.Inc()
+					logger.Error("poll failed", "err", err)
 				}
 				time.Sleep(1 * time.Second)
 				continue
@@ -69,15 +93,17 @@ func run() error {
 			for !iter.Done() {
 				record := iter.Next()
 				consumed++
-				err = client.CommitRecords(ctx, record)
+				consumedTotal.Inc()
+				err = metrics.CommitRecords(ctx, client, record)
 				if err != nil {
 					errors++
-					fmt.Printf("commit error: %v\n", err)
+					errorsTotal.Inc()
+					kafkaobs.Record(logger, record).Error("commit failed", "err", err)
 					continue poll
 				}
 
 				if record.Offset%10 == 0 {
-					fmt.Printf("consumed message offset %d, partition %d\n", record.Offset, record.Partition)
+					kafkaobs.Record(logger, record).Info("consumed message")
 				}
 			}
 		}
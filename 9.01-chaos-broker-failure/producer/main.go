@@ -2,29 +2,54 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/cloudproud/graceful"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("producer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("chaos-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
 	ctx := graceful.NewContext(context.Background())
-	fmt.Println("starting Resilient Producer...")
-	fmt.Println("connected to: localhost:9092,localhost:9094,localhost:9095")
+	if err := app.Start(ctx, ":9311"); err != nil {
+		return err
+	}
+	logger := app.Logger
+	cfg, err := kafkaclient.Load("localhost:9092", "localhost:9094", "localhost:9095")
+	if err != nil {
+		return err
+	}
+
+	logger.Info("starting resilient producer", "brokers", cfg.String())
+
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	producedTotal := app.Metrics.Counter("messages_produced_total", "Messages handed to the client")
+	errorsTotal := app.Metrics.Counter("errors_total", "Messages that failed to be produced")
+	opts = append(opts, app.Opts()...)
 
 	// Configure resilient producer
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092", "localhost:9094", "localhost:9095"),
+	client, err := kgo.NewClient(append(opts,
 		kgo.DefaultProduceTopic("chaos-test"),
 		// Producer resilience settings
 		kgo.RequiredAcks(kgo.AllISRAcks()),         // Wait for all in-sync replicas
@@ -34,28 +59,25 @@ func run() error {
 			// Exponential backoff for retries
 			return time.Duration(tries) * 100 * time.Millisecond
 		}),
-	)
+	)...)
 	if err != nil {
 		return err
 	}
 
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
 
 	produced := 0
 	errors := 0
 	uptime := time.Now()
 
 	ctx.Closer(func() {
-		elapsed := time.Since(uptime)
-		fmt.Printf("messages produced: %d\n", produced)
-		fmt.Printf("errors: %d\n", errors)
 		successRate := float64(produced-errors) / float64(produced) * 100
-		fmt.Printf("success rate: %.2f%%\n", successRate)
-		fmt.Printf("duration: %v\n", elapsed.Round(time.Second))
+		logger.Info("producer stopped", "produced", produced, "errors", errors,
+			"success_rate", fmt.Sprintf("%.2f%%", successRate), "duration", time.Since(uptime).Round(time.Second))
 	})
 
-	fmt.Println("producing messages every 100ms...")
-	fmt.Println("watch for errors during broker failures!")
+	logger.Info("producing messages every 100ms, watch for errors during broker failures")
 
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
@@ -63,6 +85,7 @@ func run() error {
 	go func() {
 		for range ticker.C {
 			produced++
+			producedTotal.Inc()
 
 			msg := fmt.Sprintf("message #%d at %s", produced, time.Now().Format("15:04:05.000"))
 			key := fmt.Sprintf("key-%d", produced%10)
@@ -75,12 +98,13 @@ func run() error {
 			client.Produce(ctx, record, func(r *kgo.Record, err error) {
 				if err != nil {
 					errors++
-					fmt.Printf("produce error: %v\n", err)
+					errorsTotal.Inc()
+					logger.Error("produce failed", "topic", r.Topic, "key", string(r.Key), "err", err)
 					return
 				}
 
 				if r.Offset%10 == 0 {
-					fmt.Printf("produced message offset %d, partition %d\n", r.Offset, r.Partition)
+					kafkaobs.Record(logger, r).Info("produced message")
 				}
 			})
 		}
@@ -2,34 +2,58 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
+	"log/slog"
 	"os"
 	"sync/atomic"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/cloudproud/graceful"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("consumer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("split-brain-consumer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
 	ctx := graceful.NewContext(context.Background())
-	fmt.Println("Starting Split-Brain Test Consumer...")
-	fmt.Println("Connected to: localhost:9092,localhost:9094,localhost:9095")
-	fmt.Println()
-	fmt.Println("This consumer helps detect split-brain symptoms.")
-	fmt.Println("Watch for gaps in message sequences or partition changes!")
-	fmt.Println()
+	if err := app.Start(ctx, ":9314"); err != nil {
+		return err
+	}
+	cfg, err := kafkaclient.Load("localhost:9092", "localhost:9094", "localhost:9095")
+	if err != nil {
+		return err
+	}
+
+	// This consumer helps detect split-brain symptoms, watch for gaps in
+	// message sequences or partition changes
+	app.Logger.Info("starting split-brain test consumer", "brokers", cfg.String())
+
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics := app.Metrics
+	consumedTotal := metrics.Counter("messages_consumed_total", "Messages processed by the consumer")
+	errorsTotal := metrics.Counter("errors_total", "Poll and commit errors")
+	gapsTotal := metrics.Counter("offset_gaps_total", "Offset gaps, which may indicate lost messages")
+	opts = append(opts, app.Opts()...)
+	opts = append(opts, metrics.GroupOpts()...)
 
 	// Configure resilient consumer with settings for split-brain detection
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092", "localhost:9094", "localhost:9095"),
+	client, err := kgo.NewClient(append(opts,
 		kgo.ConsumeTopics("split-brain-test"),
 		kgo.ConsumerGroup("split-brain-test-group"),
 		// Longer timeouts to handle partition scenarios
@@ -43,12 +67,14 @@ func run() error {
 		kgo.FetchMaxWait(5*time.Second),
 		// Quick metadata refresh to detect changes
 		kgo.MetadataMinAge(1*time.Second),
-	)
+	)...)
 	if err != nil {
 		return err
 	}
 
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
+	logger := kafkaobs.Consumer(app.Logger, client)
 
 	var consumed int64
 	var errors int64
@@ -57,24 +83,15 @@ func run() error {
 	uptime := time.Now()
 
 	ctx.Closer(func() {
-		elapsed := time.Since(uptime)
-		fmt.Println()
-		fmt.Println("=== Consumer Statistics ===")
-		fmt.Printf("Messages consumed: %d\n", consumed)
-		fmt.Printf("Errors encountered: %d\n", errors)
-		fmt.Printf("Offset gaps detected: %d\n", gaps)
-		fmt.Printf("Duration: %v\n", elapsed.Round(time.Second))
+		logger.Info("consumer stopped", "consumed", consumed, "errors", errors, "gaps", gaps,
+			"duration", time.Since(uptime).Round(time.Second))
 
 		if gaps > 0 {
-			fmt.Println()
-			fmt.Println("WARNING: Offset gaps may indicate message loss!")
-			fmt.Println("This could be a symptom of split-brain with unclean leader election.")
+			logger.Warn("offset gaps may indicate message loss, a symptom of split-brain with unclean leader election")
 		}
 	})
 
-	fmt.Println("Consuming messages...")
-	fmt.Println("Legend: . = message, G = gap detected, R = rebalance, E = error")
-	fmt.Println()
+	logger.Info("consuming messages")
 
 	go func() {
 		for {
@@ -90,9 +107,8 @@ func run() error {
 			if errs := fetches.Errors(); len(errs) > 0 {
 				for _, err := range errs {
 					atomic.AddInt64(&errors, 1)
-					timestamp := time.Now().Format("15:04:05.000")
-					fmt.Printf("\nE [%s] Poll error: topic=%s partition=%d: %v\n",
-						timestamp, err.Topic, err.Partition, err.Err)
+					errorsTotal.Inc()
+					logger.Error("poll failed", "topic", err.Topic, "partition", err.Partition, "err", err.Err)
 				}
 				time.Sleep(1 * time.Second)
 				continue
@@ -102,31 +118,31 @@ func run() error {
 			for !iter.Done() {
 				record := iter.Next()
 				atomic.AddInt64(&consumed, 1)
-				timestamp := time.Now().Format("15:04:05.000")
+				consumedTotal.Inc()
+				recordLogger := kafkaobs.Record(logger, record)
 
 				// Check for offset gaps (potential split-brain symptom)
 				if lastOff, exists := lastOffset[record.Partition]; exists {
 					if record.Offset != lastOff+1 && record.Offset != 0 {
 						atomic.AddInt64(&gaps, 1)
-						fmt.Printf("\nG [%s] OFFSET GAP DETECTED on partition %d: expected %d, got %d (gap of %d messages)\n",
-							timestamp, record.Partition, lastOff+1, record.Offset, record.Offset-lastOff-1)
+						gapsTotal.Inc()
+						recordLogger.Warn("offset gap detected", "expected", lastOff+1, "gap", record.Offset-lastOff-1)
 					}
 				}
 				lastOffset[record.Partition] = record.Offset
 
 				// Commit each record
-				err := client.CommitRecords(ctx, record)
+				err := metrics.CommitRecords(ctx, client, record)
 				if err != nil {
 					atomic.AddInt64(&errors, 1)
-					fmt.Printf("\nE [%s] Commit error for partition %d offset %d: %v\n",
-						timestamp, record.Partition, record.Offset, err)
+					errorsTotal.Inc()
+					recordLogger.Error("commit failed", "err", err)
 					continue
 				}
 
-				// Print progress every 10 messages
+				// Log progress every 10 messages
 				if record.Offset%10 == 0 {
-					fmt.Printf(". [%s] partition %d, offset %d, key=%s\n",
-						timestamp, record.Partition, record.Offset, string(record.Key))
+					recordLogger.Info("consumed message", "key", string(record.Key))
 				}
 			}
 		}
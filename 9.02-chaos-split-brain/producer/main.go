@@ -2,34 +2,59 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"sync/atomic"
 	"time"
 
+	"kafkaclient"
+	"kafkaobs"
+
 	"github.com/cloudproud/graceful"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Println(err)
+		slog.Error("producer failed", "err", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	app := kafkaobs.New("split-brain-producer")
+	app.BindFlags(flag.CommandLine)
+	flag.Parse()
+
 	ctx := graceful.NewContext(context.Background())
-	fmt.Println("Starting Split-Brain Test Producer...")
-	fmt.Println("Connected to: localhost:9092,localhost:9094,localhost:9095")
-	fmt.Println()
-	fmt.Println("This producer helps demonstrate split-brain scenarios.")
-	fmt.Println("Watch for errors during network partitions!")
-	fmt.Println()
+	if err := app.Start(ctx, ":9313"); err != nil {
+		return err
+	}
+	logger := app.Logger
+	cfg, err := kafkaclient.Load("localhost:9092", "localhost:9094", "localhost:9095")
+	if err != nil {
+		return err
+	}
+
+	// This producer helps demonstrate split-brain scenarios, watch for
+	// errors during network partitions
+	logger.Info("starting split-brain test producer", "brokers", cfg.String())
+
+	opts, err := cfg.Opts(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics := app.Metrics
+	succeededTotal := metrics.Counter("messages_succeeded_total", "Messages acknowledged by the brokers")
+	failedTotal := metrics.Counter("messages_failed_total", "Messages that failed to be produced")
+	partitionChanges := metrics.Counter("partition_changes_total", "Consecutive messages that landed on different partitions")
+	opts = append(opts, app.Opts()...)
 
 	// Configure resilient producer with settings that help detect split-brain
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers("localhost:9092", "localhost:9094", "localhost:9095"),
+	client, err := kgo.NewClient(append(opts,
 		kgo.DefaultProduceTopic("split-brain-test"),
 		// CRITICAL: Wait for all in-sync replicas to prevent data loss
 		kgo.RequiredAcks(kgo.AllISRAcks()),
@@ -49,12 +74,13 @@ func run() error {
 		}),
 		// Metadata refresh to detect partition changes quickly
 		kgo.MetadataMinAge(1*time.Second),
-	)
+	)...)
 	if err != nil {
 		return err
 	}
 
 	defer client.Close()
+	app.AddCheck("kafka", kafkaobs.Ping(client))
 
 	var produced int64
 	var succeeded int64
@@ -63,22 +89,16 @@ func run() error {
 	uptime := time.Now()
 
 	ctx.Closer(func() {
-		elapsed := time.Since(uptime)
-		fmt.Println()
-		fmt.Println("=== Producer Statistics ===")
-		fmt.Printf("Messages attempted: %d\n", produced)
-		fmt.Printf("Messages succeeded: %d\n", succeeded)
-		fmt.Printf("Messages failed: %d\n", failed)
+		stats := []any{"attempted", produced, "succeeded", succeeded, "failed", failed}
 		if succeeded > 0 {
 			successRate := float64(succeeded) / float64(produced) * 100
-			fmt.Printf("Success rate: %.2f%%\n", successRate)
+			stats = append(stats, "success_rate", fmt.Sprintf("%.2f%%", successRate))
 		}
-		fmt.Printf("Duration: %v\n", elapsed.Round(time.Second))
+		stats = append(stats, "duration", time.Since(uptime).Round(time.Second))
+		logger.Info("producer stopped", stats...)
 	})
 
-	fmt.Println("Producing messages every 200ms...")
-	fmt.Println("Legend: + = success, X = failure, P = partition change")
-	fmt.Println()
+	logger.Info("producing messages every 200ms")
 
 	ticker := time.NewTicker(200 * time.Millisecond)
 	defer ticker.Stop()
@@ -99,23 +119,25 @@ func run() error {
 			client.Produce(ctx, record, func(r *kgo.Record, err error) {
 				if err != nil {
 					atomic.AddInt64(&failed, 1)
-					fmt.Printf("\nX [%s] FAILED msg #%d: %v\n", timestamp, msgNum, err)
+					failedTotal.Inc()
+					logger.Error("produce failed", "topic", r.Topic, "number", msgNum, "err", err)
 					return
 				}
 
 				atomic.AddInt64(&succeeded, 1)
+				succeededTotal.Inc()
 
 				// Detect partition changes (may indicate leader election)
 				if lastPartition != -1 && lastPartition != r.Partition {
-					fmt.Printf("\nP [%s] Partition change detected: %d -> %d (possible leader election)\n",
-						timestamp, lastPartition, r.Partition)
+					partitionChanges.Inc()
+					kafkaobs.Record(logger, r).Warn("partition change detected, possible leader election",
+						"previous_partition", lastPartition)
 				}
 				lastPartition = r.Partition
 
-				// Print progress every 10 messages
+				// Log progress every 10 messages
 				if r.Offset%10 == 0 {
-					fmt.Printf("+ [%s] msg #%d -> partition %d, offset %d\n",
-						timestamp, msgNum, r.Partition, r.Offset)
+					kafkaobs.Record(logger, r).Info("produced message", "number", msgNum)
 				}
 			})
 		}
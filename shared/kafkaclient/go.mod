@@ -0,0 +1,20 @@
+module kafkaclient
+
+go 1.24.0
+
+require (
+	github.com/twmb/franz-go v1.20.5
+	tlsconfig v0.0.0
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/klauspost/compress v1.18.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.22 // indirect
+	github.com/twmb/franz-go/pkg/kmsg v1.12.0 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.45.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
+
+replace tlsconfig => ../tlsconfig
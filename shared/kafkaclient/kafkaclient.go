@@ -0,0 +1,166 @@
+// Package kafkaclient builds the connection options of the example clients
+// from the environment or a client properties file, so the same program runs
+// against a plaintext development broker and a cluster secured with SASL
+// and/or TLS.
+package kafkaclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"tlsconfig"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Security protocols, named like the Kafka client setting security.protocol
+const (
+	Plaintext     = "PLAINTEXT"
+	SSL           = "SSL"
+	SASLPlaintext = "SASL_PLAINTEXT"
+	SASLSSL       = "SASL_SSL"
+)
+
+// Config is how a client connects and authenticates
+type Config struct {
+	Brokers []string
+	// SecurityProtocol is PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL. When
+	// empty it follows from whether SASL and TLS are configured.
+	SecurityProtocol string
+	SASL             SASLConfig
+	TLS              tlsconfig.Config
+}
+
+// Load reads the configuration: defaultBrokers, overridden by the client
+// properties file named in KAFKA_CLIENT_CONFIG, overridden by KAFKA_*
+// environment variables
+func Load(defaultBrokers ...string) (Config, error) {
+	return LoadDefaults(Config{Brokers: defaultBrokers})
+}
+
+// LoadDefaults is Load for programs with more defaults than the brokers, such
+// as the CA of a broker that only listens for TLS
+func LoadDefaults(defaults Config) (Config, error) {
+	c := defaults
+
+	if path := os.Getenv("KAFKA_CLIENT_CONFIG"); path != "" {
+		props, err := readProperties(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading client config: %w", err)
+		}
+		if err := c.applyProperties(props); err != nil {
+			return Config{}, fmt.Errorf("client config %s: %w", path, err)
+		}
+	}
+
+	if v := os.Getenv("KAFKA_BROKERS"); v != "" {
+		c.Brokers = splitList(v)
+	}
+	if v := os.Getenv("KAFKA_SECURITY_PROTOCOL"); v != "" {
+		c.SecurityProtocol = v
+	}
+	c.SASL = c.SASL.fromEnv()
+	c.TLS = tlsconfig.FromEnv(c.TLS)
+
+	c.SecurityProtocol = strings.ToUpper(c.SecurityProtocol)
+	if c.SecurityProtocol == "" {
+		c.SecurityProtocol = c.defaultProtocol()
+	}
+	return c, c.validate()
+}
+
+// Options loads the configuration and returns the client options for it
+func Options(ctx context.Context, defaultBrokers ...string) ([]kgo.Opt, error) {
+	c, err := Load(defaultBrokers...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Opts(ctx)
+}
+
+// Opts returns the seed brokers, TLS and SASL options. Client certificates
+// are reloaded when their files change until ctx is done.
+func (c Config) Opts(ctx context.Context) ([]kgo.Opt, error) {
+	opts := []kgo.Opt{kgo.SeedBrokers(c.Brokers...)}
+
+	if c.usesTLS() {
+		tlsConfig, err := c.TLS.Watch(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("configuring TLS: %w", err)
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	if c.usesSASL() {
+		mechanism, err := c.SASL.Authenticator()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	return opts, nil
+}
+
+// String describes the connection without secrets, for startup logs
+func (c Config) String() string {
+	s := fmt.Sprintf("%s via %s", strings.Join(c.Brokers, ","), c.SecurityProtocol)
+	if c.usesSASL() {
+		s += " as " + c.SASL.Principal()
+	}
+	return s
+}
+
+func (c Config) usesTLS() bool {
+	return c.SecurityProtocol == SSL || c.SecurityProtocol == SASLSSL
+}
+
+func (c Config) usesSASL() bool {
+	return c.SecurityProtocol == SASLPlaintext || c.SecurityProtocol == SASLSSL
+}
+
+// defaultProtocol derives the protocol when only credentials are configured
+func (c Config) defaultProtocol() string {
+	tls := c.TLS.CAFile != "" || c.TLS.MutualTLS()
+	switch {
+	case c.SASL.Mechanism != "" && tls:
+		return SASLSSL
+	case c.SASL.Mechanism != "":
+		return SASLPlaintext
+	case tls:
+		return SSL
+	default:
+		return Plaintext
+	}
+}
+
+func (c Config) validate() error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("no brokers configured, set KAFKA_BROKERS")
+	}
+	switch c.SecurityProtocol {
+	case Plaintext, SSL:
+		if c.SASL.Mechanism != "" {
+			return fmt.Errorf("SASL mechanism %s is configured, but security protocol %s does not use SASL", c.SASL.Mechanism, c.SecurityProtocol)
+		}
+	case SASLPlaintext, SASLSSL:
+		if c.SASL.Mechanism == "" {
+			return fmt.Errorf("security protocol %s needs a SASL mechanism, set KAFKA_SASL_MECHANISM", c.SecurityProtocol)
+		}
+	default:
+		return fmt.Errorf("unknown security protocol %q, expected PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL", c.SecurityProtocol)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,113 @@
+package kafkaclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshAfter is the share of a token's lifetime after which a new token is
+// requested, leaving time to retry before the old one expires
+const refreshAfter = 0.8
+
+// tokenSource fetches OAUTHBEARER tokens with the client credentials grant
+// and caches them. Brokers with connections.max.reauth.ms set make the
+// client authenticate again before the session expires, which asks for a
+// token and so refreshes it when needed.
+type tokenSource struct {
+	url          string
+	clientID     string
+	clientSecret string
+	scope        string
+	http         *http.Client
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+func newTokenSource(tokenURL, clientID, clientSecret, scope string) *tokenSource {
+	return &tokenSource{
+		url:          tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		http:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Token returns the cached token, or a new one once the cached one is due
+// for a refresh. While the identity provider is unavailable the cached
+// token is used until it expires.
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.token != "" && now.Before(t.refreshAt) {
+		return t.token, nil
+	}
+
+	token, lifetime, err := t.fetch(ctx)
+	if err != nil {
+		if t.token != "" && now.Before(t.expiresAt) {
+			slog.Warn("refreshing OAUTHBEARER token failed, using the current one",
+				"component", "oauth", "expires_at", t.expiresAt.Format(time.RFC3339), "err", err)
+			return t.token, nil
+		}
+		return "", err
+	}
+
+	t.token = token
+	t.expiresAt = now.Add(lifetime)
+	t.refreshAt = now.Add(time.Duration(float64(lifetime) * refreshAfter))
+	return token, nil
+}
+
+// fetch requests a token, the lifetime is zero if the response has none
+func (t *tokenSource) fetch(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if t.scope != "" {
+		form.Set("scope", t.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(t.clientID), url.QueryEscape(t.clientSecret))
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("requesting OAUTHBEARER token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("reading OAUTHBEARER token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("requesting OAUTHBEARER token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("decoding OAUTHBEARER token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response contains no access_token")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,94 @@
+package kafkaclient
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// jaasOption matches key="value" pairs of sasl.jaas.config
+var jaasOption = regexp.MustCompile(`(\w+)\s*=\s*"((?:[^"\\]|\\.)*)"`)
+
+// readProperties parses a Java properties file, the format of the
+// client-*.properties files passed to the Kafka command line tools
+func readProperties(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	props := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if line == "" && (text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "!")) {
+			continue
+		}
+		// A trailing backslash continues the value on the next line
+		if cut, ok := strings.CutSuffix(text, `\`); ok {
+			line += cut
+			continue
+		}
+		line += text
+
+		// The key ends at the first = or :
+		if i := strings.IndexAny(line, "=:"); i >= 0 {
+			props[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+		line = ""
+	}
+	return props, scanner.Err()
+}
+
+// applyProperties maps the Java client and librdkafka settings that have an
+// equivalent here. JKS stores cannot be read, PEM files are needed instead.
+func (c *Config) applyProperties(props map[string]string) error {
+	for key, value := range props {
+		switch key {
+		case "bootstrap.servers":
+			c.Brokers = splitList(value)
+		case "security.protocol":
+			c.SecurityProtocol = value
+		case "sasl.mechanism", "sasl.mechanisms":
+			c.SASL.Mechanism = value
+		case "sasl.username":
+			c.SASL.Username = value
+		case "sasl.password":
+			c.SASL.Password = value
+		case "sasl.jaas.config":
+			for _, m := range jaasOption.FindAllStringSubmatch(value, -1) {
+				v := strings.ReplaceAll(m[2], `\"`, `"`)
+				switch m[1] {
+				case "username":
+					c.SASL.Username = v
+				case "password":
+					c.SASL.Password = v
+				case "clientId":
+					c.SASL.ClientID = v
+				case "clientSecret":
+					c.SASL.ClientSecret = v
+				case "scope":
+					c.SASL.Scope = v
+				}
+			}
+		case "sasl.oauthbearer.token.endpoint.url":
+			c.SASL.TokenURL = value
+		case "ssl.ca.location":
+			c.TLS.CAFile = value
+		case "ssl.certificate.location":
+			c.TLS.CertFile = value
+		case "ssl.key.location":
+			c.TLS.KeyFile = value
+		case "ssl.key.password":
+			c.TLS.KeyPassword = value
+		case "ssl.truststore.location", "ssl.keystore.location":
+			// certgen writes the PEM files next to the PKCS#12 stores
+			return fmt.Errorf("%s points to a PKCS#12 or JKS store, use ssl.ca.location, ssl.certificate.location and ssl.key.location with the PEM files (<name>-cert.pem, <name>-key.pem) instead", key)
+		}
+	}
+	return nil
+}
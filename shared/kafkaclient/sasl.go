@@ -0,0 +1,154 @@
+package kafkaclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// SASL mechanisms, named like the Kafka client setting sasl.mechanism
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismScramSHA256 = "SCRAM-SHA-256"
+	MechanismScramSHA512 = "SCRAM-SHA-512"
+	MechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// SASLConfig holds the credentials of one mechanism. Files are read on every
+// authentication, so rotated passwords and tokens are picked up by new
+// connections without a restart.
+type SASLConfig struct {
+	Mechanism string
+
+	// PLAIN and SCRAM, the password is read from PasswordFile when it is set
+	Username     string
+	Password     string
+	PasswordFile string
+
+	// OAUTHBEARER, either a token file kept fresh by someone else, or the
+	// client credentials grant against TokenURL
+	TokenFile    string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+// fromEnv overrides the fields that are set in the environment
+func (s SASLConfig) fromEnv() SASLConfig {
+	set := func(field *string, key string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = v
+		}
+	}
+	set(&s.Mechanism, "KAFKA_SASL_MECHANISM")
+	set(&s.Username, "KAFKA_SASL_USERNAME")
+	set(&s.Password, "KAFKA_SASL_PASSWORD")
+	set(&s.PasswordFile, "KAFKA_SASL_PASSWORD_FILE")
+	set(&s.TokenFile, "KAFKA_SASL_OAUTH_TOKEN_FILE")
+	set(&s.TokenURL, "KAFKA_SASL_OAUTH_TOKEN_URL")
+	set(&s.ClientID, "KAFKA_SASL_OAUTH_CLIENT_ID")
+	set(&s.ClientSecret, "KAFKA_SASL_OAUTH_CLIENT_SECRET")
+	set(&s.Scope, "KAFKA_SASL_OAUTH_SCOPE")
+	s.Mechanism = strings.ToUpper(s.Mechanism)
+	return s
+}
+
+// Principal is who the client authenticates as
+func (s SASLConfig) Principal() string {
+	if s.Mechanism == MechanismOAuthBearer {
+		if s.ClientID != "" {
+			return s.ClientID + " (" + s.Mechanism + ")"
+		}
+		return "token from " + s.TokenFile + " (" + s.Mechanism + ")"
+	}
+	return s.Username + " (" + s.Mechanism + ")"
+}
+
+// Authenticator returns the franz-go mechanism for the configured credentials
+func (s SASLConfig) Authenticator() (sasl.Mechanism, error) {
+	switch s.Mechanism {
+	case MechanismPlain:
+		if err := s.requireUser(); err != nil {
+			return nil, err
+		}
+		return plain.Plain(func(context.Context) (plain.Auth, error) {
+			password, err := s.password()
+			return plain.Auth{User: s.Username, Pass: password}, err
+		}), nil
+
+	case MechanismScramSHA256, MechanismScramSHA512:
+		if err := s.requireUser(); err != nil {
+			return nil, err
+		}
+		auth := func(context.Context) (scram.Auth, error) {
+			password, err := s.password()
+			return scram.Auth{User: s.Username, Pass: password}, err
+		}
+		if s.Mechanism == MechanismScramSHA256 {
+			return scram.Sha256(auth), nil
+		}
+		return scram.Sha512(auth), nil
+
+	case MechanismOAuthBearer:
+		token, err := s.tokenFunc()
+		if err != nil {
+			return nil, err
+		}
+		return oauth.Oauth(func(ctx context.Context) (oauth.Auth, error) {
+			t, err := token(ctx)
+			return oauth.Auth{Token: t}, err
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q, expected PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or OAUTHBEARER", s.Mechanism)
+	}
+}
+
+func (s SASLConfig) requireUser() error {
+	if s.Username == "" {
+		return fmt.Errorf("SASL mechanism %s needs a username, set KAFKA_SASL_USERNAME", s.Mechanism)
+	}
+	if s.Password == "" && s.PasswordFile == "" {
+		return fmt.Errorf("SASL mechanism %s needs a password, set KAFKA_SASL_PASSWORD or KAFKA_SASL_PASSWORD_FILE", s.Mechanism)
+	}
+	return nil
+}
+
+func (s SASLConfig) password() (string, error) {
+	if s.PasswordFile == "" {
+		return s.Password, nil
+	}
+	data, err := os.ReadFile(s.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("reading SASL password: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// tokenFunc returns where OAUTHBEARER tokens come from
+func (s SASLConfig) tokenFunc() (func(context.Context) (string, error), error) {
+	switch {
+	case s.TokenFile != "":
+		return func(context.Context) (string, error) {
+			data, err := os.ReadFile(s.TokenFile)
+			if err != nil {
+				return "", fmt.Errorf("reading OAUTHBEARER token: %w", err)
+			}
+			return strings.TrimSpace(string(data)), nil
+		}, nil
+	case s.TokenURL != "":
+		if s.ClientID == "" || s.ClientSecret == "" {
+			return nil, fmt.Errorf("OAUTHBEARER with a token URL needs KAFKA_SASL_OAUTH_CLIENT_ID and KAFKA_SASL_OAUTH_CLIENT_SECRET")
+		}
+		return newTokenSource(s.TokenURL, s.ClientID, s.ClientSecret, s.Scope).Token, nil
+	default:
+		return nil, fmt.Errorf("OAUTHBEARER needs KAFKA_SASL_OAUTH_TOKEN_FILE or KAFKA_SASL_OAUTH_TOKEN_URL")
+	}
+}
@@ -0,0 +1,134 @@
+package kafkametrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Rebalance events of the rebalances_total metric
+const (
+	EventAssigned = "assigned"
+	EventRevoked  = "revoked"
+	EventLost     = "lost"
+)
+
+// PartitionsFunc is the signature of the kgo.OnPartitions callbacks
+type PartitionsFunc = func(context.Context, *kgo.Client, map[string][]int32)
+
+// Assigned counts the assignment and calls fn, which may be nil
+func (m *Metrics) Assigned(fn PartitionsFunc) PartitionsFunc {
+	return func(ctx context.Context, cl *kgo.Client, assigned map[string][]int32) {
+		m.rebalance(EventAssigned, assigned)
+		if fn != nil {
+			fn(ctx, cl, assigned)
+		}
+	}
+}
+
+// Revoked counts the revocation and calls fn. When fn is nil it commits the
+// consumed offsets if autocommitting is enabled, like the client does
+// without a callback.
+func (m *Metrics) Revoked(fn PartitionsFunc) PartitionsFunc {
+	return func(ctx context.Context, cl *kgo.Client, revoked map[string][]int32) {
+		m.rebalance(EventRevoked, revoked)
+		switch {
+		case fn != nil:
+			fn(ctx, cl, revoked)
+		case !autocommitDisabled(cl):
+			cl.CommitOffsetsSync(ctx, cl.UncommittedOffsets(), m.Committed)
+		}
+	}
+}
+
+// Lost counts the partitions lost to a session timeout or a fatal group
+// error and calls fn, which may be nil
+func (m *Metrics) Lost(fn PartitionsFunc) PartitionsFunc {
+	return func(ctx context.Context, cl *kgo.Client, lost map[string][]int32) {
+		m.rebalance(EventLost, lost)
+		if fn != nil {
+			fn(ctx, cl, lost)
+		}
+	}
+}
+
+// Committed counts the result of every partition of an offset commit, it
+// can be passed to kgo.AutoCommitCallback and kgo.Client.CommitOffsetsSync
+func (m *Metrics) Committed(_ *kgo.Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+	if err != nil {
+		for _, t := range req.Topics {
+			for _, p := range t.Partitions {
+				m.commits.WithLabelValues(t.Topic, strconv.Itoa(int(p.Partition)), "request_failed").Inc()
+			}
+		}
+		return
+	}
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			result := "ok"
+			var kerrErr *kerr.Error
+			if errors.As(kerr.ErrorForCode(p.ErrorCode), &kerrErr) {
+				result = kerrErr.Message
+			}
+			m.commits.WithLabelValues(t.Topic, strconv.Itoa(int(p.Partition)), result).Inc()
+		}
+	}
+}
+
+// CommitRecords commits the offsets after the records and counts the
+// results, like kgo.Client.CommitRecords it returns the first error
+func (m *Metrics) CommitRecords(ctx context.Context, cl *kgo.Client, rs ...*kgo.Record) error {
+	offsets := make(map[string]map[int32]kgo.EpochOffset)
+	for _, r := range rs {
+		if offsets[r.Topic] == nil {
+			offsets[r.Topic] = make(map[int32]kgo.EpochOffset)
+		}
+		at, exists := offsets[r.Topic][r.Partition]
+		if exists && (at.Epoch > r.LeaderEpoch || at.Epoch == r.LeaderEpoch && at.Offset > r.Offset) {
+			continue
+		}
+		offsets[r.Topic][r.Partition] = kgo.EpochOffset{Epoch: r.LeaderEpoch, Offset: r.Offset + 1}
+	}
+
+	var commitErr error
+	cl.CommitOffsetsSync(ctx, offsets, func(cl *kgo.Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		m.Committed(cl, req, resp, err)
+		if err != nil {
+			commitErr = err
+			return
+		}
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil && commitErr == nil {
+					commitErr = err
+				}
+			}
+		}
+	})
+	return commitErr
+}
+
+func (m *Metrics) rebalance(event string, partitions map[string][]int32) {
+	n := 0
+	for _, ps := range partitions {
+		n += len(ps)
+	}
+	if n == 0 {
+		return
+	}
+	m.rebalances.WithLabelValues(event).Inc()
+	if event == EventAssigned {
+		m.assigned.Add(float64(n))
+	} else {
+		m.assigned.Sub(float64(n))
+	}
+}
+
+func autocommitDisabled(cl *kgo.Client) bool {
+	disabled, _ := cl.OptValue(kgo.DisableAutoCommit).(bool)
+	return disabled
+}
@@ -0,0 +1,226 @@
+// Package kafkametrics exposes the metrics of the example clients on a
+// Prometheus /metrics endpoint: produce and fetch rates per topic and
+// partition, request latencies, buffered records, commit results,
+// rebalances and counters of the application.
+//
+// Most metrics are collected by client hooks, so adding Opts to a client is
+// enough. Kafka has no hook for commits and rebalances: consumers commit
+// with CommitRecords and add GroupOpts, or wrap their own callbacks with
+// Assigned, Revoked and Lost.
+package kafkametrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Namespace prefixes the metrics of the Kafka clients, counters of the
+// application are prefixed with app
+const Namespace = "kafka_client"
+
+// Metrics collects the metrics of the clients it is added to. Every metric
+// has a client label with the name passed to New.
+type Metrics struct {
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+	mux        *http.ServeMux
+
+	producedRecords *prometheus.CounterVec
+	producedBytes   *prometheus.CounterVec
+	produceErrors   *prometheus.CounterVec
+	fetchedRecords  *prometheus.CounterVec
+	fetchedBytes    *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	throttle        *prometheus.HistogramVec
+	commits         *prometheus.CounterVec
+	rebalances      *prometheus.CounterVec
+	assigned        prometheus.Gauge
+	groupErrors     prometheus.Counter
+
+	mu      sync.Mutex
+	clients map[*kgo.Client]struct{}
+}
+
+var (
+	_ kgo.HookNewClient               = (*Metrics)(nil)
+	_ kgo.HookClientClosed            = (*Metrics)(nil)
+	_ kgo.HookBrokerE2E               = (*Metrics)(nil)
+	_ kgo.HookBrokerThrottle          = (*Metrics)(nil)
+	_ kgo.HookProduceBatchWritten     = (*Metrics)(nil)
+	_ kgo.HookProduceRecordUnbuffered = (*Metrics)(nil)
+	_ kgo.HookFetchBatchRead          = (*Metrics)(nil)
+	_ kgo.HookGroupManageError        = (*Metrics)(nil)
+)
+
+// New returns the metrics of the program called name, together with the Go
+// runtime and process metrics
+func New(name string) *Metrics {
+	registry := prometheus.NewRegistry()
+	m := &Metrics{
+		registry:   registry,
+		registerer: prometheus.WrapRegistererWith(prometheus.Labels{"client": name}, registry),
+		mux:        http.NewServeMux(),
+		clients:    map[*kgo.Client]struct{}{},
+	}
+	m.mux.Handle("GET /metrics", m.Handler())
+
+	partition := []string{"topic", "partition"}
+	m.producedRecords = m.counterVec("produced_records_total", "Records written to the brokers", partition...)
+	m.producedBytes = m.counterVec("produced_bytes_total", "Uncompressed bytes of the records written to the brokers", partition...)
+	m.produceErrors = m.counterVec("produce_errors_total", "Records that failed to be produced", "topic")
+	m.fetchedRecords = m.counterVec("fetched_records_total", "Records fetched from the brokers", partition...)
+	m.fetchedBytes = m.counterVec("fetched_bytes_total", "Uncompressed bytes of the records fetched from the brokers", partition...)
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time from writing a request to a broker until its response is read",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"request"})
+	m.requestErrors = m.counterVec("request_errors_total", "Requests that failed to be written or read", "request")
+	m.throttle = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "throttle_seconds",
+		Help:      "Time the brokers throttled the client because of quotas",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"broker"})
+	m.commits = m.counterVec("commits_total", "Offset commits per partition by result, ok or the error", append(partition, "result")...)
+	m.rebalances = m.counterVec("rebalances_total", "Partitions assigned, revoked or lost in group rebalances by event", "event")
+	m.assigned = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "assigned_partitions",
+		Help:      "Partitions currently assigned to the group member",
+	})
+	m.groupErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "group_errors_total",
+		Help:      "Errors while joining or heartbeating the consumer group",
+	})
+	m.registerer.MustRegister(m.requestDuration, m.throttle, m.assigned, m.groupErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "buffered_produce_records",
+			Help:      "Records waiting to be produced",
+		}, m.buffered((*kgo.Client).BufferedProduceRecords)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "buffered_fetch_records",
+			Help:      "Fetched records waiting to be polled",
+		}, m.buffered((*kgo.Client).BufferedFetchRecords)),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Opts adds the hooks to a client. The same metrics can be added to several
+// clients of a program, their numbers are summed.
+func (m *Metrics) Opts() []kgo.Opt {
+	return []kgo.Opt{kgo.WithHooks(m)}
+}
+
+// GroupOpts counts the rebalances and the results of autocommits of a
+// group consumer that does not set partition callbacks itself
+func (m *Metrics) GroupOpts() []kgo.Opt {
+	return []kgo.Opt{
+		kgo.OnPartitionsAssigned(m.Assigned(nil)),
+		kgo.OnPartitionsRevoked(m.Revoked(nil)),
+		kgo.OnPartitionsLost(m.Lost(nil)),
+		kgo.AutoCommitCallback(m.Committed),
+	}
+}
+
+// Counter registers a counter of the application, its name is prefixed
+// with app_
+func (m *Metrics) Counter(name, help string) prometheus.Counter {
+	c := prometheus.NewCounter(prometheus.CounterOpts{Namespace: "app", Name: name, Help: help})
+	m.registerer.MustRegister(c)
+	return c
+}
+
+// MustRegister adds collectors of the program to the endpoint without the
+// client label, for metrics that describe the cluster rather than the client
+func (m *Metrics) MustRegister(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// OnNewClient implements kgo.HookNewClient
+func (m *Metrics) OnNewClient(cl *kgo.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[cl] = struct{}{}
+}
+
+// OnClientClosed implements kgo.HookClientClosed
+func (m *Metrics) OnClientClosed(cl *kgo.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clients, cl)
+}
+
+// OnBrokerE2E implements kgo.HookBrokerE2E
+func (m *Metrics) OnBrokerE2E(_ kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	request := kmsg.NameForKey(key)
+	if e2e.Err() != nil {
+		m.requestErrors.WithLabelValues(request).Inc()
+		return
+	}
+	m.requestDuration.WithLabelValues(request).Observe(e2e.DurationE2E().Seconds())
+}
+
+// OnBrokerThrottle implements kgo.HookBrokerThrottle
+func (m *Metrics) OnBrokerThrottle(meta kgo.BrokerMetadata, interval time.Duration, _ bool) {
+	m.throttle.WithLabelValues(strconv.Itoa(int(meta.NodeID))).Observe(interval.Seconds())
+}
+
+// OnProduceBatchWritten implements kgo.HookProduceBatchWritten
+func (m *Metrics) OnProduceBatchWritten(_ kgo.BrokerMetadata, topic string, partition int32, batch kgo.ProduceBatchMetrics) {
+	p := strconv.Itoa(int(partition))
+	m.producedRecords.WithLabelValues(topic, p).Add(float64(batch.NumRecords))
+	m.producedBytes.WithLabelValues(topic, p).Add(float64(batch.UncompressedBytes))
+}
+
+// OnProduceRecordUnbuffered implements kgo.HookProduceRecordUnbuffered
+func (m *Metrics) OnProduceRecordUnbuffered(r *kgo.Record, err error) {
+	if err != nil {
+		m.produceErrors.WithLabelValues(r.Topic).Inc()
+	}
+}
+
+// OnFetchBatchRead implements kgo.HookFetchBatchRead
+func (m *Metrics) OnFetchBatchRead(_ kgo.BrokerMetadata, topic string, partition int32, batch kgo.FetchBatchMetrics) {
+	p := strconv.Itoa(int(partition))
+	m.fetchedRecords.WithLabelValues(topic, p).Add(float64(batch.NumRecords))
+	m.fetchedBytes.WithLabelValues(topic, p).Add(float64(batch.UncompressedBytes))
+}
+
+// OnGroupManageError implements kgo.HookGroupManageError
+func (m *Metrics) OnGroupManageError(error) {
+	m.groupErrors.Inc()
+}
+
+// buffered sums a buffer size over the clients
+func (m *Metrics) buffered(size func(*kgo.Client) int64) func() float64 {
+	return func() float64 {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		var n int64
+		for cl := range m.clients {
+			n += size(cl)
+		}
+		return float64(n)
+	}
+}
+
+func (m *Metrics) counterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: Namespace, Name: name, Help: help}, labels)
+	m.registerer.MustRegister(c)
+	return c
+}
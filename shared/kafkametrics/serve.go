@@ -0,0 +1,66 @@
+package kafkametrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler serves the metrics in the Prometheus text format, for programs
+// that already run an HTTP server
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registerer})
+}
+
+// Handle adds a route to the endpoint started by Serve, next to /metrics,
+// e.g. the health checks of the program. Routes are added before Serve.
+func (m *Metrics) Handle(pattern string, handler http.Handler) {
+	m.mux.Handle(pattern, handler)
+}
+
+// Serve exposes /metrics until ctx is done and returns the address it
+// listens on. The address is KAFKA_METRICS_ADDR, or defaultAddr when the
+// variable is not set; KAFKA_METRICS_ADDR=off disables the endpoint and
+// returns an empty address. When defaultAddr is taken, for example by a
+// second instance of the same program, a free port is used instead.
+// Addresses without a host are returned as localhost, for the startup log.
+func (m *Metrics) Serve(ctx context.Context, defaultAddr string) (string, error) {
+	addr := os.Getenv("KAFKA_METRICS_ADDR")
+	if addr == "off" {
+		return "", nil
+	}
+	set := addr != ""
+	if !set {
+		addr = defaultAddr
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil && !set {
+		ln, err = net.Listen("tcp", ":0")
+	}
+	if err != nil {
+		return "", fmt.Errorf("serving metrics: %w", err)
+	}
+
+	srv := &http.Server{Handler: m.mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "metrics endpoint stopped: %v\n", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
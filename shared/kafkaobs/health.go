@@ -0,0 +1,78 @@
+package kafkaobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// checkTimeout bounds every readiness check, a broker that does not answer
+// within it is not ready
+const checkTimeout = 3 * time.Second
+
+// Check reports whether a dependency of the program is ready
+type Check func(context.Context) error
+
+type check struct {
+	name string
+	fn   Check
+}
+
+// AddCheck adds a readiness check, /readyz fails while any check fails
+func (a *App) AddCheck(name string, fn Check) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.checks = append(a.checks, check{name: name, fn: fn})
+}
+
+// Ping checks that cl reaches a broker of the cluster
+func Ping(cl *kgo.Client) Check {
+	return cl.Ping
+}
+
+// healthStatus is the body of /healthz and /readyz, Checks has the error of
+// every failed check and ok for the others
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// healthHandler serves /healthz, the program is alive while it answers
+func healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeStatus(w, http.StatusOK, healthStatus{Status: "ok"})
+	})
+}
+
+// readyHandler serves /readyz, running the checks in turn
+func (a *App) readyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		checks := a.checks
+		a.mu.Unlock()
+
+		status, body := http.StatusOK, healthStatus{Status: "ok", Checks: map[string]string{}}
+		for _, c := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			err := c.fn(ctx)
+			cancel()
+			if err != nil {
+				status, body.Status = http.StatusServiceUnavailable, "unavailable"
+				body.Checks[c.name] = err.Error()
+				a.Logger.Warn("readiness check failed", "check", c.name, "err", err)
+				continue
+			}
+			body.Checks[c.name] = "ok"
+		}
+		writeStatus(w, status, body)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, status int, body healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,127 @@
+// Package kafkaobs bootstraps the logging, metrics and health checks of the
+// example programs, so their output can be parsed by a log pipeline:
+//
+//	app := kafkaobs.New("my-consumer")
+//	app.BindFlags(flag.CommandLine)
+//	flag.Parse()
+//	if err := app.Start(ctx, ":9300"); err != nil {
+//		return err
+//	}
+//
+// Start installs a log/slog logger, text or JSON, as the default logger and
+// serves /metrics, /healthz and /readyz. Opts routes the logs of the Kafka
+// client into the same logger, and Record adds the position of a record to
+// the logs about it.
+package kafkaobs
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"kafkametrics"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// App holds the logger, metrics and health checks of a program
+type App struct {
+	name   string
+	format string
+	level  slog.Level
+	envErr error
+
+	// Logger is the logger of the program, slog.Default until Start
+	Logger  *slog.Logger
+	Metrics *kafkametrics.Metrics
+
+	mu     sync.Mutex
+	checks []check
+}
+
+// New returns the bootstrap of the program called name, the client label
+// of its metrics and the program field of its logs. The log format and
+// level default to KAFKA_LOG_FORMAT and KAFKA_LOG_LEVEL.
+func New(name string) *App {
+	a := &App{
+		name:    name,
+		format:  FormatText,
+		Logger:  slog.Default(),
+		Metrics: kafkametrics.New(name),
+	}
+	// Invalid values are reported by Start, unless flags override them
+	if format := os.Getenv("KAFKA_LOG_FORMAT"); format != "" {
+		a.format = format
+	}
+	if level := os.Getenv("KAFKA_LOG_LEVEL"); level != "" {
+		if err := a.level.UnmarshalText([]byte(level)); err != nil {
+			a.envErr = fmt.Errorf("KAFKA_LOG_LEVEL: %w", err)
+		}
+	}
+	return a
+}
+
+// BindFlags adds the -log-format and -log-level flags, which override the
+// environment
+func (a *App) BindFlags(fs *flag.FlagSet) {
+	fs.Func("log-format", fmt.Sprintf("log format, %s or %s (default %s, env KAFKA_LOG_FORMAT)", FormatText, FormatJSON, a.format), func(s string) error {
+		a.format = s
+		return validFormat(s)
+	})
+	fs.Func("log-level", fmt.Sprintf("minimum level of the logs: debug, info, warn or error (default %s, env KAFKA_LOG_LEVEL)", a.level), func(s string) error {
+		a.envErr = nil
+		return a.level.UnmarshalText([]byte(s))
+	})
+}
+
+// Start installs the logger and serves /metrics, /healthz and /readyz until
+// ctx is done, see StartLogging and Serve
+func (a *App) Start(ctx context.Context, metricsAddr string) error {
+	if err := a.StartLogging(); err != nil {
+		return err
+	}
+	_, err := a.Serve(ctx, metricsAddr)
+	return err
+}
+
+// StartLogging installs the logger as the slog default, which also receives
+// the output of the log package. Programs that serve their endpoint later,
+// or not at all, call it instead of Start.
+func (a *App) StartLogging() error {
+	if a.envErr != nil {
+		return a.envErr
+	}
+	if err := validFormat(a.format); err != nil {
+		return fmt.Errorf("KAFKA_LOG_FORMAT: %w", err)
+	}
+	a.Logger = slog.New(newHandler(os.Stderr, a.format, a.level)).With("program", a.name)
+	slog.SetDefault(a.Logger)
+	return nil
+}
+
+// Serve exposes /metrics, /healthz and /readyz until ctx is done and
+// returns the address it listens on. The address is KAFKA_METRICS_ADDR or
+// metricsAddr, see kafkametrics.Metrics.Serve; it is empty when
+// KAFKA_METRICS_ADDR=off disables the endpoint.
+func (a *App) Serve(ctx context.Context, metricsAddr string) (string, error) {
+	a.Metrics.Handle("GET /healthz", healthHandler())
+	a.Metrics.Handle("GET /readyz", a.readyHandler())
+	addr, err := a.Metrics.Serve(ctx, metricsAddr)
+	if err != nil {
+		return "", err
+	}
+	if addr != "" {
+		a.Logger.Info("serving metrics and health checks", "metrics", "http://"+addr+"/metrics", "health", "http://"+addr+"/healthz")
+	}
+	return addr, nil
+}
+
+// Opts adds the metric hooks to a client and routes its logs into the
+// logger of the program, see ClientLogger. Call it after the logger is
+// installed.
+func (a *App) Opts() []kgo.Opt {
+	return append(a.Metrics.Opts(), kgo.WithLogger(NewClientLogger(a.Logger)))
+}
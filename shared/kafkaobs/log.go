@@ -0,0 +1,117 @@
+package kafkaobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+func validFormat(format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("unknown log format %q, want %s or %s", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Record returns l with the topic, partition and offset of r, for the logs
+// about a fetched record or a produced one. A record that failed to be
+// produced has no offset, its logs name the topic instead. Records traced
+// by kafkatrace add the trace_id of their traceparent header, which finds
+// the trace of a log line.
+func Record(l *slog.Logger, r *kgo.Record) *slog.Logger {
+	l = l.With("topic", r.Topic, "partition", r.Partition, "offset", r.Offset)
+	if traceID := traceID(r); traceID != "" {
+		l = l.With("trace_id", traceID)
+	}
+	return l
+}
+
+// traceID returns the trace ID of the W3C traceparent header,
+// version-traceid-parentid-flags
+func traceID(r *kgo.Record) string {
+	for _, h := range r.Headers {
+		if h.Key != "traceparent" {
+			continue
+		}
+		fields := strings.Split(string(h.Value), "-")
+		if len(fields) == 4 && len(fields[1]) == 32 {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Consumer returns l with the consumer group of cl, when it has one. Record
+// loggers derived from it carry the group too.
+func Consumer(l *slog.Logger, cl *kgo.Client) *slog.Logger {
+	if group, _ := cl.OptValue(kgo.ConsumerGroup).(string); group != "" {
+		return l.With("group", group)
+	}
+	return l
+}
+
+// ClientLogger routes the logs of a Kafka client into a slog logger. The
+// client logs its warnings and errors; its info logs, the connections and
+// group changes, and its debug logs of every request come with -log-level
+// debug only, they would drown the logs of the program otherwise.
+type ClientLogger struct {
+	l *slog.Logger
+}
+
+var _ kgo.Logger = ClientLogger{}
+
+// NewClientLogger returns the client logger of l, its logs have a
+// component=kafka field
+func NewClientLogger(l *slog.Logger) ClientLogger {
+	return ClientLogger{l: l.With("component", "kafka")}
+}
+
+// Level implements kgo.Logger
+func (c ClientLogger) Level() kgo.LogLevel {
+	ctx := context.Background()
+	switch {
+	case c.l.Enabled(ctx, slog.LevelDebug):
+		return kgo.LogLevelDebug
+	case c.l.Enabled(ctx, slog.LevelWarn):
+		return kgo.LogLevelWarn
+	case c.l.Enabled(ctx, slog.LevelError):
+		return kgo.LogLevelError
+	}
+	return kgo.LogLevelNone
+}
+
+// Log implements kgo.Logger, keyvals are the fields of the record
+func (c ClientLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	c.l.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+func slogLevel(level kgo.LogLevel) slog.Level {
+	switch level {
+	case kgo.LogLevelError:
+		return slog.LevelError
+	case kgo.LogLevelWarn:
+		return slog.LevelWarn
+	case kgo.LogLevelInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
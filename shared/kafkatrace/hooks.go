@@ -0,0 +1,200 @@
+package kafkatrace
+
+import (
+	"context"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operation names of the Kafka messaging semantic conventions, spans are
+// named after them and the topic
+const (
+	opSend    = "send"
+	opPoll    = "poll"
+	opProcess = "process"
+)
+
+// hooks trace the records of one client, which knows its client ID and
+// consumer group
+type hooks struct {
+	t        *Tracer
+	clientID string
+	group    string
+}
+
+var (
+	_ kgo.HookNewClient               = (*hooks)(nil)
+	_ kgo.HookProduceRecordBuffered   = (*hooks)(nil)
+	_ kgo.HookProduceRecordUnbuffered = (*hooks)(nil)
+	_ kgo.HookFetchRecordBuffered     = (*hooks)(nil)
+	_ kgo.HookFetchRecordUnbuffered   = (*hooks)(nil)
+)
+
+// clientKey carries the hooks of the client that fetched a record to
+// Process, through the record context
+type clientKey struct{}
+
+// Opts adds the hooks to a client. Each client gets its own hooks, so the
+// spans of several clients of a program name the right client and group.
+func (t *Tracer) Opts() []kgo.Opt {
+	return []kgo.Opt{kgo.WithHooks(&hooks{t: t})}
+}
+
+// OnNewClient implements kgo.HookNewClient
+func (h *hooks) OnNewClient(cl *kgo.Client) {
+	h.clientID, _ = cl.OptValue(kgo.ClientID).(string)
+	h.group, _ = cl.OptValue(kgo.ConsumerGroup).(string)
+}
+
+// OnProduceRecordBuffered implements kgo.HookProduceRecordBuffered. The
+// send span is a child of the record context, which is the ctx passed to
+// Produce unless the record has its own, and its context is injected into
+// the record headers.
+func (h *hooks) OnProduceRecordBuffered(r *kgo.Record) {
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(h.attributes(r, semconv.MessagingOperationTypeSend, opSend)...),
+	}
+	original, derived := ctx.Value(derivedKey{}).(trace.Span)
+	if derived {
+		opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{
+			SpanContext: original.SpanContext(),
+			Attributes:  []attribute.KeyValue{linkRelation.String("original")},
+		}))
+	}
+
+	ctx, span := h.t.tracer.Start(ctx, opSend+" "+r.Topic, opts...)
+	if derived {
+		original.AddLink(trace.Link{
+			SpanContext: span.SpanContext(),
+			Attributes:  []attribute.KeyValue{linkRelation.String("derived")},
+		})
+	}
+	h.t.propagator.Inject(ctx, headers{r})
+	r.Context = ctx
+}
+
+// OnProduceRecordUnbuffered implements kgo.HookProduceRecordUnbuffered
+func (h *hooks) OnProduceRecordUnbuffered(r *kgo.Record, err error) {
+	span := trace.SpanFromContext(r.Context)
+	if err != nil {
+		End(span, err)
+		return
+	}
+	span.SetAttributes(
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(r.Partition))),
+		semconv.MessagingKafkaOffset(int(r.Offset)),
+	)
+	span.End()
+}
+
+// OnFetchRecordBuffered implements kgo.HookFetchRecordBuffered. The poll
+// span is a child of the context extracted from the headers, and lasts
+// until the program polls the record.
+func (h *hooks) OnFetchRecordBuffered(r *kgo.Record) {
+	ctx := h.t.propagator.Extract(context.Background(), headers{r})
+	ctx = context.WithValue(ctx, clientKey{}, h)
+	ctx, _ = h.t.tracer.Start(ctx, opPoll+" "+r.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(h.attributes(r, semconv.MessagingOperationTypeReceive, opPoll)...),
+	)
+	r.Context = ctx
+}
+
+// OnFetchRecordUnbuffered implements kgo.HookFetchRecordUnbuffered
+func (h *hooks) OnFetchRecordUnbuffered(r *kgo.Record, polled bool) {
+	span := trace.SpanFromContext(r.Context)
+	if !polled {
+		// The partition was revoked or the client closed before the
+		// program polled the record
+		span.AddEvent("discarded")
+	}
+	span.End()
+}
+
+// attributes describes a record with the Kafka messaging semantic
+// conventions. The partition and offset of produced records are only
+// known when they are unbuffered.
+func (h *hooks) attributes(r *kgo.Record, opType attribute.KeyValue, opName string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		opType,
+		semconv.MessagingOperationName(opName),
+		semconv.MessagingDestinationName(r.Topic),
+		semconv.MessagingMessageBodySize(len(r.Value)),
+	}
+	if h.clientID != "" {
+		attrs = append(attrs, semconv.MessagingClientID(h.clientID))
+	}
+	if h.group != "" && opName != opSend {
+		attrs = append(attrs, semconv.MessagingConsumerGroupName(h.group))
+	}
+	if opName != opSend {
+		attrs = append(attrs,
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(int(r.Partition))),
+			semconv.MessagingKafkaOffset(int(r.Offset)),
+		)
+	}
+	if len(r.Key) > 0 && utf8.Valid(r.Key) {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(string(r.Key)))
+	}
+	if r.Value == nil {
+		attrs = append(attrs, semconv.MessagingKafkaMessageTombstone(true))
+	}
+	return attrs
+}
+
+// End ends a span, marking it failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// headers adapts the record headers to propagation.TextMapCarrier
+type headers struct {
+	r *kgo.Record
+}
+
+// Get implements propagation.TextMapCarrier
+func (c headers) Get(key string) string {
+	for _, h := range c.r.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier, it replaces a header copied
+// from another record instead of adding a second one
+func (c headers) Set(key, value string) {
+	for i, h := range c.r.Headers {
+		if h.Key == key {
+			c.r.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.r.Headers = append(c.r.Headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c headers) Keys() []string {
+	keys := make([]string, 0, len(c.r.Headers))
+	for _, h := range c.r.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,152 @@
+// Package kafkatrace traces records through Kafka with OpenTelemetry. The
+// client hooks inject the W3C traceparent and tracestate headers into
+// produced records and extract them from fetched ones, so a record produced
+// by one program and consumed by another ends up in one trace:
+//
+//	send orders              producer, child of the record context
+//	└── poll orders          consumer, while the record is buffered
+//	    └── process orders   started by the program with Process
+//
+// Records derived from another one, like retries and dead letters, are
+// produced with Derived: their send span starts a new trace, linked both
+// ways to the processing of the original.
+package kafkatrace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentation names the tracer, spans show it as their scope
+const instrumentation = "kafkatrace"
+
+// Tracer creates the spans of the clients it is added to
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	shutdown   func(context.Context) error
+}
+
+// New returns the tracer of the program called name, the service name of
+// its spans. OTEL_TRACES_EXPORTER selects where spans go: otlp, console
+// for stdout, or none, the default. Headers are propagated in every case,
+// so a program without an exporter does not break the traces of the
+// programs around it. The tracer is also installed as the global
+// OpenTelemetry tracer provider and propagator.
+func New(ctx context.Context, name string) (*Tracer, error) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTextMapPropagator(propagator)
+
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		provider := noop.NewTracerProvider()
+		otel.SetTracerProvider(provider)
+		return &Tracer{
+			tracer:     provider.Tracer(instrumentation),
+			propagator: propagator,
+			shutdown:   func(context.Context) error { return nil },
+		}, nil
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+	// over the name of the program
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(name)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(exporter, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return &Tracer{
+		tracer:     provider.Tracer(instrumentation),
+		propagator: propagator,
+		shutdown:   provider.Shutdown,
+	}, nil
+}
+
+// Shutdown exports the spans that are still buffered
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// Exporter describes where spans go, for startup logs
+func Exporter() string {
+	switch exporter := exporterName(); exporter {
+	case "otlp":
+		if endpoint := otlpEndpoint(); endpoint != "" {
+			return "otlp to " + endpoint
+		}
+		return "otlp to http://localhost:4318"
+	default:
+		return exporter
+	}
+}
+
+// newExporter returns the span processor of OTEL_TRACES_EXPORTER, or nil
+// when spans are not exported
+func newExporter(ctx context.Context) (sdktrace.TracerProviderOption, error) {
+	switch name := exporterName(); name {
+	case "none":
+		return nil, nil
+	case "console":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("creating console span exporter: %w", err)
+		}
+		// Spans are printed when they end, next to the logs of the program
+		return sdktrace.WithSyncer(exporter), nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if otlpEndpoint() == "" {
+			// A local collector without TLS, like the Jaeger container
+			opts = append(opts, otlptracehttp.WithEndpoint("localhost:4318"), otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("creating OTLP span exporter: %w", err)
+		}
+		return sdktrace.WithBatcher(exporter), nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q, expected otlp, console or none", name)
+	}
+}
+
+func exporterName() string {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")))
+	switch name {
+	case "":
+		return "none"
+	case "stdout":
+		return "console"
+	default:
+		return name
+	}
+}
+
+func otlpEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+}
@@ -0,0 +1,62 @@
+package kafkatrace
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// linkRelation tells on a link whether it points to the original record or
+// to a record derived from it
+var linkRelation = attribute.Key("messaging.kafka.link.relation")
+
+// derivedKey carries the span of the original record to the send span of a
+// record derived from it
+type derivedKey struct{}
+
+// Process starts the span of processing a polled record, a child of its
+// poll span, and sets the record context to it. Records produced with the
+// returned context are children of the span; end it with End.
+func (t *Tracer) Process(r *kgo.Record) (context.Context, trace.Span) {
+	ctx := r.Context
+	if ctx == nil {
+		// The client has no hooks, continue the trace of the producer
+		ctx = t.propagator.Extract(context.Background(), headers{r})
+	}
+	h, _ := ctx.Value(clientKey{}).(*hooks)
+	if h == nil {
+		h = &hooks{t: t}
+	}
+	ctx, span := t.tracer.Start(ctx, opProcess+" "+r.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(h.attributes(r, semconv.MessagingOperationTypeProcess, opProcess)...),
+	)
+	r.Context = ctx
+	return ctx, span
+}
+
+// Derived returns the context to produce a record derived from original,
+// like a retry or a dead letter. Its send span starts a new trace, so a
+// dead letter reprocessed days later does not stretch the trace of the
+// original, and the two are linked both ways: the send span links to the
+// span processing original, which links back to it.
+func (t *Tracer) Derived(ctx context.Context, original *kgo.Record) context.Context {
+	span := trace.SpanFromContext(original.Context)
+	if !span.SpanContext().IsValid() {
+		remote := t.propagator.Extract(context.Background(), headers{original})
+		span = trace.SpanFromContext(remote)
+	}
+	return context.WithValue(ctx, derivedKey{}, span)
+}
+
+// Retry records a failed attempt on the span of ctx, for programs that retry
+// the processing of a record before giving up on it
+func Retry(ctx context.Context, attempt int, err error) {
+	trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+		attribute.Int("retry.attempt", attempt),
+		attribute.String("error.message", err.Error()),
+	))
+}
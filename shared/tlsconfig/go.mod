@@ -0,0 +1,13 @@
+module tlsconfig
+
+go 1.24.0
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+)
+
+require (
+	golang.org/x/crypto v0.45.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
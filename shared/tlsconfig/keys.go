@@ -0,0 +1,70 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// LoadKeyPair reads a PEM certificate chain and its private key. The key may
+// be PKCS#1, SEC 1 or PKCS#8, and an encrypted PKCS#8 key is decrypted with
+// password.
+func LoadKeyPair(certFile, keyFile, password string) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to read client key: %w", err)
+	}
+
+	keyPEM, err = decryptKey(keyPEM, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load client key %s: %w", keyFile, err)
+	}
+
+	// X509KeyPair also checks that the key belongs to the certificate
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load client certificate %s: %w", certFile, err)
+	}
+	return cert, nil
+}
+
+// decryptKey returns the key as unencrypted PEM. Keys that are not
+// encrypted are returned unchanged.
+func decryptKey(data []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return nil, errors.New("key is encrypted but no password is configured")
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("decrypting key (wrong password?): %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+	case block.Headers["Proc-Type"] == "4,ENCRYPTED":
+		// Legacy PEM encryption is insecure and no longer supported by Go
+		return nil, errors.New("legacy encrypted PEM key, convert it with: openssl pkcs8 -topk8 -v2 aes-256-cbc -in key.pem -out key-pkcs8.pem")
+
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,223 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// defaultExpiryWarning is how long before expiry warnings are logged
+	defaultExpiryWarning = 24 * time.Hour
+	// expiryCheckInterval is how often the expiry is checked between rotations
+	expiryCheckInterval = time.Hour
+	// reloadDelay collects the events of one rotation, which usually writes
+	// the certificate and the key separately
+	reloadDelay = 500 * time.Millisecond
+)
+
+// Watch is like Build, but the client certificate is served through
+// GetClientCertificate and reloaded whenever the certificate or key file
+// changes, until ctx is done. Connections opened after a rotation present
+// the new certificate, existing connections keep the one they started with.
+func (c Config) Watch(ctx context.Context) (*tls.Config, error) {
+	tlsConfig, err := c.Build()
+	if err != nil || !c.MutualTLS() {
+		return tlsConfig, err
+	}
+
+	reloader, err := NewCertReloader(c.CertFile, c.KeyFile, c.KeyPassword, c.ExpiryWarning)
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.Watch(ctx); err != nil {
+		return nil, err
+	}
+
+	tlsConfig.Certificates = nil
+	tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	return tlsConfig, nil
+}
+
+// CertReloader holds the current client certificate and replaces it when
+// the files on disk change. A pair that fails to load, e.g. because only
+// the certificate has been written so far, is logged and the previous
+// certificate is kept.
+type CertReloader struct {
+	certFile      string
+	keyFile       string
+	password      string
+	expiryWarning time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	leaf *x509.Certificate
+	hash [sha256.Size]byte
+}
+
+// NewCertReloader loads the initial certificate, which has to succeed. An
+// expiryWarning of zero warns a day before the certificate expires.
+func NewCertReloader(certFile, keyFile, password string, expiryWarning time.Duration) (*CertReloader, error) {
+	if expiryWarning <= 0 {
+		expiryWarning = defaultExpiryWarning
+	}
+	r := &CertReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		password:      password,
+		expiryWarning: expiryWarning,
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	r.checkExpiry()
+	return r, nil
+}
+
+// GetClientCertificate is called by crypto/tls for every handshake in which
+// the broker asks for a client certificate
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Leaf returns the parsed current certificate
+func (r *CertReloader) Leaf() *x509.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.leaf
+}
+
+// Reload loads the files again and reports whether the certificate changed
+func (r *CertReloader) Reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client key: %w", err)
+	}
+	hash := sha256.Sum256(bytes.Join([][]byte{certPEM, keyPEM}, []byte{0}))
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && hash == r.hash
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := LoadKeyPair(r.certFile, r.keyFile, r.password)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.leaf = leaf
+	r.hash = hash
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the certificate on file changes and checks its expiry
+// periodically until ctx is done. The directories are watched rather than
+// the files, so rotations that replace files or swap symlinks (as mounted
+// Kubernetes secrets do) are noticed as well.
+func (r *CertReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating certificate watcher: %w", err)
+	}
+	dirs := map[string]bool{filepath.Dir(r.certFile): true, filepath.Dir(r.keyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("watching %s: %w", dir, err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		expiryTicker := time.NewTicker(expiryCheckInterval)
+		defer expiryTicker.Stop()
+
+		// Stopped until the first event arrives
+		reload := time.NewTimer(time.Hour)
+		reload.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+					reload.Reset(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("certificate watcher failed", "component", "tls", "err", err)
+			case <-reload.C:
+				r.reload()
+			case <-expiryTicker.C:
+				// Also catches rotations the watcher missed, e.g. on network file systems
+				r.reload()
+				r.checkExpiry()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload logs the outcome of Reload
+func (r *CertReloader) reload() {
+	changed, err := r.Reload()
+	if err != nil {
+		slog.Error("reloading client certificate failed, keeping the current one",
+			"component", "tls", "cert_file", r.certFile, "err", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	leaf := r.Leaf()
+	slog.Info("reloaded client certificate", "component", "tls", "subject", leaf.Subject.CommonName,
+		"serial", leaf.SerialNumber.Text(16), "not_after", leaf.NotAfter.Format(time.RFC3339))
+	r.checkExpiry()
+}
+
+// checkExpiry logs a warning when the certificate expires soon or has expired
+func (r *CertReloader) checkExpiry() {
+	leaf := r.Leaf()
+	remaining := time.Until(leaf.NotAfter)
+	switch {
+	case remaining <= 0:
+		slog.Error("client certificate expired, brokers will reject new connections",
+			"component", "tls", "subject", leaf.Subject.CommonName, "not_after", leaf.NotAfter.Format(time.RFC3339))
+	case remaining <= r.expiryWarning:
+		slog.Warn("client certificate expires soon", "component", "tls", "subject", leaf.Subject.CommonName,
+			"remaining", remaining.Round(time.Minute).String(), "not_after", leaf.NotAfter.Format(time.RFC3339))
+	}
+}
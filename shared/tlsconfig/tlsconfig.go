@@ -0,0 +1,178 @@
+// Package tlsconfig builds the TLS configuration of Kafka clients: a CA
+// bundle to verify brokers, an optional client certificate for mTLS and
+// hostname verification that still works when brokers are reached through
+// a different name, such as localhost.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config describes where the certificates are and how brokers are verified
+type Config struct {
+	// CAFile is a PEM bundle of the CAs that sign broker certificates,
+	// the system roots are used when it is empty
+	CAFile string
+	// CertFile and KeyFile are the client certificate (optionally followed
+	// by its intermediates) and its private key, both PEM, for mTLS
+	CertFile string
+	KeyFile  string
+	// KeyPassword decrypts an encrypted PKCS#8 key ("ENCRYPTED PRIVATE KEY")
+	KeyPassword string
+	// ServerName replaces the dialed host for SNI and hostname verification,
+	// e.g. kafka while connecting to localhost:9093
+	ServerName string
+	// VerifySANs accepts a broker certificate when any of these DNS names or
+	// IP addresses is among its SANs, regardless of the dialed host. Use it
+	// when brokers have different certificates that share a name.
+	VerifySANs []string
+	// ExpiryWarning is how long before the client certificate expires Watch
+	// starts logging warnings, a day when zero
+	ExpiryWarning time.Duration
+}
+
+// FromEnv overrides the fields of defaults that are set in the environment:
+// KAFKA_TLS_CA_FILE, KAFKA_TLS_CERT_FILE, KAFKA_TLS_KEY_FILE,
+// KAFKA_TLS_KEY_PASSWORD, KAFKA_TLS_SERVER_NAME, KAFKA_TLS_VERIFY_SANS
+// (comma-separated) and KAFKA_TLS_EXPIRY_WARNING (a duration such as 48h)
+func FromEnv(defaults Config) Config {
+	c := defaults
+	set := func(field *string, key string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = v
+		}
+	}
+	set(&c.CAFile, "KAFKA_TLS_CA_FILE")
+	set(&c.CertFile, "KAFKA_TLS_CERT_FILE")
+	set(&c.KeyFile, "KAFKA_TLS_KEY_FILE")
+	set(&c.KeyPassword, "KAFKA_TLS_KEY_PASSWORD")
+	set(&c.ServerName, "KAFKA_TLS_SERVER_NAME")
+	if v, ok := os.LookupEnv("KAFKA_TLS_VERIFY_SANS"); ok {
+		c.VerifySANs = nil
+		for _, san := range strings.Split(v, ",") {
+			if san = strings.TrimSpace(san); san != "" {
+				c.VerifySANs = append(c.VerifySANs, san)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("KAFKA_TLS_EXPIRY_WARNING"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.ExpiryWarning = d
+		}
+	}
+	return c
+}
+
+// MutualTLS reports whether a client certificate is configured
+func (c Config) MutualTLS() bool {
+	return c.CertFile != ""
+}
+
+// Build loads the certificates and returns a configuration for
+// kgo.DialTLSConfig. The broker certificate chain is always verified.
+func (c Config) Build() (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("a client certificate needs both a certificate and a key file")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pool, err := loadCAs(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.MutualTLS() {
+		cert, err := LoadKeyPair(c.CertFile, c.KeyFile, c.KeyPassword)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.VerifySANs) > 0 {
+		// The standard verification compares the certificate with the dialed
+		// host, which is turned off here and replaced by verifyPeer. Without
+		// a session cache connections are never resumed, so verifyPeer runs
+		// on every handshake.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyPeer(tlsConfig.RootCAs, c.VerifySANs)
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCAs reads a PEM bundle that contains one or more CA certificates
+func loadCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no CA certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// verifyPeer verifies the chain presented by the broker against roots and
+// requires the leaf certificate to carry one of the expected SANs
+func verifyPeer(roots *x509.CertPool, sans []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("tls: broker presented no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("tls: parsing broker certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		leaf := certs[0]
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}); err != nil {
+			return fmt.Errorf("tls: verifying broker certificate: %w", err)
+		}
+
+		for _, san := range sans {
+			if leaf.VerifyHostname(san) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("tls: broker certificate %q is valid for %s, expected one of %s",
+			leaf.Subject.CommonName, describeSANs(leaf), strings.Join(sans, ", "))
+	}
+}
+
+func describeSANs(cert *x509.Certificate) string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		return "no SANs"
+	}
+	return strings.Join(names, ", ")
+}